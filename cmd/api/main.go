@@ -1,61 +1,147 @@
-package main
-
-import (
-	"log"
-	"time"
-
-	"garrettpfoy/orbit-api/internal/repositories/access_token"
-	// "garrettpfoy/orbit-api/internal/repositories/queue"
-	// "garrettpfoy/orbit-api/internal/repositories/session"
-	// "garrettpfoy/orbit-api/internal/repositories/user"
-	// "garrettpfoy/orbit-api/internal/repositories/vote"
-
-	"garrettpfoy/orbit-api/internal/services/encryption"
-
-	"garrettpfoy/orbit-api/internal/environment"
-
-	"garrettpfoy/orbit-api/internal/models"
-
-	"github.com/glebarez/sqlite"
-	"gorm.io/gorm"
-)
-
-func main() {
-	db, err := gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
-	if err != nil {
-		log.Fatal("failed to connect database: ", err)
-	}
-
-	environment, err := environment.LoadOrbitEnvironment(false)
-	if err != nil {
-		log.Fatal("failed to establish the orbit environment: ", err)
-	}
-
-	models.SetEncryptionService(encryption.NewEncryptionService(environment.ENCRYPTION_SECRET))
-
-	// Auto migrate the schema
-	db.AutoMigrate(&models.Session{}, &models.AccessToken{}, &models.Queue{}, &models.User{})
-
-	accessTokenRepo := access_token.NewGormAccessTokenRepository(db)
-
-	// Example: Creating a new access token
-	newToken := models.AccessToken{
-		UserID:       1, // assuming user ID 1 exists
-		SessionID:    1,
-		AccessToken:  "example_access_token",
-		RefreshToken: "example_refresh_token",
-		ExpiryTime:   time.Now().Add(time.Hour * 1),
-	}
-	err = accessTokenRepo.CreateAccessToken(&newToken)
-	if err != nil {
-		log.Fatalf("Failed to create access token: %v", err)
-	}
-
-	// Fetch and decrypt the access token
-	token, err := accessTokenRepo.GetAccessToken(newToken.ID)
-	if err != nil {
-		log.Fatalf("Failed to get access token: %v", err)
-	}
-	log.Printf("Decrypted Access Token: %s", token.AccessToken)
-	log.Printf("Decrypted Refresh Token: %s", token.RefreshToken)
-}
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"garrettpfoy/orbit-api/internal/handlers/host/auth"
+	sessionHandler "garrettpfoy/orbit-api/internal/handlers/host/session"
+
+	"garrettpfoy/orbit-api/internal/repositories/access_token"
+	"garrettpfoy/orbit-api/internal/repositories/oauth_state"
+	"garrettpfoy/orbit-api/internal/repositories/queue"
+	"garrettpfoy/orbit-api/internal/repositories/session"
+	"garrettpfoy/orbit-api/internal/repositories/track"
+	"garrettpfoy/orbit-api/internal/repositories/user"
+
+	"garrettpfoy/orbit-api/internal/services/encryption"
+	"garrettpfoy/orbit-api/internal/services/lifecycle"
+	"garrettpfoy/orbit-api/internal/services/oauth2"
+	"garrettpfoy/orbit-api/internal/services/playback"
+	"garrettpfoy/orbit-api/internal/services/redirect"
+	"garrettpfoy/orbit-api/internal/services/spotify"
+	"garrettpfoy/orbit-api/internal/services/token_manager"
+	"garrettpfoy/orbit-api/internal/services/track_resolver"
+	"garrettpfoy/orbit-api/internal/services/voting"
+
+	"garrettpfoy/orbit-api/internal/environment"
+
+	"garrettpfoy/orbit-api/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+func main() {
+	// Errors are translated so the repositories can tell constraint violations, such as duplicate keys, apart
+	db, err := gorm.Open(sqlite.Open("test.db"), &gorm.Config{TranslateError: true})
+	if err != nil {
+		log.Fatal("failed to connect database: ", err)
+	}
+
+	environment, err := environment.LoadOrbitEnvironment(false)
+	if err != nil {
+		log.Fatal("failed to establish the orbit environment: ", err)
+	}
+
+	models.SetEncryptionService(encryption.NewEncryptionService(environment.ENCRYPTION_SECRET))
+
+	// Auto migrate the schema
+	db.AutoMigrate(&models.Session{}, &models.AccessToken{}, &models.Queue{}, &models.User{}, &models.OAuthState{}, &models.Track{}, &models.Vote{}, &models.SkipVote{}, &models.VoteEvent{}, &models.ModerationAction{})
+
+	userRepo := user.NewGormUserRepository(db)
+	accessTokenRepo := access_token.NewGormAccessTokenRepository(db)
+	sessionRepo := session.NewGormSessionRepository(db)
+	trackRepo := track.NewGormTrackRepository(db)
+
+	// Queued tracks have their metadata resolved with Orbit's own credentials, so clients can render the queue
+	// without calling Spotify, and without a session host's token being spent on it
+	catalog := spotify.NewCatalogClient(context.Background(), environment.SPOTIFY_CLIENT_ID, environment.SPOTIFY_CLIENT_SECRET)
+	trackResolver := track_resolver.NewResolver(trackRepo, catalog, track_resolver.DefaultCacheSize, track_resolver.DefaultTTL)
+	queueRepo := queue.NewGormQueueRepository(db).WithTrackResolver(trackResolver)
+
+	spotifyProvider := oauth2.NewSpotifyProvider(
+		environment.SPOTIFY_CLIENT_ID,
+		environment.SPOTIFY_CLIENT_SECRET,
+		environment.SPOTIFY_REDIRECT_URL,
+	)
+	spotifyProvider.Linker = auth.NewSpotifyUserLinker(userRepo, accessTokenRepo)
+
+	enabledProviders := []*oauth2.Provider{spotifyProvider}
+
+	// Google sign in is only offered when it is configured, Spotify is all a host needs
+	if environment.GoogleEnabled() {
+		googleProvider := oauth2.NewGoogleProvider(
+			environment.GOOGLE_CLIENT_ID,
+			environment.GOOGLE_CLIENT_SECRET,
+			environment.GOOGLE_REDIRECT_URL,
+			environment.GOOGLE_JWKS_URL,
+		)
+		googleProvider.Linker = auth.NewEmailUserLinker(userRepo)
+		enabledProviders = append(enabledProviders, googleProvider)
+	}
+
+	providers := oauth2.NewRegistry()
+	for _, provider := range enabledProviders {
+		if err := providers.Register(provider); err != nil {
+			log.Fatal("failed to register oauth2 provider: ", err)
+		}
+	}
+
+	// Expired states are swept every minute, regardless of where they are stored
+	stateTTL := time.Minute * time.Duration(environment.OAUTH_STATE_TTL)
+	var states oauth2.StateStore
+	if environment.OAUTH_STATE_STORE == "memory" {
+		states = oauth2.NewMemoryStateStore(stateTTL, time.Minute)
+	} else {
+		states = oauth2.NewDatabaseStateStore(oauth_state.NewGormOAuthStateRepository(db), stateTTL, time.Minute)
+	}
+	defer states.Close()
+
+	// Background workers run until the API shuts down
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Session host tokens are refreshed ahead of their expiry, so a party never stops because a token expired
+	tokenManager := token_manager.NewManager(accessTokenRepo, spotifyProvider.Config, token_manager.DefaultRefreshMargin)
+	go token_manager.NewRefresher(tokenManager, accessTokenRepo, time.Minute, 10*time.Minute).Run(ctx)
+
+	// Every playable session gets a coordinator that plays its queue on the host's player, until the session ends
+	players := func(ctx context.Context, sessionID uint) *spotify.Client {
+		return spotify.NewClient(tokenManager.ClientForSession(ctx, sessionID), "")
+	}
+	supervisor := playback.NewSupervisor(sessionRepo, queueRepo, players, playback.DefaultInterval, playback.DefaultLead, 10*time.Second).
+		WithSkipPolicy(voting.NewService(db))
+	go supervisor.Run(ctx)
+
+	// Sessions nobody played or voted in for their idle timeout are ended, their playback stopped and their host
+	// tokens unlinked
+	lifecycleService := lifecycle.NewService(sessionRepo, accessTokenRepo).WithPlayback(supervisor)
+	go lifecycle.NewSweeper(lifecycleService, time.Minute).Run(ctx)
+
+	redirects, err := redirect.NewAllowlist(environment.REDIRECT_ALLOWLIST)
+	if err != nil {
+		log.Fatal("failed to parse the redirect allowlist: ", err)
+	}
+
+	router := chi.NewRouter()
+	router.Mount("/auth", auth.NewAuthHandler(environment, providers, states, redirects).Routes())
+
+	sessions := sessionHandler.NewSessionHandler(environment, sessionRepo)
+	if environment.QR_LOGO_PATH != "" {
+		logo, err := sessionHandler.LoadLogo(environment.QR_LOGO_PATH)
+		if err != nil {
+			log.Fatal("failed to load the QR code logo: ", err)
+		}
+		sessions.WithLogo(logo)
+	}
+	router.Mount("/sessions", sessions.Routes())
+
+	log.Printf("Orbit API listening on port %s", environment.PORT)
+	if err := http.ListenAndServe(":"+environment.PORT, router); err != nil {
+		log.Fatal("failed to serve the orbit api: ", err)
+	}
+}
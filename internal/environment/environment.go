@@ -1,65 +1,183 @@
-package environment
-
-import (
-	"fmt"
-	"os"
-
-	"github.com/joho/godotenv"
-)
-
-type OrbitEnvironment struct {
-	IS_PRODUCTION         bool   // Whether or not we are in production, used for various security measures
-	ENCRYPTION_SECRET     string // Secret of size 32 that is used for salting/encrypting access tokens in the database
-	JWT_SECRET            string // Secret that is used to sign JWT tokens
-	SPOTIFY_CLIENT_ID     string // Spotify client ID
-	SPOTIFY_CLIENT_SECRET string // Spotify client secret
-	SPOTIFY_REDIRECT_URL  string // Spotify redirect URL
-}
-
-func LoadOrbitEnvironment(IS_PRODUCTION bool) (*OrbitEnvironment, error) {
-	err := godotenv.Load()
-	if err != nil && !IS_PRODUCTION {
-		return nil, fmt.Errorf("there was an issue loading the .env file whilst in development mode %s", err.Error())
-	}
-
-	var orbitEnvironment OrbitEnvironment
-
-	orbitEnvironment.IS_PRODUCTION = IS_PRODUCTION
-
-	if encryptionSecret := os.Getenv("ENCRYPTION_SECRET"); encryptionSecret != "" && len(encryptionSecret) == 32 {
-		// Valid encryption secret
-		orbitEnvironment.ENCRYPTION_SECRET = encryptionSecret
-	} else {
-		return nil, fmt.Errorf("the required secret ENCRYPTION_SECRET is not valid or not supplied. Length: %d", len(encryptionSecret))
-	}
-
-	if jwtSecret := os.Getenv("JWT_SECRET"); jwtSecret != "" {
-		// Valid JWT secret
-		orbitEnvironment.JWT_SECRET = jwtSecret
-	} else {
-		return nil, fmt.Errorf("the required secret JWT_SECRET is not valid or not supplied")
-	}
-
-	if spotifyClientID := os.Getenv("SPOTIFY_CLIENT_ID"); spotifyClientID != "" {
-		// Valid Spotify client ID
-		orbitEnvironment.SPOTIFY_CLIENT_ID = spotifyClientID
-	} else {
-		return nil, fmt.Errorf("the required secret SPOTIFY_CLIENT_ID is not valid or not supplied")
-	}
-
-	if spotifyClientSecret := os.Getenv("SPOTIFY_CLIENT_SECRET"); spotifyClientSecret != "" {
-		// Valid Spotify client secret
-		orbitEnvironment.SPOTIFY_CLIENT_SECRET = spotifyClientSecret
-	} else {
-		return nil, fmt.Errorf("the required secret SPOTIFY_CLIENT_SECRET is not valid or not supplied")
-	}
-
-	if spotifyRedirectURL := os.Getenv("SPOTIFY_REDIRECT_URL"); spotifyRedirectURL != "" {
-		// Valid Spotify redirect URL
-		orbitEnvironment.SPOTIFY_REDIRECT_URL = spotifyRedirectURL
-	} else {
-		return nil, fmt.Errorf("the required secret SPOTIFY_REDIRECT_URL is not valid or not supplied")
-	}
-
-	return &orbitEnvironment, nil
-}
+package environment
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+type OrbitEnvironment struct {
+	IS_PRODUCTION         bool     // Whether or not we are in production, used for various security measures
+	ENCRYPTION_SECRET     string   // Secret of size 32 that is used for salting/encrypting access tokens in the database
+	JWT_SECRET            string   // Secret that is used to sign JWT tokens
+	SPOTIFY_CLIENT_ID     string   // Spotify client ID
+	SPOTIFY_CLIENT_SECRET string   // Spotify client secret
+	SPOTIFY_REDIRECT_URL  string   // Spotify redirect URL
+	GOOGLE_CLIENT_ID      string   // Google client ID
+	GOOGLE_CLIENT_SECRET  string   // Google client secret
+	GOOGLE_REDIRECT_URL   string   // Google redirect URL
+	GOOGLE_JWKS_URL       string   // URL of the key set Google ID tokens are verified against
+	JWT_KEY               string   // Name of the cookie the JWT is returned in
+	JWT_LIFESPAN          int      // Lifespan of a JWT in minutes
+	DOMAIN                string   // Domain the JWT cookie is scoped to
+	LOGIN_REDIRECT_URL    string   // URL the user is redirected to after successfully logging in, unless the login asks for another allowed URL
+	LOGIN_FAILURE_URL     string   // URL the user is redirected to when logging in fails, with the reason in the error query parameter
+	REDIRECT_ALLOWLIST    []string // Origins (e.g. https://orbit.example.com) and app schemes (e.g. orbit://) logins may redirect to
+	PORT                  string   // Port the API listens on
+	OAUTH_STATE_STORE     string   // Where the state of logins in progress is kept, either "database" or "memory" (single replica only)
+	OAUTH_STATE_TTL       int      // Time in minutes a user has to complete a login
+	JOIN_BASE_URL         string   // Base URL of the public join page, sessions are joined at the base URL followed by their slug
+	QR_LOGO_PATH          string   // Path to a PNG logo that can be drawn over the center of join QR codes
+}
+
+// GoogleEnabled reports whether Google sign in is configured.
+func (env *OrbitEnvironment) GoogleEnabled() bool {
+	return env.GOOGLE_CLIENT_ID != "" && env.GOOGLE_CLIENT_SECRET != "" && env.GOOGLE_REDIRECT_URL != ""
+}
+
+func LoadOrbitEnvironment(IS_PRODUCTION bool) (*OrbitEnvironment, error) {
+	err := godotenv.Load()
+	if err != nil && !IS_PRODUCTION {
+		return nil, fmt.Errorf("there was an issue loading the .env file whilst in development mode %s", err.Error())
+	}
+
+	var orbitEnvironment OrbitEnvironment
+
+	orbitEnvironment.IS_PRODUCTION = IS_PRODUCTION
+
+	if encryptionSecret := os.Getenv("ENCRYPTION_SECRET"); encryptionSecret != "" && len(encryptionSecret) == 32 {
+		// Valid encryption secret
+		orbitEnvironment.ENCRYPTION_SECRET = encryptionSecret
+	} else {
+		return nil, fmt.Errorf("the required secret ENCRYPTION_SECRET is not valid or not supplied. Length: %d", len(encryptionSecret))
+	}
+
+	if jwtSecret := os.Getenv("JWT_SECRET"); jwtSecret != "" {
+		// Valid JWT secret
+		orbitEnvironment.JWT_SECRET = jwtSecret
+	} else {
+		return nil, fmt.Errorf("the required secret JWT_SECRET is not valid or not supplied")
+	}
+
+	if spotifyClientID := os.Getenv("SPOTIFY_CLIENT_ID"); spotifyClientID != "" {
+		// Valid Spotify client ID
+		orbitEnvironment.SPOTIFY_CLIENT_ID = spotifyClientID
+	} else {
+		return nil, fmt.Errorf("the required secret SPOTIFY_CLIENT_ID is not valid or not supplied")
+	}
+
+	if spotifyClientSecret := os.Getenv("SPOTIFY_CLIENT_SECRET"); spotifyClientSecret != "" {
+		// Valid Spotify client secret
+		orbitEnvironment.SPOTIFY_CLIENT_SECRET = spotifyClientSecret
+	} else {
+		return nil, fmt.Errorf("the required secret SPOTIFY_CLIENT_SECRET is not valid or not supplied")
+	}
+
+	if spotifyRedirectURL := os.Getenv("SPOTIFY_REDIRECT_URL"); spotifyRedirectURL != "" {
+		// Valid Spotify redirect URL
+		orbitEnvironment.SPOTIFY_REDIRECT_URL = spotifyRedirectURL
+	} else {
+		return nil, fmt.Errorf("the required secret SPOTIFY_REDIRECT_URL is not valid or not supplied")
+	}
+
+	// Google sign in is optional, when it is not configured only Spotify logins are offered. Its settings only
+	// make sense together, so supplying some of them is an error rather than a silently disabled provider
+	orbitEnvironment.GOOGLE_CLIENT_ID = os.Getenv("GOOGLE_CLIENT_ID")
+	orbitEnvironment.GOOGLE_CLIENT_SECRET = os.Getenv("GOOGLE_CLIENT_SECRET")
+	orbitEnvironment.GOOGLE_REDIRECT_URL = os.Getenv("GOOGLE_REDIRECT_URL")
+	googleSettings := 0
+	for _, setting := range []string{orbitEnvironment.GOOGLE_CLIENT_ID, orbitEnvironment.GOOGLE_CLIENT_SECRET, orbitEnvironment.GOOGLE_REDIRECT_URL} {
+		if setting != "" {
+			googleSettings++
+		}
+	}
+	if googleSettings != 0 && googleSettings != 3 {
+		return nil, fmt.Errorf("the optional secrets GOOGLE_CLIENT_ID, GOOGLE_CLIENT_SECRET and GOOGLE_REDIRECT_URL must be supplied together")
+	}
+
+	if googleJWKSURL := os.Getenv("GOOGLE_JWKS_URL"); googleJWKSURL != "" {
+		orbitEnvironment.GOOGLE_JWKS_URL = googleJWKSURL
+	} else {
+		orbitEnvironment.GOOGLE_JWKS_URL = "https://www.googleapis.com/oauth2/v3/certs"
+	}
+
+	if jwtKey := os.Getenv("JWT_KEY"); jwtKey != "" {
+		orbitEnvironment.JWT_KEY = jwtKey
+	} else {
+		orbitEnvironment.JWT_KEY = "orbit-jwt"
+	}
+
+	if jwtLifespan := os.Getenv("JWT_LIFESPAN"); jwtLifespan != "" {
+		lifespan, err := strconv.Atoi(jwtLifespan)
+		if err != nil || lifespan <= 0 {
+			return nil, fmt.Errorf("the optional setting JWT_LIFESPAN must be a positive number of minutes")
+		}
+		orbitEnvironment.JWT_LIFESPAN = lifespan
+	} else {
+		orbitEnvironment.JWT_LIFESPAN = 60 * 24
+	}
+
+	// The domain is optional, when it is not supplied the cookie is scoped to the host that issued it
+	orbitEnvironment.DOMAIN = os.Getenv("DOMAIN")
+
+	if loginRedirectURL := os.Getenv("LOGIN_REDIRECT_URL"); loginRedirectURL != "" {
+		orbitEnvironment.LOGIN_REDIRECT_URL = loginRedirectURL
+	} else {
+		return nil, fmt.Errorf("the required setting LOGIN_REDIRECT_URL is not valid or not supplied")
+	}
+
+	if loginFailureURL := os.Getenv("LOGIN_FAILURE_URL"); loginFailureURL != "" {
+		orbitEnvironment.LOGIN_FAILURE_URL = loginFailureURL
+	} else {
+		return nil, fmt.Errorf("the required setting LOGIN_FAILURE_URL is not valid or not supplied")
+	}
+
+	// The allowlist is optional, when it is not supplied logins can only redirect to LOGIN_REDIRECT_URL
+	if redirectAllowlist := os.Getenv("REDIRECT_ALLOWLIST"); redirectAllowlist != "" {
+		orbitEnvironment.REDIRECT_ALLOWLIST = strings.Split(redirectAllowlist, ",")
+	}
+
+	if port := os.Getenv("PORT"); port != "" {
+		orbitEnvironment.PORT = port
+	} else {
+		orbitEnvironment.PORT = "8080"
+	}
+
+	if stateStore := os.Getenv("OAUTH_STATE_STORE"); stateStore == "database" || stateStore == "memory" {
+		orbitEnvironment.OAUTH_STATE_STORE = stateStore
+	} else if stateStore == "" {
+		orbitEnvironment.OAUTH_STATE_STORE = "database"
+	} else {
+		return nil, fmt.Errorf("the optional setting OAUTH_STATE_STORE must be either database or memory")
+	}
+
+	if stateTTL := os.Getenv("OAUTH_STATE_TTL"); stateTTL != "" {
+		ttl, err := strconv.Atoi(stateTTL)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("the optional setting OAUTH_STATE_TTL must be a positive number of minutes")
+		}
+		orbitEnvironment.OAUTH_STATE_TTL = ttl
+	} else {
+		orbitEnvironment.OAUTH_STATE_TTL = 10
+	}
+
+	// Unless another is supplied, guests join on the join page of the site logins return to
+	if joinBaseURL := os.Getenv("JOIN_BASE_URL"); joinBaseURL != "" {
+		orbitEnvironment.JOIN_BASE_URL = joinBaseURL
+	} else {
+		loginRedirectURL, err := url.Parse(orbitEnvironment.LOGIN_REDIRECT_URL)
+		if err != nil || loginRedirectURL.Scheme == "" || loginRedirectURL.Host == "" {
+			return nil, fmt.Errorf("the optional setting JOIN_BASE_URL must be supplied when LOGIN_REDIRECT_URL is not an absolute URL")
+		}
+		orbitEnvironment.JOIN_BASE_URL = loginRedirectURL.Scheme + "://" + loginRedirectURL.Host + "/join"
+	}
+
+	// The logo is optional, when it is not supplied QR codes can not have a logo
+	orbitEnvironment.QR_LOGO_PATH = os.Getenv("QR_LOGO_PATH")
+
+	return &orbitEnvironment, nil
+}
@@ -1,138 +1,283 @@
 package auth
 
 import (
-	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"garrettpfoy/orbit-api/internal/environment"
+	"garrettpfoy/orbit-api/internal/models"
+	jwt "garrettpfoy/orbit-api/internal/services/jwt"
 	"garrettpfoy/orbit-api/internal/services/oauth2"
+	"garrettpfoy/orbit-api/internal/services/redirect"
 	"net/http"
-	"sync"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
 )
 
-var (
-	// stateStore is a map of state strings to StateData structs.
-	stateStore = make(map[string]oauth2.StateData)
+// This package handles the OAuth2 flows of every registered provider. It is charged with
+// verifying a user's identity via the provider's OAuth2 flow, linking the identity to an Orbit
+// user through the provider's user linker (which creates the user if they do not exist), and
+// returns a signed JWT token to the client if the user is successfully authenticated. Hosts sign
+// in with Spotify, while guests without a Spotify account sign in with Google.
 
-	// mu is a mutex to protect stateStore.
-	mu sync.Mutex
+// Error codes sent to the failure URL in the error query parameter, so clients can tell
+// the user why logging in failed.
+const (
+	ErrorUnknownProvider = "unknown_provider"
+	ErrorInvalidRedirect = "invalid_redirect"
+	ErrorInvalidState    = "invalid_state"
+	ErrorAccessDenied    = "access_denied"
+	ErrorMissingCode     = "missing_code"
+	ErrorExchangeFailed  = "exchange_failed"
+	ErrorProfileFailed   = "profile_failed"
+	ErrorLinkFailed      = "link_failed"
+	ErrorInternal        = "internal_error"
 )
 
-// This package handles all interactions with the SpotifyAPI OAuth2 service. It is charged with
-// verifying a user's identity via the Spotify OAuth2 flow. It is responsible for creating a new
-// user in the database if the user does not exist, and returns a signed JWT token to the client
-// if the user is successfully authenticated.
+// AuthHandler serves the OAuth2 login flows of the providers in its registry, keeping the state
+// of logins in progress in its state store.
+type AuthHandler struct {
+	env       *environment.OrbitEnvironment
+	providers *oauth2.Registry
+	states    oauth2.StateStore
+	redirects *redirect.Allowlist
+}
+
+func NewAuthHandler(env *environment.OrbitEnvironment, providers *oauth2.Registry, states oauth2.StateStore, redirects *redirect.Allowlist) *AuthHandler {
+	return &AuthHandler{env: env, providers: providers, states: states, redirects: redirects}
+}
+
+// Routes returns a router serving the login and callback endpoints of every provider,
+// e.g. /spotify/login and /spotify/callback.
+func (h *AuthHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/{provider}/login", h.handleLogin)
+	r.Get("/{provider}/callback", h.handleCallback)
+	return r
+}
 
 // handleLogin handles the login request and redirects the user to the appropriate URL.
 // It validates the redirect URL and generates a random state for OAuth authentication.
-// If any error occurs during the process, it redirects the user to the failure page with an error message.
+// If any error occurs during the process, it redirects the user to the failure page with an error code.
+//
+// Query parameters:
+// - redirect_url: The URL to return to once authenticated, which must be in the redirect allowlist.
+// - client_state: Opaque state handed back to the client.
+// - native: Whether the client is a native app, which receives the JWT in the redirect URL.
 //
 // Parameters:
-// - env: The OrbitEnvironment containing the necessary authentication environment variables.
 // - w: The http.ResponseWriter used to write the response back to the client.
 // - r: The http.Request representing the incoming request.
 //
 // Returns: None
-func handleLogin(env *environment.OrbitEnvironment, w http.ResponseWriter, r *http.Request) {
+func (h *AuthHandler) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var clientState string = ""
+	if clientStateParam := r.URL.Query().Get("client_state"); clientStateParam != "" {
+		clientState = clientStateParam
+	}
+
+	provider, ok := h.providers.Get(chi.URLParam(r, "provider"))
+	if !ok {
+		h.fail(w, r, ErrorUnknownProvider, clientState)
+		return
+	}
+
+	redirectURL := h.env.LOGIN_REDIRECT_URL
+	if redirectURLParam := r.URL.Query().Get("redirect_url"); redirectURLParam != "" {
+		validRedirectURL, err := h.redirects.Validate(redirectURLParam)
+		if err != nil {
+			fmt.Println("Rejected redirect URL: ", redirectURLParam)
+			h.fail(w, r, ErrorInvalidRedirect, clientState)
+			return
+		}
+		redirectURL = validRedirectURL
+	}
+
 	randomState := oauth2.GenerateRandomState(32)
 	if randomState == "" {
-		http.Redirect(w, r, "https://google.com", http.StatusTemporaryRedirect)
+		h.fail(w, r, ErrorInternal, clientState)
 		return
 	}
 
-	var clientState string = ""
-	if clientStateParam := r.URL.Query().Get("client_state"); clientStateParam != "" {
-		clientState = clientStateParam
-	}
+	// Native apps cannot read the JWT cookie, so they are handed the token in the redirect URL instead
+	native := r.URL.Query().Get("native") == "true"
 
-	oAuthStateString, oAuthStateStruct := oauth2.EncodeState(randomState, clientState)
+	oAuthStateString, oAuthStateStruct := oauth2.EncodeState(provider.Name, randomState, redirectURL, clientState, native)
+	if oAuthStateStruct == nil {
+		h.fail(w, r, ErrorInternal, clientState)
+		return
+	}
 
-	mu.Lock()
-	stateStore[randomState] = *oAuthStateStruct
-	mu.Unlock()
+	// The nonce and PKCE code verifier never leave the server, only the values derived from them do
+	provider.PrepareState(oAuthStateStruct)
 
-	url := oauth2.AuthCodeURL(oAuthStateString)
+	if err := h.states.Save(r.Context(), *oAuthStateStruct); err != nil {
+		fmt.Println("Failed to save state: ", err)
+		h.fail(w, r, ErrorInternal, clientState)
+		return
+	}
 
-	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+	http.Redirect(w, r, provider.AuthCodeURL(oAuthStateStruct, oAuthStateString), http.StatusTemporaryRedirect)
 }
 
 // handleCallback handles the callback from the authentication provider.
 // It exchanges the authorization code for an access token, retrieves user information,
 // generates a JWT token, and redirects the user to the specified redirect URL.
-// If any error occurs during the process, it redirects the user to the failure page.
+// If any error occurs during the process, it redirects the user to the failure page with an error code.
 //
 // Parameters:
-// - env: The authentication environment containing necessary configurations.
 // - w: The http.ResponseWriter used to send the HTTP response.
 // - r: The *http.Request representing the incoming HTTP request.
 //
 // Returns: None
-func handleCallback(env *environment.OrbitEnvironment, w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-
-	stateEncoded := r.URL.Query().Get("state")
+func (h *AuthHandler) handleCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		fmt.Println("No code provided.")
-		http.Redirect(w, r, "https://google.com", http.StatusTemporaryRedirect)
+	provider, ok := h.providers.Get(chi.URLParam(r, "provider"))
+	if !ok {
+		h.fail(w, r, ErrorUnknownProvider, "")
 		return
 	}
 
+	stateEncoded := r.URL.Query().Get("state")
+
 	stateJSON, err := base64.URLEncoding.DecodeString(stateEncoded)
 	if err != nil {
 		fmt.Println("Failed to decode state.")
-		http.Redirect(w, r, "https://google.com", http.StatusTemporaryRedirect)
+		h.fail(w, r, ErrorInvalidState, "")
 		return
 	}
 
 	var state oauth2.StateData
 	if err := json.Unmarshal(stateJSON, &state); err != nil {
 		fmt.Println("Failed to unmarshal state data.")
-		http.Redirect(w, r, "https://google.com", http.StatusTemporaryRedirect)
+		h.fail(w, r, ErrorInvalidState, "")
 		return
 	}
 
-	mu.Lock()
-	storedState, exists := stateStore[state.State]
-	mu.Unlock()
+	// Consuming the state removes it from the store, so it can only be used once
+	storedState, err := h.states.Consume(ctx, state.State)
+	if errors.Is(err, oauth2.ErrStateNotFound) {
+		h.fail(w, r, ErrorInvalidState, state.ClientState)
+		return
+	} else if err != nil {
+		fmt.Println("Failed to consume state: ", err)
+		h.fail(w, r, ErrorInternal, state.ClientState)
+		return
+	}
+
+	// The state must have been issued by a login with the same provider the callback is for
+	if storedState.RedirectURL != state.RedirectURL || storedState.Provider != provider.Name {
+		h.fail(w, r, ErrorInvalidState, storedState.ClientState)
+		return
+	}
 
-	if !exists || storedState.RedirectURL != state.RedirectURL {
-		http.Error(w, "invalid state", http.StatusBadRequest)
+	// The provider reports an error instead of a code when the user declines to authorize Orbit
+	if providerError := r.URL.Query().Get("error"); providerError != "" {
+		fmt.Printf("The %s login was not authorized: %s\n", provider.Name, providerError)
+		h.fail(w, r, ErrorAccessDenied, storedState.ClientState)
 		return
 	}
 
-	mu.Lock()
-	delete(stateStore, state.State)
-	mu.Unlock()
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		fmt.Println("No code provided.")
+		h.fail(w, r, ErrorMissingCode, storedState.ClientState)
+		return
+	}
 
-	token, err := oauth2.Exchange(ctx, code)
+	token, err := provider.Exchange(ctx, code, storedState)
 	if err != nil {
 		fmt.Println("Failed to exchange code for token.")
-		http.Redirect(w, r, "https://google.com", http.StatusTemporaryRedirect)
+		h.fail(w, r, ErrorExchangeFailed, storedState.ClientState)
 		return
 	}
 
-	fmt.Println("Token recieved: ", token)
+	profile, err := provider.FetchProfile(ctx, provider, token, storedState)
+	if err != nil {
+		fmt.Printf("Failed to fetch %s profile: %v\n", provider.Name, err)
+		h.fail(w, r, ErrorProfileFailed, storedState.ClientState)
+		return
+	}
 
-	// jwt, err := auth.CreateJWT(user.ID, env.JWTKey, (time.Minute * time.Duration(env.JWTLifespan)), []byte(env.JWTSecret))
+	user, err := provider.Linker.LinkUser(ctx, profile, token)
+	if err != nil {
+		fmt.Printf("Failed to link %s user: %v\n", provider.Name, err)
+		h.fail(w, r, ErrorLinkFailed, storedState.ClientState)
+		return
+	}
 
-	// if err != nil || jwt == "" {
-	// 	http.Redirect(w, r, "/failure?error=Internal%20server%20error%20surrounding%20JWT%20generation", http.StatusTemporaryRedirect)
-	// 	return
-	// }
+	h.completeLogin(w, r, user, storedState)
+}
 
-	// auth.ReturnJWT(env.IsProduction, env.JWTKey, jwt, env.Domain, time.Hour, w)
+// completeLogin issues a JWT for the authenticated user and redirects them to the redirect URL
+// of the login, appending the JWT to the URL for native apps.
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, state *oauth2.StateData) {
+	lifespan := time.Minute * time.Duration(h.env.JWT_LIFESPAN)
 
-	// log.Log(log.InfoLevel, "User authenticated and JWT set.")
+	signedJWT, err := jwt.CreateJWT(strconv.FormatUint(uint64(user.ID), 10), lifespan, []byte(h.env.JWT_SECRET))
+	if err != nil || signedJWT == "" {
+		fmt.Println("Failed to create JWT: ", err)
+		h.fail(w, r, ErrorInternal, state.ClientState)
+		return
+	}
 
-	// if state.Native {
-	// 	// Add the JWT to the Authorization header for Native app
-	// 	state.RedirectURL += "?token=" + jwt
+	jwt.ReturnJWT(h.env.IS_PRODUCTION, h.env.JWT_KEY, signedJWT, h.env.DOMAIN, lifespan, w)
+
+	params := url.Values{}
+	if state.ClientState != "" {
+		params.Set("client_state", state.ClientState)
+	}
+
+	if state.Native {
+		// Native apps cannot read the cookie, so the JWT is added to the redirect URL
+		params.Set("token", signedJWT)
+	}
 
-	// 	log.Log(log.InfoLevel, "Redirecting to native app with redirect URL: "+state.RedirectURL)
-	// }
+	redirectURL, err := withQueryParams(state.RedirectURL, params)
+	if err != nil {
+		fmt.Println("Failed to build redirect URL: ", err)
+		h.fail(w, r, ErrorInternal, state.ClientState)
+		return
+	}
+
+	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
+}
+
+// fail redirects the user to the failure URL, with the error code in the error query parameter
+// and the client state, if it is known, in the client_state query parameter.
+func (h *AuthHandler) fail(w http.ResponseWriter, r *http.Request, code, clientState string) {
+	params := url.Values{}
+	params.Set("error", code)
+	if clientState != "" {
+		params.Set("client_state", clientState)
+	}
+
+	failureURL, err := withQueryParams(h.env.LOGIN_FAILURE_URL, params)
+	if err != nil {
+		http.Error(w, code, http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, failureURL, http.StatusTemporaryRedirect)
+}
+
+// withQueryParams returns the given URL with the given query parameters set.
+func withQueryParams(rawURL string, params url.Values) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := parsed.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	parsed.RawQuery = query.Encode()
 
-	// http.Redirect(w, r, state.RedirectURL, http.StatusTemporaryRedirect)
+	return parsed.String(), nil
 }
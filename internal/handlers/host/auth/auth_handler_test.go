@@ -0,0 +1,339 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"garrettpfoy/orbit-api/internal/environment"
+	"garrettpfoy/orbit-api/internal/handlers/host/auth"
+	"garrettpfoy/orbit-api/internal/models"
+	jwt "garrettpfoy/orbit-api/internal/services/jwt"
+	"garrettpfoy/orbit-api/internal/services/oauth2"
+	"garrettpfoy/orbit-api/internal/services/redirect"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	xoauth2 "golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// fakeProvider is an OAuth2 provider that issues a code for a login once the test authorizes it. Its token endpoint
+// only exchanges a code with the PKCE verifier whose challenge the login sent, and hands back the nonce of the login
+// the way an OpenID Connect ID token would.
+type fakeProvider struct {
+	server *httptest.Server
+
+	mu     sync.Mutex
+	logins map[string]url.Values
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	fake := &fakeProvider{logins: make(map[string]url.Values)}
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.handleToken))
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+// authorize issues the given code for the login whose authorization URL the user was sent to.
+func (f *fakeProvider) authorize(code string, authURL *url.URL) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logins[code] = authURL.Query()
+}
+
+func (f *fakeProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	login, ok := f.logins[r.PostFormValue("code")]
+	f.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(challenge[:]) != login.Get("code_challenge") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access_" + r.PostFormValue("code"),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"nonce":        login.Get("nonce"),
+	})
+}
+
+// provider returns the Orbit provider for the fake, which checks the nonce the token came back with against the login's.
+func (f *fakeProvider) provider(name string, linker oauth2.UserLinker) *oauth2.Provider {
+	return &oauth2.Provider{
+		Name: name,
+		Config: &xoauth2.Config{
+			ClientID:     "orbit",
+			ClientSecret: "secret",
+			RedirectURL:  "https://api.orbit.example/auth/" + name + "/callback",
+			Endpoint: xoauth2.Endpoint{
+				AuthURL:   f.server.URL + "/authorize",
+				TokenURL:  f.server.URL + "/token",
+				AuthStyle: xoauth2.AuthStyleInParams,
+			},
+		},
+		UseNonce: true,
+		UsePKCE:  true,
+		FetchProfile: func(ctx context.Context, provider *oauth2.Provider, token *xoauth2.Token, state *oauth2.StateData) (*oauth2.Profile, error) {
+			if token.Extra("nonce") != state.Nonce {
+				return nil, errors.New("nonce mismatch")
+			}
+			return &oauth2.Profile{Subject: "subject_" + token.AccessToken}, nil
+		},
+		Linker: linker,
+	}
+}
+
+// linkedUserID is the ID of the user stubLinker links every profile to.
+const linkedUserID = 7
+
+// stubLinker links every profile to the same user, or fails to link the subjects in failing.
+type stubLinker struct {
+	failing map[string]bool
+}
+
+func (l stubLinker) LinkUser(_ context.Context, profile *oauth2.Profile, _ *xoauth2.Token) (*models.User, error) {
+	if l.failing[profile.Subject] {
+		return nil, errors.New("link failed")
+	}
+	return &models.User{Model: gorm.Model{ID: linkedUserID}, Username: profile.Subject}, nil
+}
+
+// setupHandler creates a router serving the login flows of a "fake" and an "other" provider.
+func setupHandler(t *testing.T, stateTTL time.Duration) (chi.Router, *fakeProvider, *environment.OrbitEnvironment) {
+	fake := newFakeProvider(t)
+	linker := stubLinker{failing: map[string]bool{"subject_access_unlinkable": true}}
+
+	providers := oauth2.NewRegistry()
+	assert.NoError(t, providers.Register(fake.provider("fake", linker)))
+	assert.NoError(t, providers.Register(fake.provider("other", linker)))
+
+	states := oauth2.NewMemoryStateStore(stateTTL, time.Hour)
+	t.Cleanup(states.Close)
+
+	redirects, err := redirect.NewAllowlist([]string{"https://orbit.example", "orbit://"})
+	assert.NoError(t, err)
+
+	env := &environment.OrbitEnvironment{
+		JWT_SECRET:         "secret",
+		JWT_KEY:            "orbit_jwt",
+		JWT_LIFESPAN:       60,
+		DOMAIN:             "orbit.example",
+		LOGIN_REDIRECT_URL: "https://orbit.example/home",
+		LOGIN_FAILURE_URL:  "https://orbit.example/login?retry=true",
+	}
+	return auth.NewAuthHandler(env, providers, states, redirects).Routes(), fake, env
+}
+
+// get serves a GET request and returns the URL it redirected to.
+func get(t *testing.T, router chi.Router, target string) (*httptest.ResponseRecorder, *url.URL) {
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, target, nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, response.Code)
+
+	location, err := url.Parse(response.Header().Get("Location"))
+	assert.NoError(t, err)
+	return response, location
+}
+
+// login starts a login with the provider and returns the authorization URL the user is sent to.
+func login(t *testing.T, router chi.Router, provider string, query url.Values) *url.URL {
+	_, authURL := get(t, router, "/"+provider+"/login?"+query.Encode())
+	assert.Equal(t, "/authorize", authURL.Path)
+	return authURL
+}
+
+// callback returns from the provider with the given query and returns the URL the user ends up at.
+func callback(t *testing.T, router chi.Router, provider string, query url.Values) (*httptest.ResponseRecorder, *url.URL) {
+	return get(t, router, "/"+provider+"/callback?"+query.Encode())
+}
+
+// assertFailure asserts the user was sent to the failure URL with the given error code and client state.
+func assertFailure(t *testing.T, location *url.URL, code, clientState string) {
+	assert.Equal(t, "https://orbit.example/login", location.Scheme+"://"+location.Host+location.Path)
+	assert.Equal(t, "true", location.Query().Get("retry"))
+	assert.Equal(t, code, location.Query().Get("error"))
+	assert.Equal(t, clientState, location.Query().Get("client_state"))
+}
+
+func TestHandleLogin(t *testing.T) {
+	router, _, _ := setupHandler(t, time.Minute)
+
+	authURL := login(t, router, "fake", url.Values{"redirect_url": {"orbit://home"}, "client_state": {"abc"}})
+	query := authURL.Query()
+	assert.Equal(t, "orbit", query.Get("client_id"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.NotEmpty(t, query.Get("code_challenge"))
+	assert.Len(t, query.Get("nonce"), 32)
+
+	// The state carries the login back to the callback, but not its secrets
+	stateJSON, err := base64.URLEncoding.DecodeString(query.Get("state"))
+	assert.NoError(t, err)
+	var state map[string]interface{}
+	assert.NoError(t, json.Unmarshal(stateJSON, &state))
+	assert.Equal(t, "fake", state["provider"])
+	assert.Equal(t, "orbit://home", state["redirect_url"])
+	assert.Equal(t, "abc", state["client_state"])
+	assert.NotContains(t, string(stateJSON), query.Get("nonce"))
+	assert.NotContains(t, state, "code_verifier")
+
+	// Every login gets its own secrets
+	other := login(t, router, "fake", url.Values{}).Query()
+	assert.NotEqual(t, query.Get("state"), other.Get("state"))
+	assert.NotEqual(t, query.Get("code_challenge"), other.Get("code_challenge"))
+	assert.NotEqual(t, query.Get("nonce"), other.Get("nonce"))
+}
+
+func TestHandleLoginErrors(t *testing.T) {
+	router, _, _ := setupHandler(t, time.Minute)
+
+	_, location := get(t, router, "/github/login?client_state=abc")
+	assertFailure(t, location, auth.ErrorUnknownProvider, "abc")
+
+	_, location = get(t, router, "/fake/login?client_state=abc&redirect_url="+url.QueryEscape("https://evil.example/steal"))
+	assertFailure(t, location, auth.ErrorInvalidRedirect, "abc")
+}
+
+func TestHandleCallback(t *testing.T) {
+	router, fake, env := setupHandler(t, time.Minute)
+
+	// A web login gets the JWT as a cookie only
+	authURL := login(t, router, "fake", url.Values{"client_state": {"abc"}})
+	fake.authorize("code", authURL)
+	response, location := callback(t, router, "fake", url.Values{"state": {authURL.Query().Get("state")}, "code": {"code"}})
+	assert.Equal(t, "https://orbit.example/home?client_state=abc", location.String())
+
+	cookies := response.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, env.JWT_KEY, cookies[0].Name)
+	userID, err := jwt.ParseJWT(cookies[0].Value, []byte(env.JWT_SECRET))
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(linkedUserID), userID)
+
+	// A native login gets the JWT in the redirect URL as well
+	authURL = login(t, router, "fake", url.Values{"redirect_url": {"orbit://home"}, "native": {"true"}})
+	fake.authorize("native_code", authURL)
+	_, location = callback(t, router, "fake", url.Values{"state": {authURL.Query().Get("state")}, "code": {"native_code"}})
+	assert.Equal(t, "orbit", location.Scheme)
+	userID, err = jwt.ParseJWT(location.Query().Get("token"), []byte(env.JWT_SECRET))
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(linkedUserID), userID)
+}
+
+func TestHandleCallbackErrors(t *testing.T) {
+	router, fake, _ := setupHandler(t, time.Minute)
+
+	// start starts a login with the provider that the fake authorizes with the given code, returning its state
+	start := func(provider, code string) string {
+		authURL := login(t, router, provider, url.Values{"client_state": {"abc"}})
+		fake.authorize(code, authURL)
+		return authURL.Query().Get("state")
+	}
+
+	t.Run("Unknown Provider", func(t *testing.T) {
+		_, location := callback(t, router, "github", url.Values{"state": {start("fake", "code")}, "code": {"code"}})
+		assertFailure(t, location, auth.ErrorUnknownProvider, "")
+	})
+
+	t.Run("Undecodable State", func(t *testing.T) {
+		_, location := callback(t, router, "fake", url.Values{"state": {"not-base64!"}, "code": {"code"}})
+		assertFailure(t, location, auth.ErrorInvalidState, "")
+	})
+
+	t.Run("State Not Issued", func(t *testing.T) {
+		forged, _ := oauth2.EncodeState("fake", "forged", "https://orbit.example/home", "abc", false)
+		_, location := callback(t, router, "fake", url.Values{"state": {forged}, "code": {"code"}})
+		assertFailure(t, location, auth.ErrorInvalidState, "abc")
+	})
+
+	t.Run("State Mismatch", func(t *testing.T) {
+		// The random state was issued, but the redirect URL next to it was changed
+		state := start("fake", "mismatch_code")
+		stateJSON, _ := base64.URLEncoding.DecodeString(state)
+		var data oauth2.StateData
+		assert.NoError(t, json.Unmarshal(stateJSON, &data))
+		tampered, _ := oauth2.EncodeState(data.Provider, data.State, "https://orbit.example/elsewhere", data.ClientState, data.Native)
+
+		_, location := callback(t, router, "fake", url.Values{"state": {tampered}, "code": {"mismatch_code"}})
+		assertFailure(t, location, auth.ErrorInvalidState, "abc")
+	})
+
+	t.Run("State Of Another Provider", func(t *testing.T) {
+		_, location := callback(t, router, "other", url.Values{"state": {start("fake", "provider_code")}, "code": {"provider_code"}})
+		assertFailure(t, location, auth.ErrorInvalidState, "abc")
+	})
+
+	t.Run("State Used Twice", func(t *testing.T) {
+		state := start("fake", "replay_code")
+		_, location := callback(t, router, "fake", url.Values{"state": {state}, "code": {"replay_code"}})
+		assert.Empty(t, location.Query().Get("error"))
+
+		_, location = callback(t, router, "fake", url.Values{"state": {state}, "code": {"replay_code"}})
+		assertFailure(t, location, auth.ErrorInvalidState, "abc")
+	})
+
+	t.Run("Provider Error", func(t *testing.T) {
+		_, location := callback(t, router, "fake", url.Values{"state": {start("fake", "denied_code")}, "error": {"access_denied"}})
+		assertFailure(t, location, auth.ErrorAccessDenied, "abc")
+	})
+
+	t.Run("Missing Code", func(t *testing.T) {
+		_, location := callback(t, router, "fake", url.Values{"state": {start("fake", "missing_code")}})
+		assertFailure(t, location, auth.ErrorMissingCode, "abc")
+	})
+
+	t.Run("Code Refused", func(t *testing.T) {
+		_, location := callback(t, router, "fake", url.Values{"state": {start("fake", "code_refused")}, "code": {"unknown_code"}})
+		assertFailure(t, location, auth.ErrorExchangeFailed, "abc")
+	})
+
+	t.Run("PKCE Verifier Of Another Login", func(t *testing.T) {
+		// The code was issued to the first login, so the verifier of the second does not match its challenge
+		start("fake", "stolen_code")
+		_, location := callback(t, router, "fake", url.Values{"state": {start("fake", "other_code")}, "code": {"stolen_code"}})
+		assertFailure(t, location, auth.ErrorExchangeFailed, "abc")
+	})
+
+	t.Run("Nonce Of Another Login", func(t *testing.T) {
+		// The token comes back with the nonce of the login the code was issued to, which is not the login completing
+		first := login(t, router, "fake", url.Values{})
+		second := login(t, router, "fake", url.Values{"client_state": {"abc"}})
+		query := second.Query()
+		query.Set("nonce", first.Query().Get("nonce"))
+		second.RawQuery = query.Encode()
+		fake.authorize("nonce_code", second)
+
+		_, location := callback(t, router, "fake", url.Values{"state": {query.Get("state")}, "code": {"nonce_code"}})
+		assertFailure(t, location, auth.ErrorProfileFailed, "abc")
+	})
+
+	t.Run("Link Failed", func(t *testing.T) {
+		_, location := callback(t, router, "fake", url.Values{"state": {start("fake", "unlinkable")}, "code": {"unlinkable"}})
+		assertFailure(t, location, auth.ErrorLinkFailed, "abc")
+	})
+}
+
+func TestHandleCallbackExpiredState(t *testing.T) {
+	router, fake, _ := setupHandler(t, 10*time.Millisecond)
+
+	authURL := login(t, router, "fake", url.Values{"client_state": {"abc"}})
+	fake.authorize("code", authURL)
+	time.Sleep(20 * time.Millisecond)
+
+	_, location := callback(t, router, "fake", url.Values{"state": {authURL.Query().Get("state")}, "code": {"code"}})
+	assertFailure(t, location, auth.ErrorInvalidState, "abc")
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/access_token"
+	"garrettpfoy/orbit-api/internal/repositories/user"
+	"garrettpfoy/orbit-api/internal/services/oauth2"
+
+	xoauth2 "golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// SpotifyUserLinker links Spotify identities to users by their Spotify ID, and stores the
+// Spotify token of the user so Orbit can act on their behalf while they host a session.
+type SpotifyUserLinker struct {
+	users  user.UserRepository
+	tokens access_token.AccessTokenRepository
+}
+
+func NewSpotifyUserLinker(users user.UserRepository, tokens access_token.AccessTokenRepository) *SpotifyUserLinker {
+	return &SpotifyUserLinker{users: users, tokens: tokens}
+}
+
+// LinkUser finds the user with the Spotify ID of the profile, creating them if they have never
+// signed in before, and stores the Spotify token.
+func (l *SpotifyUserLinker) LinkUser(_ context.Context, profile *oauth2.Profile, token *xoauth2.Token) (*models.User, error) {
+	user, err := l.users.GetUserBySpotifyID(profile.Subject)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		spotifyID := profile.Subject
+		user = &models.User{
+			Username:      profile.DisplayName,
+			SpotifyUserID: &spotifyID,
+		}
+		if err := l.users.CreateUser(user); err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if err := l.storeAccessToken(user, token); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// storeAccessToken persists the given Spotify token for the user, replacing the token stored
+// from a previous sign in if there is one. The token is encrypted by the models package.
+func (l *SpotifyUserLinker) storeAccessToken(user *models.User, token *xoauth2.Token) error {
+	accessToken, err := l.tokens.GetAccessTokenByUserID(user.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		accessToken = &models.AccessToken{
+			UserID:       user.ID,
+			AccessToken:  token.AccessToken,
+			RefreshToken: token.RefreshToken,
+			ExpiryTime:   token.Expiry,
+		}
+		if err := l.tokens.CreateAccessToken(accessToken); err != nil {
+			return fmt.Errorf("failed to create access token: %w", err)
+		}
+
+		// The access token is linked by ID only, the association on the user would otherwise be saved again
+		user.AccessTokenID = &accessToken.ID
+		user.AccessToken = nil
+		if err := l.users.UpdateUser(user); err != nil {
+			return fmt.Errorf("failed to link access token to user: %w", err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to find access token: %w", err)
+	}
+
+	accessToken.AccessToken = token.AccessToken
+	// Spotify does not always issue a new refresh token, in which case the stored one remains valid
+	if token.RefreshToken != "" {
+		accessToken.RefreshToken = token.RefreshToken
+	}
+	accessToken.ExpiryTime = token.Expiry
+
+	if err := l.tokens.UpdateAccessToken(accessToken); err != nil {
+		return fmt.Errorf("failed to update access token: %w", err)
+	}
+	return nil
+}
+
+// EmailUserLinker links identities to users by their verified email address. It is used for
+// Google sign in, where users may vote but cannot host as they have no Spotify token.
+type EmailUserLinker struct {
+	users user.UserRepository
+}
+
+func NewEmailUserLinker(users user.UserRepository) *EmailUserLinker {
+	return &EmailUserLinker{users: users}
+}
+
+// LinkUser finds the user with the verified email address of the profile, creating them
+// if they have never signed in before.
+func (l *EmailUserLinker) LinkUser(_ context.Context, profile *oauth2.Profile, _ *xoauth2.Token) (*models.User, error) {
+	if profile.Email == "" || !profile.EmailVerified {
+		return nil, fmt.Errorf("account does not have a verified email address")
+	}
+
+	user, err := l.users.GetUserByEmail(profile.Email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		email := profile.Email
+		user = &models.User{
+			Username: profile.DisplayName,
+			Email:    &email,
+		}
+		if err := l.users.CreateUser(user); err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	return user, nil
+}
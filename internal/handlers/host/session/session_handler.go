@@ -0,0 +1,150 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/environment"
+	sessionRepository "garrettpfoy/orbit-api/internal/repositories/session"
+	jwt "garrettpfoy/orbit-api/internal/services/jwt"
+	"garrettpfoy/orbit-api/internal/services/qr"
+	"image"
+	"image/png"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// This package serves the endpoints hosts use to run their session. Hosts print the join QR code of their session on
+// table cards, so guests can join by scanning it instead of typing the link, and change the settings of their session
+// as the party goes on.
+
+// SessionHandler serves the endpoints of the sessions in its repository.
+type SessionHandler struct {
+	env      *environment.OrbitEnvironment
+	sessions sessionRepository.SessionRepository
+	logo     image.Image
+}
+
+func NewSessionHandler(env *environment.OrbitEnvironment, sessions sessionRepository.SessionRepository) *SessionHandler {
+	return &SessionHandler{env: env, sessions: sessions}
+}
+
+// WithLogo makes the handler draw the given logo over the QR codes that ask for one
+func (h *SessionHandler) WithLogo(logo image.Image) *SessionHandler {
+	h.logo = logo
+	return h
+}
+
+// LoadLogo reads the PNG logo QR codes are drawn with.
+func LoadLogo(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	logo, err := png.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding logo: %w", err)
+	}
+	return logo, nil
+}
+
+// Routes returns a router serving the endpoints of a session by its slug, e.g. /{slug}/qr. The settings endpoints
+// require the JWT of the host of the session.
+func (h *SessionHandler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/{slug}/qr", h.handleQR)
+	r.Group(func(r chi.Router) {
+		r.Use(jwt.RequireJWT(h.env.JWT_KEY, []byte(h.env.JWT_SECRET)))
+		r.Get("/{slug}/settings", h.handleGetSettings)
+		r.Patch("/{slug}/settings", h.handlePatchSettings)
+	})
+	return r
+}
+
+// handleQR renders a QR code of the public join URL of a session.
+//
+// Query parameters:
+// - format: The image format, either png (default) or svg.
+// - size: The width and height of the image in pixels, between qr.MinSize and qr.MaxSize.
+// - level: The error correction level, one of L, M (default), Q and H.
+// - logo: Whether to draw the configured logo over the center of the code.
+//
+// Parameters:
+// - w: The http.ResponseWriter used to write the image back to the client.
+// - r: The http.Request representing the incoming request.
+//
+// Returns: None
+func (h *SessionHandler) handleQR(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	options := qr.Options{Level: query.Get("level")}
+	if size := query.Get("size"); size != "" {
+		parsed, err := strconv.Atoi(size)
+		if err != nil {
+			http.Error(w, "size must be a number of pixels", http.StatusBadRequest)
+			return
+		}
+		options.Size = parsed
+	}
+	if query.Get("logo") == "true" {
+		if h.logo == nil {
+			http.Error(w, "no logo is configured", http.StatusBadRequest)
+			return
+		}
+		options.Logo = h.logo
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "svg" {
+		http.Error(w, "format must be either png or svg", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.sessions.GetSessionBySlug(chi.URLParam(r, "slug"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, sessionRepository.ErrSessionEnded) {
+		http.Error(w, "session has ended", http.StatusGone)
+		return
+	}
+	if err != nil {
+		fmt.Println("Failed to load session: ", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	joinURL, err := qr.JoinURL(h.env.JOIN_BASE_URL, session.Slug)
+	if err != nil {
+		fmt.Println("Failed to build join URL: ", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var code []byte
+	if format == "svg" {
+		code, err = qr.SVG(joinURL, options)
+		w.Header().Set("Content-Type", "image/svg+xml")
+	} else {
+		code, err = qr.PNG(joinURL, options)
+		w.Header().Set("Content-Type", "image/png")
+	}
+	if err != nil {
+		w.Header().Del("Content-Type")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The slug of a session never changes, so its code can be cached for as long as the session lasts
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(code)
+}
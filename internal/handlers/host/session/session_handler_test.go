@@ -0,0 +1,108 @@
+package session_test
+
+import (
+	"bytes"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/environment"
+	"garrettpfoy/orbit-api/internal/handlers/host/session"
+	"garrettpfoy/orbit-api/internal/models"
+	sessionRepository "garrettpfoy/orbit-api/internal/repositories/session"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection to an in-memory database opens a new, empty database
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	err = db.AutoMigrate(&models.Session{}, &models.User{})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// setupHandler creates a router serving the session endpoints, a host and their open session.
+func setupHandler(t *testing.T) (chi.Router, *gorm.DB, *environment.OrbitEnvironment, *models.Session) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	host := &models.User{Username: "host"}
+	assert.NoError(t, db.Create(host).Error)
+	hosted := &models.Session{Slug: "rooftop", HostID: host.ID}
+	assert.NoError(t, db.Create(hosted).Error)
+
+	env := &environment.OrbitEnvironment{JWT_KEY: "orbit_jwt", JWT_SECRET: "secret", JOIN_BASE_URL: "https://orbit.example/join"}
+	handler := session.NewSessionHandler(env, sessionRepository.NewGormSessionRepository(db))
+	return handler.Routes(), db, env, hosted
+}
+
+func TestHandleQR(t *testing.T) {
+	router, _, _, hosted := setupHandler(t)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/%s/qr?size=128", hosted.Slug), nil))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "image/png", response.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=3600", response.Header().Get("Cache-Control"))
+
+	code, err := png.Decode(bytes.NewReader(response.Body.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, 128, code.Bounds().Dx())
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/%s/qr?format=svg", hosted.Slug), nil))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "image/svg+xml", response.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(response.Body.String(), "<"), response.Body.String())
+}
+
+func TestHandleQRErrors(t *testing.T) {
+	router, db, _, hosted := setupHandler(t)
+
+	tests := []struct {
+		name     string
+		url      string
+		expected int
+	}{
+		{name: "Unknown Format", url: "/rooftop/qr?format=gif", expected: http.StatusBadRequest},
+		{name: "Size Not A Number", url: "/rooftop/qr?size=big", expected: http.StatusBadRequest},
+		{name: "Size Too Small", url: "/rooftop/qr?size=8", expected: http.StatusBadRequest},
+		{name: "No Logo Configured", url: "/rooftop/qr?logo=true", expected: http.StatusBadRequest},
+		{name: "Unknown Session", url: "/basement/qr", expected: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			assert.Equal(t, tt.expected, response.Code)
+		})
+	}
+
+	// The code of an ended session is gone for good
+	_, err := sessionRepository.NewGormSessionRepository(db).TransitionSession(hosted.ID, models.SessionStatusEnded, time.Now())
+	assert.NoError(t, err)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/rooftop/qr", nil))
+	assert.Equal(t, http.StatusGone, response.Code)
+}
@@ -0,0 +1,125 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	sessionRepository "garrettpfoy/orbit-api/internal/repositories/session"
+	jwt "garrettpfoy/orbit-api/internal/services/jwt"
+	"garrettpfoy/orbit-api/internal/services/settings"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// maxSettingsPatchSize is the largest settings patch accepted, far more than a patch of every setting needs
+const maxSettingsPatchSize = 64 << 10
+
+// handleGetSettings returns the settings document of a session to its host.
+//
+// Parameters:
+// - w: The http.ResponseWriter used to write the settings back to the client.
+// - r: The http.Request representing the incoming request, authenticated by jwt.RequireJWT.
+//
+// Returns: None
+func (h *SessionHandler) handleGetSettings(w http.ResponseWriter, r *http.Request) {
+	session, ok := h.hostedSession(w, r)
+	if !ok {
+		return
+	}
+	writeSettings(w, session.Settings)
+}
+
+// handlePatchSettings applies a JSON merge patch to the settings of a session and returns the patched settings document.
+// Only the settings in the patch change, and a setting set to null is reset to its default.
+//
+// Parameters:
+// - w: The http.ResponseWriter used to write the patched settings back to the client.
+// - r: The http.Request carrying the patch as application/merge-patch+json, authenticated by jwt.RequireJWT.
+//
+// Returns: None
+func (h *SessionHandler) handlePatchSettings(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+		http.Error(w, "settings patches must be application/merge-patch+json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	session, ok := h.hostedSession(w, r)
+	if !ok {
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSettingsPatchSize))
+	if err != nil {
+		http.Error(w, "settings patch is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// The patch is applied to the settings as they are when the session is locked, not as they were loaded above, so
+	// a concurrent patch is not overwritten
+	var patchErr error
+	patched, err := h.sessions.PatchSessionSettings(session.ID, func(current models.SessionSettings) (models.SessionSettings, error) {
+		patched, err := settings.Patch(current, patch)
+		patchErr = err
+		return patched, err
+	})
+	if patchErr != nil {
+		http.Error(w, patchErr.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, sessionRepository.ErrSessionEnded) {
+		http.Error(w, "session has ended", http.StatusGone)
+		return
+	}
+	if err != nil {
+		fmt.Println("Failed to update session settings: ", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	writeSettings(w, patched)
+}
+
+// hostedSession loads the session in the URL, which must not have ended, and checks that the authenticated user hosts
+// it. It writes the error response itself, and returns false if the request should not be handled any further.
+func (h *SessionHandler) hostedSession(w http.ResponseWriter, r *http.Request) (*models.Session, bool) {
+	userID, ok := jwt.UserID(r.Context())
+	if !ok {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	session, err := h.sessions.GetSessionBySlug(chi.URLParam(r, "slug"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return nil, false
+	}
+	if errors.Is(err, sessionRepository.ErrSessionEnded) {
+		http.Error(w, "session has ended", http.StatusGone)
+		return nil, false
+	}
+	if err != nil {
+		fmt.Println("Failed to load session: ", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if session.HostID != userID {
+		http.Error(w, "only the host of the session can manage its settings", http.StatusForbidden)
+		return nil, false
+	}
+	return session, true
+}
+
+// writeSettings writes a settings document as the JSON response.
+func writeSettings(w http.ResponseWriter, sessionSettings models.SessionSettings) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(sessionSettings); err != nil {
+		fmt.Println("Failed to write session settings: ", err)
+	}
+}
@@ -0,0 +1,124 @@
+package session_test
+
+import (
+	"encoding/json"
+	"garrettpfoy/orbit-api/internal/environment"
+	"garrettpfoy/orbit-api/internal/models"
+	sessionRepository "garrettpfoy/orbit-api/internal/repositories/session"
+	jwt "garrettpfoy/orbit-api/internal/services/jwt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// settingsRequest builds a request to the settings of the rooftop session, authenticated as the given user.
+func settingsRequest(t *testing.T, env *environment.OrbitEnvironment, method string, userID uint, contentType, body string) *http.Request {
+	request := httptest.NewRequest(method, "/rooftop/settings", strings.NewReader(body))
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	token, err := jwt.CreateJWT(strconv.FormatUint(uint64(userID), 10), time.Hour, []byte(env.JWT_SECRET))
+	assert.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer "+token)
+	return request
+}
+
+// serve serves a request and decodes the settings document it returned, if any.
+func serve(router chi.Router, request *http.Request) (*httptest.ResponseRecorder, models.SessionSettings) {
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	var settings models.SessionSettings
+	if response.Code == http.StatusOK {
+		json.Unmarshal(response.Body.Bytes(), &settings)
+	}
+	return response, settings
+}
+
+func TestHandleGetSettings(t *testing.T) {
+	router, _, env, hosted := setupHandler(t)
+
+	response, settings := serve(router, settingsRequest(t, env, http.MethodGet, hosted.HostID, "", ""))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/json", response.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", response.Header().Get("Cache-Control"))
+	assert.Equal(t, models.DefaultSessionSettings(), settings)
+
+	// Requests without a JWT are turned away
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/rooftop/settings", nil))
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+}
+
+func TestHandlePatchSettings(t *testing.T) {
+	router, db, env, hosted := setupHandler(t)
+
+	response, settings := serve(router, settingsRequest(t, env, http.MethodPatch, hosted.HostID, "application/merge-patch+json",
+		`{"vote_budget": 10, "explicit_filter": true}`))
+	assert.Equal(t, http.StatusOK, response.Code)
+	expected := models.DefaultSessionSettings()
+	expected.VoteBudget = 10
+	expected.ExplicitFilter = true
+	assert.Equal(t, expected, settings)
+
+	// Only the settings in the patch change, and null resets a setting to its default
+	response, settings = serve(router, settingsRequest(t, env, http.MethodPatch, hosted.HostID, "application/merge-patch+json",
+		`{"vote_budget": null, "skip_threshold": 0.25}`))
+	assert.Equal(t, http.StatusOK, response.Code)
+	expected.VoteBudget = models.DefaultVoteBudget
+	expected.SkipThreshold = 0.25
+	assert.Equal(t, expected, settings)
+
+	var stored models.Session
+	assert.NoError(t, db.First(&stored, hosted.ID).Error)
+	assert.Equal(t, expected, stored.Settings)
+}
+
+func TestHandlePatchSettingsErrors(t *testing.T) {
+	router, db, env, hosted := setupHandler(t)
+
+	guest := &models.User{Username: "guest"}
+	assert.NoError(t, db.Create(guest).Error)
+
+	tests := []struct {
+		name        string
+		userID      uint
+		contentType string
+		body        string
+		expected    int
+	}{
+		{name: "Unknown Setting", userID: hosted.HostID, contentType: "application/merge-patch+json", body: `{"volume": 11}`, expected: http.StatusBadRequest},
+		{name: "Invalid Setting", userID: hosted.HostID, contentType: "application/merge-patch+json", body: `{"skip_threshold": 2}`, expected: http.StatusBadRequest},
+		{name: "Not An Object", userID: hosted.HostID, contentType: "application/merge-patch+json", body: `[]`, expected: http.StatusBadRequest},
+		{name: "Wrong Content Type", userID: hosted.HostID, contentType: "text/plain", body: `{"vote_budget": 10}`, expected: http.StatusUnsupportedMediaType},
+		{name: "No Content Type", userID: hosted.HostID, body: `{"vote_budget": 10}`, expected: http.StatusUnsupportedMediaType},
+		{name: "Not The Host", userID: guest.ID, contentType: "application/merge-patch+json", body: `{"vote_budget": 10}`, expected: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, _ := serve(router, settingsRequest(t, env, http.MethodPatch, tt.userID, tt.contentType, tt.body))
+			assert.Equal(t, tt.expected, response.Code)
+		})
+	}
+
+	// None of the rejected patches changed the settings
+	var stored models.Session
+	assert.NoError(t, db.First(&stored, hosted.ID).Error)
+	assert.Equal(t, models.DefaultSessionSettings(), stored.Settings)
+
+	// The settings of an ended session can not be read or changed anymore
+	_, err := sessionRepository.NewGormSessionRepository(db).TransitionSession(hosted.ID, models.SessionStatusEnded, time.Now())
+	assert.NoError(t, err)
+	response, _ := serve(router, settingsRequest(t, env, http.MethodPatch, hosted.HostID, "application/merge-patch+json", `{"vote_budget": 10}`))
+	assert.Equal(t, http.StatusGone, response.Code)
+	response, _ = serve(router, settingsRequest(t, env, http.MethodGet, hosted.HostID, "", ""))
+	assert.Equal(t, http.StatusGone, response.Code)
+}
@@ -0,0 +1,45 @@
+package models
+
+import "gorm.io/gorm"
+
+const (
+	// ModerationPin is the action of pinning a queue item to play next.
+	ModerationPin = "pin"
+	// ModerationUnpin is the action of returning a pinned queue item to the crowd's order.
+	ModerationUnpin = "unpin"
+	// ModerationMove is the action of moving a queue item to another position.
+	ModerationMove = "move"
+	// ModerationRemove is the action of removing a queue item before it played.
+	ModerationRemove = "remove"
+	// ModerationLock is the action of locking the queue against new items.
+	ModerationLock = "lock"
+	// ModerationUnlock is the action of unlocking the queue.
+	ModerationUnlock = "unlock"
+	// ModerationFreeze is the action of freezing voting.
+	ModerationFreeze = "freeze"
+	// ModerationUnfreeze is the action of unfreezing voting.
+	ModerationUnfreeze = "unfreeze"
+)
+
+// ModerationAction represents the moderation_actions table, the audit log of what hosts did to their session's queue
+type ModerationAction struct {
+	gorm.Model
+	// Session ID represents the session that was moderated, which is a foreign key to the sessions table.
+	SessionID uint `gorm:"not null;index"`
+	// Session represents the session that was moderated, derived from the SessionID.
+	Session Session
+	// Actor ID represents the user that took the action, which is a foreign key to the users table.
+	ActorID uint `gorm:"not null"`
+	// Actor represents the user that took the action, derived from the ActorID.
+	Actor User `gorm:"foreignKey:ActorID"`
+	// Action is what was done, e.g. pin, move or remove.
+	Action string `gorm:"not null"`
+	// Queue ID represents the queue item the action was taken on, nil for actions on the whole session.
+	QueueID *uint
+	// Queue represents the queue item the action was taken on, derived from the QueueID.
+	Queue *Queue
+	// Position is the position a queue item was moved to, zero for other actions.
+	Position int
+	// Reason is the reason the host gave for the action, if any.
+	Reason string
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OAuthState represents the oauth_states table, which holds the state of logins in progress so
+// the callback can be served by any replica of the API.
+type OAuthState struct {
+	gorm.Model
+	// State is the random state string sent to the provider, which identifies the login.
+	State string `gorm:"uniqueIndex;not null"`
+	// Provider is the name of the provider the user is signing in with.
+	Provider string `gorm:"not null"`
+	// RedirectURL is the URL the user is redirected to once authenticated.
+	RedirectURL string
+	// ClientState is the opaque state the client asked to be handed back.
+	ClientState string
+	// Native is whether the login was started by a native app.
+	Native bool
+	// Nonce is the encrypted OpenID Connect nonce of the login, if the provider uses one.
+	Nonce string
+	// CodeVerifier is the encrypted PKCE code verifier of the login, if the provider uses PKCE.
+	CodeVerifier string
+	// ExpiresAt is the time after which the login can no longer be completed.
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+func (state *OAuthState) BeforeSave(tx *gorm.DB) (err error) {
+	if state.Nonce != "" {
+		state.Nonce, err = encryptionService.Encrypt(state.Nonce)
+		if err != nil {
+			return err
+		}
+	}
+	if state.CodeVerifier != "" {
+		state.CodeVerifier, err = encryptionService.Encrypt(state.CodeVerifier)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (state *OAuthState) AfterFind(tx *gorm.DB) (err error) {
+	if state.Nonce != "" {
+		state.Nonce, err = encryptionService.Decrypt(state.Nonce)
+		if err != nil {
+			return err
+		}
+	}
+	if state.CodeVerifier != "" {
+		state.CodeVerifier, err = encryptionService.Decrypt(state.CodeVerifier)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
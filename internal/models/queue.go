@@ -1,20 +1,60 @@
-package models
-
-import "gorm.io/gorm"
-
-// Queue represents the queue table
-type Queue struct {
-	gorm.Model
-	// Track URI is derived from the Spotify API and is used to play the track.
-	TrackURI string `gorm:"not null"`
-	// Session ID represents the session that the queue item belongs to, which is a foreign key to the sessions table.
-	SessionID uint `gorm:"not null"`
-	// Session represents the session that the queue item belongs to, derived from the SessionID.
-	Session Session
-	// User ID represents the user that added the queue item, which is a foreign key to the users table.
-	UserID uint `gorm:"not null"`
-	// User represents the user that added the queue item, derived from the UserID.
-	User User
-	// Weight represents the upvote/downvote sum (upvotes - downvotes) for the queue item.
-	Weight int `gorm:"default:0;not null"`
-}
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// QueueStatusQueued is the status of a queue item waiting to be played.
+	QueueStatusQueued = "queued"
+	// QueueStatusNowPlaying is the status of the queue item that is currently playing, a session has at most one.
+	QueueStatusNowPlaying = "now_playing"
+	// QueueStatusPlayed is the status of a queue item that was played to the end.
+	QueueStatusPlayed = "played"
+	// QueueStatusSkipped is the status of a queue item that was skipped while it was playing.
+	QueueStatusSkipped = "skipped"
+	// QueueStatusRemoved is the status of a queue item that was taken off the queue before it was played.
+	QueueStatusRemoved = "removed"
+)
+
+// Queue represents the queue table
+type Queue struct {
+	gorm.Model
+	// Track URI is derived from the Spotify API and is used to play the track.
+	// A track can only be active (queued or now playing) once per session.
+	TrackURI string `gorm:"not null;uniqueIndex:idx_queues_active_track,priority:2"`
+	// Track represents the cached Spotify metadata of the track, derived from the TrackURI. It is nil if the metadata has not been resolved.
+	Track *Track `gorm:"foreignKey:TrackURI;references:URI;constraint:-"`
+	// Session ID represents the session that the queue item belongs to, which is a foreign key to the sessions table.
+	SessionID uint `gorm:"not null;uniqueIndex:idx_queues_active_track,priority:1,where:(status = 'queued' OR status = 'now_playing') AND deleted_at IS NULL"`
+	// Session represents the session that the queue item belongs to, derived from the SessionID.
+	Session Session
+	// User ID represents the user that added the queue item, which is a foreign key to the users table.
+	UserID uint `gorm:"not null"`
+	// User represents the user that added the queue item, derived from the UserID.
+	User User
+	// Weight represents the upvote/downvote sum (upvotes - downvotes) for the queue item. It is derived from the votes table
+	// and only ever written by the vote repository.
+	Weight int `gorm:"default:0;not null"`
+	// Votes represents the active votes on the queue item. They are only loaded when the queue is ordered by decay, which
+	// scores every vote by its age.
+	Votes []Vote
+	// WeightReachedAt is the last time the weight changed, and ranks queue items of equal weight by which reached it first.
+	// It is nil until the weight first changes, in which case the creation time is used instead.
+	WeightReachedAt *time.Time
+	// Status is where the queue item is in its lifecycle: queued, now_playing, played, skipped or removed.
+	Status string `gorm:"default:queued;not null;index"`
+	// StartedAt is when the queue item started playing, nil if it never played.
+	StartedAt *time.Time
+	// EndedAt is when the queue item was played, skipped or removed, nil while it is queued or playing.
+	EndedAt *time.Time
+	// PinRank places the queue item ahead of the rest of the queue, the host's manual order overriding the crowd. Pinned items
+	// play in ascending rank before any unpinned item, zero means the item is not pinned.
+	PinRank int `gorm:"default:0;not null"`
+	// RemovalReason is why the host removed the queue item, shown to the user that added it.
+	RemovalReason string
+	// Position is the 1-based position the queue item will play at in its session's queue, and is not stored.
+	Position int `gorm:"-"`
+}
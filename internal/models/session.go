@@ -1,18 +1,69 @@
-package models
-
-import (
-	"gorm.io/gorm"
-)
-
-// Session represents the sessions table
-type Session struct {
-	gorm.Model
-	// Session Slug is the unique identifier for a session, used in the URL to share with others.
-	Slug string `gorm:"unique;not null"`
-	// Host ID represents the user that created the session, which is a foreign key to the users table.
-	HostID uint `gorm:"not null"`
-	// Host represents the user that created the session, derived from the HostID.
-	Host User `gorm:"foreignKey:HostID"`
-	// Users represents the many-to-many relationship between users and sessions that are not hosts (signed in users).
-	Users []*User `gorm:"many2many:session_users"`
-}
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// JoinCodeLength is the number of digits in the join code of a session.
+const JoinCodeLength = 6
+
+const (
+	// SessionStatusOpen is the status of a session guests can join, add to and vote in.
+	SessionStatusOpen = "open"
+	// SessionStatusPaused is the status of a session whose host paused it, no new tracks are started until it is resumed.
+	SessionStatusPaused = "paused"
+	// SessionStatusEnded is the status of a session that is over, either ended by its host or after being idle for too long.
+	SessionStatusEnded = "ended"
+)
+
+// Session represents the sessions table
+type Session struct {
+	gorm.Model
+	// Session Slug is the unique identifier for a session, used in the URL to share with others.
+	Slug string `gorm:"unique;not null"`
+	// JoinCode is a short numeric code guests can type to join the session where a link is impractical, e.g. on a TV remote.
+	JoinCode *string `gorm:"uniqueIndex"`
+	// Host ID represents the user that created the session, which is a foreign key to the users table.
+	HostID uint `gorm:"not null"`
+	// Host represents the user that created the session, derived from the HostID.
+	Host User `gorm:"foreignKey:HostID"`
+	// Users represents the many-to-many relationship between users and sessions that are not hosts (signed in users).
+	Users []*User `gorm:"many2many:session_users"`
+	// Status is where the session is in its lifecycle: open, paused or ended. An ended session can not be reopened.
+	Status string `gorm:"default:open;not null;index"`
+	// StartedAt is when the session was created.
+	StartedAt *time.Time
+	// EndedAt is when the session ended, nil until it does.
+	EndedAt *time.Time
+	// LastActivityAt is the last time a track started playing or a vote was cast in the session, nil until either happens.
+	LastActivityAt *time.Time
+	// QueueLocked is set by the host to stop new items from being added to the queue.
+	QueueLocked bool `gorm:"default:false;not null"`
+	// VotingFrozen is set by the host to stop votes and skip votes from being cast, changed or retracted.
+	VotingFrozen bool `gorm:"default:false;not null"`
+	// Settings represents the settings the host chose for the session, stored as a JSON document in the settings column.
+	Settings SessionSettings `gorm:"type:text"`
+}
+
+// BeforeCreate gives a session created without settings the default settings, and stamps the settings document with
+// the current version.
+func (session *Session) BeforeCreate(tx *gorm.DB) (err error) {
+	if session.Settings == (SessionSettings{}) {
+		session.Settings = DefaultSessionSettings()
+	}
+	if session.Settings.Version == 0 {
+		session.Settings.Version = SessionSettingsVersion
+	}
+	return nil
+}
+
+// AfterFind gives a session without a settings document, e.g. one created before settings were stored as a
+// document or loaded without its settings column, the default settings.
+func (session *Session) AfterFind(tx *gorm.DB) (err error) {
+	if session.Settings.Version == 0 {
+		session.Settings = DefaultSessionSettings()
+	}
+	return nil
+}
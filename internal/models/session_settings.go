@@ -0,0 +1,132 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// DefaultVoteCooldownSeconds is the default time a user has to wait between two votes.
+	DefaultVoteCooldownSeconds = 2
+	// DefaultVoteBudget is the default number of vote actions a user may take within the vote window.
+	DefaultVoteBudget = 30
+	// DefaultVoteWindowSeconds is the default length of the sliding window the vote budget applies to.
+	DefaultVoteWindowSeconds = 300
+	// DefaultQueueOrder is the default strategy the queue is ordered by.
+	DefaultQueueOrder = "weight"
+	// DefaultDuplicatePolicy is the default way a track that is already in the queue is handled.
+	DefaultDuplicatePolicy = DuplicatePolicyMerge
+	// DefaultDuplicateCooldownMinutes is the default time after a track last played before it can be queued again.
+	DefaultDuplicateCooldownMinutes = 60
+	// DefaultMaxActiveItems is the default number of items a user may have in the queue at once.
+	DefaultMaxActiveItems = 5
+	// DefaultMaxAddsPerHour is the default number of items a user may add to the queue within an hour.
+	DefaultMaxAddsPerHour = 15
+	// DefaultMaxQueuedMinutes is the default total duration of the items a user may have waiting in the queue.
+	DefaultMaxQueuedMinutes = 30
+	// DefaultSkipThreshold is the default fraction of the participants of a session that has to vote to skip a track.
+	DefaultSkipThreshold = 0.5
+	// DefaultVoteHalfLifeMinutes is the default time it takes a vote to lose half of its influence under the decay queue order.
+	DefaultVoteHalfLifeMinutes = 30
+	// DefaultIdleTimeoutMinutes is the default time a session can go without playback or votes before it is ended.
+	DefaultIdleTimeoutMinutes = 120
+)
+
+const (
+	// DuplicatePolicyReject rejects a track that was already queued in the session, unless it was removed before it played.
+	DuplicatePolicyReject = "reject"
+	// DuplicatePolicyMerge turns a track that is already queued into an upvote on the queued item by the new requester.
+	DuplicatePolicyMerge = "merge"
+	// DuplicatePolicyAllowAfter allows a track to be queued again once the duplicate cooldown has passed since it last played.
+	DuplicatePolicyAllowAfter = "allow_after"
+)
+
+// SessionSettingsVersion is the version of the settings document this build writes. It is bumped whenever a setting
+// is renamed or changes meaning, so older documents can be told apart and upgraded when they are read.
+const SessionSettingsVersion = 1
+
+// SessionSettings represents the settings a host chooses for their session, stored as a JSON document in the sessions table
+type SessionSettings struct {
+	// Version is the version of the settings document, see SessionSettingsVersion.
+	Version int `json:"version"`
+	// VoteCooldownSeconds is the time in seconds a user has to wait between two votes, zero disables the cooldown.
+	VoteCooldownSeconds int `json:"vote_cooldown_seconds"`
+	// VoteBudget is the number of vote actions (casting, changing or retracting a vote, or voting to skip) a user may take
+	// within the vote window, zero disables the budget.
+	VoteBudget int `json:"vote_budget"`
+	// VoteWindowSeconds is the length in seconds of the sliding window the vote budget applies to.
+	VoteWindowSeconds int `json:"vote_window_seconds"`
+	// QueueOrder is the name of the strategy the queue is ordered by, e.g. weight or fair_share.
+	QueueOrder string `json:"queue_order"`
+	// DuplicatePolicy is how a track that is already in the queue is handled: reject, merge or allow_after.
+	DuplicatePolicy string `json:"duplicate_policy"`
+	// DuplicateCooldownMinutes is the time in minutes after a track last played before it can be queued again
+	// under the allow_after policy.
+	DuplicateCooldownMinutes int `json:"duplicate_cooldown_minutes"`
+	// MaxActiveItems is the number of items a user may have queued or playing at once, zero disables the quota.
+	MaxActiveItems int `json:"max_active_items"`
+	// MaxAddsPerHour is the number of items a user may add within a rolling hour, zero disables the quota.
+	MaxAddsPerHour int `json:"max_adds_per_hour"`
+	// MaxQueuedMinutes is the total duration in minutes of the items a user may have waiting in the queue,
+	// zero disables the quota. Tracks whose metadata is unknown do not count towards it.
+	MaxQueuedMinutes int `json:"max_queued_minutes"`
+	// SkipThreshold is the fraction of the participants of the session that has to vote to skip the now playing track,
+	// between 0 and 1. Zero disables skip voting.
+	SkipThreshold float64 `json:"skip_threshold"`
+	// VoteHalfLifeMinutes is the time in minutes it takes a vote to lose half of its influence when the queue is ordered
+	// by decay.
+	VoteHalfLifeMinutes int `json:"vote_half_life_minutes"`
+	// IdleTimeoutMinutes is the time in minutes a session can go without playback or votes before it is ended
+	// automatically, zero keeps the session open until the host ends it.
+	IdleTimeoutMinutes int `json:"idle_timeout_minutes"`
+	// ExplicitFilter keeps tracks with explicit lyrics out of the queue. Tracks whose metadata is unknown are let through.
+	ExplicitFilter bool `json:"explicit_filter"`
+	// MaxTrackMinutes is the length in minutes of the longest track that can be queued, zero disables the limit.
+	MaxTrackMinutes int `json:"max_track_minutes"`
+}
+
+// DefaultSessionSettings returns the settings a session starts out with.
+func DefaultSessionSettings() SessionSettings {
+	return SessionSettings{
+		Version:                  SessionSettingsVersion,
+		VoteCooldownSeconds:      DefaultVoteCooldownSeconds,
+		VoteBudget:               DefaultVoteBudget,
+		VoteWindowSeconds:        DefaultVoteWindowSeconds,
+		QueueOrder:               DefaultQueueOrder,
+		DuplicatePolicy:          DefaultDuplicatePolicy,
+		DuplicateCooldownMinutes: DefaultDuplicateCooldownMinutes,
+		MaxActiveItems:           DefaultMaxActiveItems,
+		MaxAddsPerHour:           DefaultMaxAddsPerHour,
+		MaxQueuedMinutes:         DefaultMaxQueuedMinutes,
+		SkipThreshold:            DefaultSkipThreshold,
+		VoteHalfLifeMinutes:      DefaultVoteHalfLifeMinutes,
+		IdleTimeoutMinutes:       DefaultIdleTimeoutMinutes,
+	}
+}
+
+// Value stores the settings as a JSON document.
+func (settings SessionSettings) Value() (driver.Value, error) {
+	document, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	return string(document), nil
+}
+
+// Scan reads the settings from a JSON document. A NULL document leaves the settings empty.
+func (settings *SessionSettings) Scan(value interface{}) error {
+	var document []byte
+	switch value := value.(type) {
+	case nil:
+		*settings = SessionSettings{}
+		return nil
+	case []byte:
+		document = value
+	case string:
+		document = []byte(value)
+	default:
+		return fmt.Errorf("cannot scan %T into session settings", value)
+	}
+	return json.Unmarshal(document, settings)
+}
@@ -0,0 +1,16 @@
+package models
+
+import "gorm.io/gorm"
+
+// SkipVote represents the skip_votes table
+type SkipVote struct {
+	gorm.Model
+	// User ID represents the user that voted to skip, which is a foreign key to the users table. A user has at most one skip vote per queue item.
+	UserID uint `gorm:"not null;uniqueIndex:idx_skip_votes_user_queue"`
+	// User represents the user that voted to skip, derived from the UserID.
+	User User
+	// Queue ID represents the now playing queue item the user voted to skip, which is a foreign key to the queues table.
+	QueueID uint `gorm:"not null;uniqueIndex:idx_skip_votes_user_queue;index"`
+	// Queue represents the queue item the user voted to skip, derived from the QueueID.
+	Queue Queue
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Track represents the tracks table, a cache of the Spotify metadata of tracks that have been queued
+type Track struct {
+	// URI is the Spotify URI of the track, and is the primary key of the table since queue items reference tracks by it.
+	URI       string `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Name is the title of the track.
+	Name string `gorm:"not null"`
+	// Artists is the comma separated list of the names of the artists credited on the track.
+	Artists string
+	// Album is the name of the album the track appears on.
+	Album string
+	// ArtworkURL is the URL of the album artwork of the track, in the largest size Spotify provides.
+	ArtworkURL string
+	// DurationMs is the length of the track in milliseconds.
+	DurationMs int `gorm:"not null"`
+	// Explicit denotes whether the track has explicit lyrics.
+	Explicit bool
+	// FetchedAt is when the metadata was last fetched from Spotify, and is used to refresh stale metadata.
+	FetchedAt time.Time `gorm:"not null"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "gorm.io/gorm"
+
+const (
+	// VoteUp is the direction of a vote in favour of playing a queue item sooner.
+	VoteUp = 1
+	// VoteDown is the direction of a vote in favour of playing a queue item later.
+	VoteDown = -1
+)
+
+// Vote represents the votes table
+type Vote struct {
+	gorm.Model
+	// User ID represents the user that cast the vote, which is a foreign key to the users table. A user has at most one vote per queue item.
+	UserID uint `gorm:"not null;uniqueIndex:idx_votes_user_queue"`
+	// User represents the user that cast the vote, derived from the UserID.
+	User User
+	// Queue ID represents the queue item that was voted on, which is a foreign key to the queues table.
+	QueueID uint `gorm:"not null;uniqueIndex:idx_votes_user_queue;index"`
+	// Queue represents the queue item that was voted on, derived from the QueueID.
+	Queue Queue
+	// Direction is either VoteUp (1) or VoteDown (-1), and is summed to derive the weight of the queue item.
+	Direction int `gorm:"not null"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "gorm.io/gorm"
+
+const (
+	// VoteEventCast is the action of casting a vote on a queue item.
+	VoteEventCast = "cast"
+	// VoteEventChange is the action of changing the direction of a vote.
+	VoteEventChange = "change"
+	// VoteEventRetract is the action of retracting a vote.
+	VoteEventRetract = "retract"
+	// VoteEventSkip is the action of voting to skip the now playing queue item.
+	VoteEventSkip = "skip"
+	// VoteEventRetractSkip is the action of retracting a vote to skip.
+	VoteEventRetractSkip = "retract_skip"
+)
+
+// VoteEvent represents the vote_events table, the log of every vote action a user took in a session. The vote budget
+// of a session counts these events, so a vote that is changed or retracted counts once for every action.
+type VoteEvent struct {
+	gorm.Model
+	// User ID represents the user that took the action, which is a foreign key to the users table.
+	UserID uint `gorm:"not null;index:idx_vote_events_user_session"`
+	// User represents the user that took the action, derived from the UserID.
+	User User
+	// Session ID represents the session the action was taken in, which is a foreign key to the sessions table.
+	SessionID uint `gorm:"not null;index:idx_vote_events_user_session"`
+	// Session represents the session the action was taken in, derived from the SessionID.
+	Session Session
+	// Queue ID represents the queue item that was voted on, which is a foreign key to the queues table.
+	QueueID uint `gorm:"not null"`
+	// Queue represents the queue item that was voted on, derived from the QueueID.
+	Queue Queue
+	// Action is what the user did, e.g. cast, change or retract.
+	Action string `gorm:"not null"`
+}
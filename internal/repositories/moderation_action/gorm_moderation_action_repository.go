@@ -0,0 +1,31 @@
+package moderation_action
+
+import (
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/services/validation"
+
+	"gorm.io/gorm"
+)
+
+type GormModerationActionRepository struct {
+	db *gorm.DB
+}
+
+func NewGormModerationActionRepository(db *gorm.DB) *GormModerationActionRepository {
+	return &GormModerationActionRepository{db: db}
+}
+
+func (r *GormModerationActionRepository) CreateModerationAction(action *models.ModerationAction) error {
+	if err := validation.ValidateModerationAction(*action); err != nil {
+		return fmt.Errorf("error validating moderation action: %w", err)
+	}
+
+	return r.db.Omit("Session", "Actor", "Queue").Create(action).Error
+}
+
+func (r *GormModerationActionRepository) GetModerationActionsBySessionID(sessionID uint) ([]models.ModerationAction, error) {
+	var actions []models.ModerationAction
+	err := r.db.Where("session_id = ?", sessionID).Preload("Actor").Order("created_at DESC, id DESC").Find(&actions).Error
+	return actions, err
+}
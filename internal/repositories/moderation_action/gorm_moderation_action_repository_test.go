@@ -0,0 +1,65 @@
+package moderation_action_test
+
+import (
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/moderation_action"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AutoMigrate(&models.ModerationAction{}, &models.Queue{}, &models.Session{}, &models.User{}, &models.Track{})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func TestCreateModerationAction(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := moderation_action.NewGormModerationActionRepository(db)
+
+	queueID := uint(1)
+	action := &models.ModerationAction{SessionID: 1, ActorID: 1, Action: models.ModerationRemove, QueueID: &queueID, Reason: "not tonight"}
+	err = repo.CreateModerationAction(action)
+	assert.NoError(t, err)
+	assert.NotZero(t, action.ID)
+
+	err = repo.CreateModerationAction(&models.ModerationAction{SessionID: 1, ActorID: 1, Action: models.ModerationRemove})
+	assert.Error(t, err)
+}
+
+func TestGetModerationActionsBySessionID(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := moderation_action.NewGormModerationActionRepository(db)
+
+	host := &models.User{Username: "host"}
+	assert.NoError(t, db.Create(host).Error)
+
+	for _, action := range []string{models.ModerationLock, models.ModerationFreeze, models.ModerationUnlock} {
+		err = repo.CreateModerationAction(&models.ModerationAction{SessionID: 1, ActorID: host.ID, Action: action})
+		assert.NoError(t, err)
+	}
+	err = repo.CreateModerationAction(&models.ModerationAction{SessionID: 2, ActorID: host.ID, Action: models.ModerationLock})
+	assert.NoError(t, err)
+
+	actions, err := repo.GetModerationActionsBySessionID(1)
+	assert.NoError(t, err)
+	assert.Len(t, actions, 3)
+	assert.Equal(t, models.ModerationUnlock, actions[0].Action)
+	assert.Equal(t, models.ModerationLock, actions[2].Action)
+	assert.Equal(t, "host", actions[0].Actor.Username)
+}
@@ -0,0 +1,12 @@
+package moderation_action
+
+import (
+	"garrettpfoy/orbit-api/internal/models"
+)
+
+type ModerationActionRepository interface {
+	// CreateModerationAction validates and records a moderation action in the audit log
+	CreateModerationAction(action *models.ModerationAction) error
+	// GetModerationActionsBySessionID retrieves the audit log of a session, most recent first
+	GetModerationActionsBySessionID(sessionID uint) ([]models.ModerationAction, error)
+}
@@ -0,0 +1,55 @@
+package oauth_state
+
+import (
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/services/validation"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type GormOAuthStateRepository struct {
+	db *gorm.DB
+}
+
+func NewGormOAuthStateRepository(db *gorm.DB) *GormOAuthStateRepository {
+	return &GormOAuthStateRepository{db: db}
+}
+
+func (r *GormOAuthStateRepository) CreateState(state *models.OAuthState) error {
+	if err := validation.ValidateOAuthState(*state); err != nil {
+		return fmt.Errorf("error validating oauth state: %w", err)
+	}
+
+	return r.db.Create(state).Error
+}
+
+func (r *GormOAuthStateRepository) ConsumeState(state string, now time.Time) (*models.OAuthState, error) {
+	var oAuthState models.OAuthState
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state = ? AND expires_at > ?", state, now).First(&oAuthState).Error; err != nil {
+			return err
+		}
+
+		// Only the request that deletes the row may use the state, which prevents two replicas
+		// from completing the same login
+		result := tx.Unscoped().Delete(&models.OAuthState{}, oAuthState.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &oAuthState, nil
+}
+
+func (r *GormOAuthStateRepository) DeleteExpiredStates(now time.Time) (int64, error) {
+	result := r.db.Unscoped().Where("expires_at <= ?", now).Delete(&models.OAuthState{})
+	return result.RowsAffected, result.Error
+}
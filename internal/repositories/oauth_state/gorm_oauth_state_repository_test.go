@@ -0,0 +1,147 @@
+package oauth_state_test
+
+import (
+	"errors"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/oauth_state"
+	"garrettpfoy/orbit-api/internal/services/encryption"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	models.SetEncryptionService(encryption.NewEncryptionService("abcdefghijklmnopqrstuvwxyz123456"))
+
+	err = db.AutoMigrate(&models.OAuthState{})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func TestCreateState(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := oauth_state.NewGormOAuthStateRepository(db)
+
+	state := &models.OAuthState{
+		State:        "random_state",
+		Provider:     "spotify",
+		CodeVerifier: "code_verifier",
+		ExpiresAt:    time.Now().Add(time.Minute),
+	}
+
+	err = repo.CreateState(state)
+	assert.NoError(t, err)
+
+	var createdState models.OAuthState
+	err = db.First(&createdState, state.ID).Error
+	assert.NoError(t, err)
+	assert.Equal(t, "random_state", createdState.State)
+	assert.Equal(t, "code_verifier", createdState.CodeVerifier)
+
+	// The code verifier is encrypted at rest
+	var storedVerifier string
+	err = db.Raw("SELECT code_verifier FROM o_auth_states WHERE id = ?", state.ID).Scan(&storedVerifier).Error
+	assert.NoError(t, err)
+	assert.NotEqual(t, "code_verifier", storedVerifier)
+}
+
+func TestCreateInvalidState(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := oauth_state.NewGormOAuthStateRepository(db)
+
+	err = repo.CreateState(&models.OAuthState{Provider: "spotify", ExpiresAt: time.Now()})
+	assert.EqualError(t, err, "error validating oauth state: state is empty")
+}
+
+func TestConsumeState(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := oauth_state.NewGormOAuthStateRepository(db)
+
+	state := &models.OAuthState{
+		State:     "random_state",
+		Provider:  "google",
+		Nonce:     "nonce",
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+
+	err = repo.CreateState(state)
+	assert.NoError(t, err)
+
+	consumedState, err := repo.ConsumeState("random_state", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, "google", consumedState.Provider)
+	assert.Equal(t, "nonce", consumedState.Nonce)
+
+	// A state can only be consumed once
+	_, err = repo.ConsumeState("random_state", time.Now())
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func TestConsumeExpiredState(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := oauth_state.NewGormOAuthStateRepository(db)
+
+	state := &models.OAuthState{
+		State:     "random_state",
+		Provider:  "spotify",
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+
+	err = repo.CreateState(state)
+	assert.NoError(t, err)
+
+	_, err = repo.ConsumeState("random_state", time.Now().Add(2*time.Minute))
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func TestDeleteExpiredStates(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := oauth_state.NewGormOAuthStateRepository(db)
+
+	expiredState := &models.OAuthState{
+		State:     "expired_state",
+		Provider:  "spotify",
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	validState := &models.OAuthState{
+		State:     "valid_state",
+		Provider:  "spotify",
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+
+	err = repo.CreateState(expiredState)
+	assert.NoError(t, err)
+	err = repo.CreateState(validState)
+	assert.NoError(t, err)
+
+	deleted, err := repo.DeleteExpiredStates(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	var remaining []models.OAuthState
+	err = db.Unscoped().Find(&remaining).Error
+	assert.NoError(t, err)
+	assert.Len(t, remaining, 1)
+	assert.Equal(t, "valid_state", remaining[0].State)
+}
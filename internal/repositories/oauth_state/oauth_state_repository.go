@@ -0,0 +1,18 @@
+package oauth_state
+
+import (
+	"garrettpfoy/orbit-api/internal/models"
+	"time"
+)
+
+// Note: Nonce and code verifier encryption and decryption is handled in the models package
+// and is outside the scope of the repository interface implementation.
+
+type OAuthStateRepository interface {
+	// CreateState validates the state of a login and creates it in the database
+	CreateState(state *models.OAuthState) error
+	// ConsumeState retrieves the unexpired state with the given state string and deletes it, so it can only be used once
+	ConsumeState(state string, now time.Time) (*models.OAuthState, error)
+	// DeleteExpiredStates deletes all states that expired before the given time, returning how many were deleted
+	DeleteExpiredStates(now time.Time) (int64, error)
+}
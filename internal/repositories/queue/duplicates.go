@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrDuplicateTrack is matched by every DuplicateError, for callers that only need to know a track was refused as a duplicate
+var ErrDuplicateTrack = errors.New("track is already in the queue")
+
+// DuplicateError is returned when a track cannot be queued because of the duplicate policy of its session
+type DuplicateError struct {
+	// Policy is the duplicate policy of the session that refused the track
+	Policy string
+	// ExistingID is the ID of the queue item the track duplicates
+	ExistingID uint
+	// RetryAt is when the track can be queued again, nil if waiting does not help
+	RetryAt *time.Time
+	// Mergeable is true when the session merges duplicates and the requester can upvote the existing item instead
+	Mergeable bool
+}
+
+func (e *DuplicateError) Error() string {
+	if e.RetryAt != nil {
+		return fmt.Sprintf("track was played recently and can be queued again at %s", e.RetryAt.Format(time.RFC3339))
+	}
+	return ErrDuplicateTrack.Error()
+}
+
+func (e *DuplicateError) Is(target error) bool {
+	return target == ErrDuplicateTrack
+}
+
+// checkDuplicatePolicy checks a new queue item against the items already queued in its session. The session must be
+// locked by the caller, so two requests for the same track can not both pass the check.
+func checkDuplicatePolicy(tx *gorm.DB, settings models.SessionSettings, queueItem *models.Queue, now time.Time) error {
+	policy := settings.DuplicatePolicy
+	if policy == "" {
+		policy = models.DefaultDuplicatePolicy
+	}
+
+	var active models.Queue
+	result := tx.Where("session_id = ? AND track_uri = ? AND status IN ?", queueItem.SessionID, queueItem.TrackURI,
+		[]string{models.QueueStatusQueued, models.QueueStatusNowPlaying}).Limit(1).Find(&active)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		if policy == models.DuplicatePolicyMerge && active.Status == models.QueueStatusQueued {
+			return mergeableDuplicate(tx, &active, queueItem.UserID)
+		}
+		return &DuplicateError{Policy: policy, ExistingID: active.ID}
+	}
+
+	switch policy {
+	case models.DuplicatePolicyReject:
+		// A track that was removed before it played never really was in the queue, so it can be queued again
+		var previous models.Queue
+		result := tx.Where("session_id = ? AND track_uri = ? AND status IN ?", queueItem.SessionID, queueItem.TrackURI,
+			[]string{models.QueueStatusPlayed, models.QueueStatusSkipped}).Limit(1).Find(&previous)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return &DuplicateError{Policy: policy, ExistingID: previous.ID}
+		}
+	case models.DuplicatePolicyAllowAfter:
+		var last models.Queue
+		result := tx.Where("session_id = ? AND track_uri = ? AND status IN ?", queueItem.SessionID, queueItem.TrackURI,
+			[]string{models.QueueStatusPlayed, models.QueueStatusSkipped}).
+			Order("ended_at DESC").Limit(1).Find(&last)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 && last.EndedAt != nil {
+			retryAt := last.EndedAt.Add(time.Duration(settings.DuplicateCooldownMinutes) * time.Minute)
+			if now.Before(retryAt) {
+				return &DuplicateError{Policy: policy, ExistingID: last.ID, RetryAt: &retryAt}
+			}
+		}
+	}
+	return nil
+}
+
+// mergeableDuplicate refuses a request for a track that is already queued, marking it mergeable unless the requester
+// added the queued item or already voted on it, in which case they have nothing left to merge. Merging is left to the
+// caller, which upvotes the queued item through the voting policy of the session.
+func mergeableDuplicate(tx *gorm.DB, existing *models.Queue, userID uint) error {
+	refused := &DuplicateError{Policy: models.DuplicatePolicyMerge, ExistingID: existing.ID}
+	if existing.UserID == userID {
+		return refused
+	}
+
+	var voted int64
+	if err := tx.Model(&models.Vote{}).Where("user_id = ? AND queue_id = ?", userID, existing.ID).Count(&voted).Error; err != nil {
+		return err
+	}
+	refused.Mergeable = voted == 0
+	return refused
+}
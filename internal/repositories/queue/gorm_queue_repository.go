@@ -1,63 +1,333 @@
-package queue
-
-import (
-	"garrettpfoy/orbit-api/internal/models"
-
-	"gorm.io/gorm"
-)
-
-type GormQueueRepository struct {
-	db *gorm.DB
-}
-
-func NewGormQueueRepository(db *gorm.DB) *GormQueueRepository {
-	return &GormQueueRepository{db: db}
-}
-
-func (r *GormQueueRepository) CreateQueueItem(queueItem *models.Queue) error {
-	return r.db.Create(queueItem).Error
-}
-
-func (r *GormQueueRepository) GetQueueItemsBySessionID(sessionID uint, prioritize *bool) ([]models.Queue, error) {
-	var queueItems []models.Queue
-	query := r.db.Where("session_id = ?", sessionID).Preload("Session").Preload("User")
-	if prioritize != nil && *prioritize {
-		query = query.Order("weight DESC")
-	}
-	err := query.Find(&queueItems).Error
-	return queueItems, err
-}
-
-func (r *GormQueueRepository) GetQueueItemsByUserID(userID uint, prioritize *bool) ([]models.Queue, error) {
-	var queueItems []models.Queue
-	query := r.db.Where("user_id = ?", userID).Preload("Session").Preload("User")
-	if prioritize != nil && *prioritize {
-		query = query.Order("weight DESC")
-	}
-	err := query.Find(&queueItems).Error
-	return queueItems, err
-}
-
-func (r *GormQueueRepository) GetQueueItemsBySessionIDByUserID(sessionID, userID uint, prioritize *bool) ([]models.Queue, error) {
-	var queueItems []models.Queue
-	query := r.db.Where("session_id = ? AND user_id = ?", sessionID, userID).Preload("Session").Preload("User")
-	if prioritize != nil && *prioritize {
-		query = query.Order("weight DESC")
-	}
-	err := query.Find(&queueItems).Error
-	return queueItems, err
-}
-
-func (r *GormQueueRepository) GetQueueItem(id uint) (*models.Queue, error) {
-	var queueItem models.Queue
-	err := r.db.Preload("Session").Preload("User").First(&queueItem, id).Error
-	return &queueItem, err
-}
-
-func (r *GormQueueRepository) UpdateQueueItem(queueItem *models.Queue) error {
-	return r.db.Save(queueItem).Error
-}
-
-func (r *GormQueueRepository) DeleteQueueItem(id uint) error {
-	return r.db.Delete(&models.Queue{}, id).Error
-}
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	sessionRepository "garrettpfoy/orbit-api/internal/repositories/session"
+	"garrettpfoy/orbit-api/internal/services/ordering"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// rankOrder is the canonical ranking of queue items: the highest weight first, then the item that reached its weight
+// first, then the item that was queued first. The ID makes the order total, so it is the same on every request rather
+// than left to how the database breaks ties.
+const rankOrder = "weight DESC, COALESCE(weight_reached_at, created_at) ASC, id ASC"
+
+// arrivalOrder orders queue items by when they were queued.
+const arrivalOrder = "created_at ASC, id ASC"
+
+type GormQueueRepository struct {
+	db       *gorm.DB
+	resolver TrackResolver
+}
+
+func NewGormQueueRepository(db *gorm.DB) *GormQueueRepository {
+	return &GormQueueRepository{db: db}
+}
+
+// WithTrackResolver makes the repository resolve the metadata of every track that is queued
+func (r *GormQueueRepository) WithTrackResolver(resolver TrackResolver) *GormQueueRepository {
+	r.resolver = resolver
+	return r
+}
+
+func (r *GormQueueRepository) CreateQueueItem(queueItem *models.Queue) error {
+	// A new item starts out queued without votes, whatever the caller set. The weight is derived from votes, and the
+	// lifecycle, pins and removal reasons are only changed by the methods below and the host's moderation
+	queueItem.Weight = 0
+	queueItem.WeightReachedAt = nil
+	queueItem.Status = models.QueueStatusQueued
+	queueItem.StartedAt = nil
+	queueItem.EndedAt = nil
+	queueItem.PinRank = 0
+	queueItem.RemovalReason = ""
+
+	var track *models.Track
+	if r.resolver != nil {
+		var err error
+		if track, err = r.resolver.Resolve(context.Background(), queueItem.TrackURI); err != nil {
+			return fmt.Errorf("error resolving track: %w", err)
+		}
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Locking the session serializes adds, so the duplicate policy and quotas see every item queued before this one
+		var session models.Session
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, queueItem.SessionID).Error; err != nil {
+			return err
+		}
+
+		if session.Status == models.SessionStatusEnded {
+			return ErrSessionNotOpen
+		}
+		if session.QueueLocked {
+			return ErrQueueLocked
+		}
+
+		// Without a resolver the track rules and quotas go by the metadata cached when the track was last resolved
+		metadata := track
+		if metadata == nil {
+			var err error
+			if metadata, err = cachedTrack(tx, queueItem.TrackURI); err != nil {
+				return err
+			}
+		}
+		if err := checkTrackRules(session.Settings, metadata); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := checkDuplicatePolicy(tx, session.Settings, queueItem, now); err != nil {
+			return err
+		}
+		if err := checkQuotas(tx, session.Settings, queueItem, metadata, now); err != nil {
+			return err
+		}
+
+		err := tx.Omit("Track").Create(queueItem).Error
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return &DuplicateError{Policy: session.Settings.DuplicatePolicy}
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if track != nil {
+		queueItem.Track = track
+	}
+	return nil
+}
+
+func (r *GormQueueRepository) GetQueueItemsBySessionID(sessionID uint, prioritize *bool) ([]models.Queue, error) {
+	var queueItems []models.Queue
+	query := r.db.Where("session_id = ? AND status = ?", sessionID, models.QueueStatusQueued).Preload("Session").Preload("User").Preload("Track")
+	if prioritize != nil && *prioritize {
+		query = query.Order(rankOrder)
+	} else {
+		query = query.Order(arrivalOrder)
+	}
+	if err := query.Find(&queueItems).Error; err != nil {
+		return nil, err
+	}
+
+	// Positions are where the items will play, which the host's ordering strategy and pins decide whatever the listing order
+	ordered, err := orderedQueueItems(r.db, sessionID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	positions := make(map[uint]int, len(ordered))
+	for _, queueItem := range ordered {
+		positions[queueItem.ID] = queueItem.Position
+	}
+	for i := range queueItems {
+		queueItems[i].Position = positions[queueItems[i].ID]
+	}
+	return queueItems, nil
+}
+
+func (r *GormQueueRepository) GetOrderedQueueItems(sessionID uint) ([]models.Queue, error) {
+	return orderedQueueItems(r.db, sessionID, time.Now())
+}
+
+func (r *GormQueueRepository) GetQueueItemsByUserID(userID uint, prioritize *bool) ([]models.Queue, error) {
+	var queueItems []models.Queue
+	query := r.db.Where("user_id = ? AND status = ?", userID, models.QueueStatusQueued).Preload("Session").Preload("User").Preload("Track")
+	if prioritize != nil && *prioritize {
+		query = query.Order(rankOrder)
+	} else {
+		query = query.Order(arrivalOrder)
+	}
+	err := query.Find(&queueItems).Error
+	return queueItems, err
+}
+
+func (r *GormQueueRepository) GetQueueItemsBySessionIDByUserID(sessionID, userID uint, prioritize *bool) ([]models.Queue, error) {
+	var queueItems []models.Queue
+	query := r.db.Where("session_id = ? AND user_id = ? AND status = ?", sessionID, userID, models.QueueStatusQueued).Preload("Session").Preload("User").Preload("Track")
+	if prioritize != nil && *prioritize {
+		query = query.Order(rankOrder)
+	} else {
+		query = query.Order(arrivalOrder)
+	}
+	err := query.Find(&queueItems).Error
+	return queueItems, err
+}
+
+func (r *GormQueueRepository) GetQueueItem(id uint) (*models.Queue, error) {
+	var queueItem models.Queue
+	err := r.db.Preload("Session").Preload("User").Preload("Track").First(&queueItem, id).Error
+	return &queueItem, err
+}
+
+func (r *GormQueueRepository) UpdateQueueItem(queueItem *models.Queue) error {
+	// The weight is derived from votes, so it can only be changed by the vote repository, the lifecycle can only
+	// move forward through the methods below, and pins and removal reasons are left to the host's moderation
+	return r.db.Omit("Track", "Weight", "WeightReachedAt", "Status", "StartedAt", "EndedAt", "PinRank", "RemovalReason").Save(queueItem).Error
+}
+
+func (r *GormQueueRepository) PopNextQueueItem(sessionID uint, now time.Time) (*models.Queue, error) {
+	var next models.Queue
+	var empty bool
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Locking the session serializes pops, so two pops can never start the same item or two items at once
+		var session models.Session
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&session, sessionID).Error; err != nil {
+			return err
+		}
+		if session.Status == models.SessionStatusPaused || session.Status == models.SessionStatusEnded {
+			return ErrSessionNotOpen
+		}
+
+		if err := tx.Model(&models.Queue{}).
+			Where("session_id = ? AND status = ?", sessionID, models.QueueStatusNowPlaying).
+			Updates(map[string]interface{}{"status": models.QueueStatusPlayed, "ended_at": now}).Error; err != nil {
+			return err
+		}
+
+		queueItems, err := orderedQueueItems(tx, sessionID, now)
+		if err != nil {
+			return err
+		}
+		if len(queueItems) == 0 {
+			// The playing item still finished, so the transaction is committed
+			empty = true
+			return nil
+		}
+		next = queueItems[0]
+
+		if err := sessionRepository.NewGormSessionRepository(tx).TouchSession(sessionID, now); err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.Queue{}).
+			Where("id = ? AND status = ?", next.ID, models.QueueStatusQueued).
+			Updates(map[string]interface{}{"status": models.QueueStatusNowPlaying, "started_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if empty {
+		return nil, ErrQueueEmpty
+	}
+
+	next.Status = models.QueueStatusNowPlaying
+	next.StartedAt = &now
+	next.Position = 0
+	return &next, nil
+}
+
+func (r *GormQueueRepository) FinishQueueItem(id uint, status string, now time.Time) error {
+	var from string
+	switch status {
+	case models.QueueStatusPlayed, models.QueueStatusSkipped:
+		from = models.QueueStatusNowPlaying
+	case models.QueueStatusRemoved:
+		from = models.QueueStatusQueued
+	default:
+		return fmt.Errorf("cannot finish a queue item with status %q", status)
+	}
+
+	result := r.db.Model(&models.Queue{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(map[string]interface{}{"status": status, "ended_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormQueueRepository) RequeueQueueItem(id uint) error {
+	result := r.db.Model(&models.Queue{}).
+		Where("id = ? AND status = ?", id, models.QueueStatusNowPlaying).
+		Updates(map[string]interface{}{"status": models.QueueStatusQueued, "started_at": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormQueueRepository) GetNowPlaying(sessionID uint) (*models.Queue, error) {
+	var queueItem models.Queue
+	err := r.db.Where("session_id = ? AND status = ?", sessionID, models.QueueStatusNowPlaying).
+		Preload("User").Preload("Track").First(&queueItem).Error
+	return &queueItem, err
+}
+
+func (r *GormQueueRepository) GetHistory(sessionID uint, limit int) ([]models.Queue, error) {
+	var queueItems []models.Queue
+	query := r.db.Where("session_id = ? AND status IN ?", sessionID, []string{models.QueueStatusPlayed, models.QueueStatusSkipped}).
+		Preload("User").Preload("Track").
+		Order("ended_at DESC, id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&queueItems).Error
+	return queueItems, err
+}
+
+func (r *GormQueueRepository) GetRemovedQueueItems(sessionID, userID uint) ([]models.Queue, error) {
+	var queueItems []models.Queue
+	err := r.db.Where("session_id = ? AND user_id = ? AND status = ?", sessionID, userID, models.QueueStatusRemoved).
+		Preload("Track").
+		Order("ended_at DESC, id DESC").
+		Find(&queueItems).Error
+	return queueItems, err
+}
+
+func (r *GormQueueRepository) DeleteQueueItem(id uint) error {
+	return r.db.Delete(&models.Queue{}, id).Error
+}
+
+// orderedQueueItems retrieves the queued items of a session in the order chosen by the host of the session, pinned items first
+func orderedQueueItems(db *gorm.DB, sessionID uint, now time.Time) ([]models.Queue, error) {
+	var session models.Session
+	if err := db.Select("id", "settings").First(&session, sessionID).Error; err != nil {
+		return nil, err
+	}
+
+	strategy, err := ordering.ForSettings(session.Settings, now)
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.Where("session_id = ? AND status = ?", sessionID, models.QueueStatusQueued).
+		Preload("Session").Preload("User").Preload("Track")
+	if strategy.Name() == ordering.Decay {
+		// Decay scores every vote by its age, so it needs the votes rather than their sum
+		query = query.Preload("Votes")
+	}
+
+	var queueItems []models.Queue
+	err = query.Order(arrivalOrder).Find(&queueItems).Error
+	if err != nil {
+		return nil, err
+	}
+	return numberQueueItems(ordering.PinFirst(strategy.Order(queueItems))), nil
+}
+
+// numberQueueItems sets the position of each queue item to its place in the listing
+func numberQueueItems(queueItems []models.Queue) []models.Queue {
+	for i := range queueItems {
+		queueItems[i].Position = i + 1
+	}
+	return queueItems
+}
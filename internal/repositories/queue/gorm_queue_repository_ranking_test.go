@@ -0,0 +1,142 @@
+package queue_test
+
+import (
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/queue"
+	"garrettpfoy/orbit-api/internal/repositories/vote"
+	"testing"
+	"time"
+
+	glebarez "github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// rankingDrivers are the SQLite drivers the ranking is checked on: the one the API runs on and the one the other tests
+// use. Both are SQLite, so this does not show the ranking holds on other databases
+var rankingDrivers = map[string]func(dsn string) gorm.Dialector{
+	"mattn/sqlite3":   sqlite.Open,
+	"glebarez/sqlite": glebarez.Open,
+}
+
+func setupRankingTestDB(open func(dsn string) gorm.Dialector) (*gorm.DB, error) {
+	db, err := gorm.Open(open(":memory:"), &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection to an in-memory database opens a new, empty database
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	err = db.AutoMigrate(&models.Queue{}, &models.Session{}, &models.User{}, &models.Track{}, &models.Vote{})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func trackURIs(queueItems []models.Queue) []string {
+	uris := make([]string, len(queueItems))
+	for i, queueItem := range queueItems {
+		uris[i] = queueItem.TrackURI
+	}
+	return uris
+}
+
+func TestRankingIsStable(t *testing.T) {
+	for name, open := range rankingDrivers {
+		t.Run(name, func(t *testing.T) {
+			db, err := setupRankingTestDB(open)
+			assert.NoError(t, err)
+
+			repo := queue.NewGormQueueRepository(db)
+
+			// The user adds more items than the default quota allows
+			settings := models.DefaultSessionSettings()
+			settings.MaxActiveItems = 0
+			session := &models.Session{Slug: "slug1", HostID: 1, Settings: settings}
+			assert.NoError(t, db.Create(session).Error)
+
+			// Every item is created at the same instant with the same weight, so only the ID can tell them apart
+			createdAt := time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+			for i := 0; i < 10; i++ {
+				queueItem := &models.Queue{
+					Model:     gorm.Model{CreatedAt: createdAt},
+					TrackURI:  fmt.Sprintf("spotify:track:%d", i),
+					SessionID: session.ID,
+					UserID:    1,
+				}
+				assert.NoError(t, repo.CreateQueueItem(queueItem))
+			}
+
+			prioritize := true
+			first, err := repo.GetQueueItemsBySessionID(session.ID, &prioritize)
+			assert.NoError(t, err)
+			for i, queueItem := range first {
+				assert.Equal(t, fmt.Sprintf("spotify:track:%d", i), queueItem.TrackURI)
+				assert.Equal(t, i+1, queueItem.Position)
+			}
+
+			for i := 0; i < 20; i++ {
+				again, err := repo.GetQueueItemsBySessionID(session.ID, &prioritize)
+				assert.NoError(t, err)
+				assert.Equal(t, trackURIs(first), trackURIs(again))
+			}
+		})
+	}
+}
+
+func TestRankingByWeightReachedAt(t *testing.T) {
+	for name, open := range rankingDrivers {
+		t.Run(name, func(t *testing.T) {
+			db, err := setupRankingTestDB(open)
+			assert.NoError(t, err)
+
+			repo := queue.NewGormQueueRepository(db)
+			votes := vote.NewGormVoteRepository(db)
+
+			session := &models.Session{Slug: "slug1", HostID: 1}
+			assert.NoError(t, db.Create(session).Error)
+
+			first := &models.Queue{TrackURI: "spotify:track:first", SessionID: session.ID, UserID: 1}
+			second := &models.Queue{TrackURI: "spotify:track:second", SessionID: session.ID, UserID: 1}
+			third := &models.Queue{TrackURI: "spotify:track:third", SessionID: session.ID, UserID: 1}
+			for _, queueItem := range []*models.Queue{first, second, third} {
+				assert.NoError(t, repo.CreateQueueItem(queueItem))
+			}
+
+			// The second item reaches a weight of one before the first does
+			assert.NoError(t, votes.CastVote(&models.Vote{UserID: 2, QueueID: second.ID, Direction: models.VoteUp}))
+			time.Sleep(time.Millisecond)
+			assert.NoError(t, votes.CastVote(&models.Vote{UserID: 2, QueueID: first.ID, Direction: models.VoteUp}))
+
+			prioritize := true
+			queueItems, err := repo.GetQueueItemsBySessionID(session.ID, &prioritize)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"spotify:track:second", "spotify:track:first", "spotify:track:third"}, trackURIs(queueItems))
+			assert.Equal(t, []int{1, 2, 3}, []int{queueItems[0].Position, queueItems[1].Position, queueItems[2].Position})
+
+			// Losing and regaining the weight makes the second item the last to have reached it
+			time.Sleep(time.Millisecond)
+			assert.NoError(t, votes.RetractVote(2, second.ID))
+			time.Sleep(time.Millisecond)
+			assert.NoError(t, votes.CastVote(&models.Vote{UserID: 3, QueueID: second.ID, Direction: models.VoteUp}))
+
+			queueItems, err = repo.GetQueueItemsBySessionID(session.ID, &prioritize)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"spotify:track:first", "spotify:track:second", "spotify:track:third"}, trackURIs(queueItems))
+
+			// The in-memory strategies rank the same way as the database
+			orderedItems, err := repo.GetOrderedQueueItems(session.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, trackURIs(queueItems), trackURIs(orderedItems))
+		})
+	}
+}
@@ -1,10 +1,14 @@
 package queue_test
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"garrettpfoy/orbit-api/internal/models"
 	"garrettpfoy/orbit-api/internal/repositories/queue"
+	"garrettpfoy/orbit-api/internal/services/voting"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
@@ -12,12 +16,12 @@ import (
 )
 
 func setupTestDB() (*gorm.DB, error) {
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true})
 	if err != nil {
 		return nil, err
 	}
 
-	err = db.AutoMigrate(&models.Queue{}, &models.Session{}, &models.User{})
+	err = db.AutoMigrate(&models.Queue{}, &models.Session{}, &models.User{}, &models.Track{}, &models.Vote{}, &models.VoteEvent{}, &models.ModerationAction{})
 	if err != nil {
 		return nil, err
 	}
@@ -25,15 +29,30 @@ func setupTestDB() (*gorm.DB, error) {
 	return db, nil
 }
 
+// upvote gives a queue item the given weight by having that many new users upvote it.
+func upvote(t *testing.T, db *gorm.DB, queueItem *models.Queue, voters int) {
+	service := voting.NewService(db)
+	for i := 0; i < voters; i++ {
+		voter := &models.User{Username: fmt.Sprintf("voter%d_%d", queueItem.ID, i)}
+		assert.NoError(t, db.Create(voter).Error)
+		_, err := service.Vote(voter.ID, queueItem.ID, 1)
+		assert.NoError(t, err)
+	}
+}
+
 func TestCreateQueueItem(t *testing.T) {
 	db, err := setupTestDB()
 	assert.NoError(t, err)
 
 	repo := queue.NewGormQueueRepository(db)
 
+	session := &models.Session{Slug: "slug1", HostID: 1}
+	err = db.Create(session).Error
+	assert.NoError(t, err)
+
 	queueItem := &models.Queue{
 		TrackURI:  "spotify:track:123",
-		SessionID: 1,
+		SessionID: session.ID,
 		UserID:    1,
 		Weight:    10,
 	}
@@ -47,7 +66,12 @@ func TestCreateQueueItem(t *testing.T) {
 	assert.Equal(t, queueItem.TrackURI, createdQueueItem.TrackURI)
 	assert.Equal(t, queueItem.SessionID, createdQueueItem.SessionID)
 	assert.Equal(t, queueItem.UserID, createdQueueItem.UserID)
-	assert.Equal(t, queueItem.Weight, createdQueueItem.Weight)
+	assert.Equal(t, 0, createdQueueItem.Weight) // the weight is derived from votes and cannot be set directly
+	assert.Equal(t, models.QueueStatusQueued, createdQueueItem.Status)
+
+	// A queue item can only be added to a session that exists
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:456", SessionID: session.ID + 1, UserID: 1})
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
 }
 
 func TestGetQueueItemsBySessionID(t *testing.T) {
@@ -56,26 +80,30 @@ func TestGetQueueItemsBySessionID(t *testing.T) {
 
 	repo := queue.NewGormQueueRepository(db)
 
+	session := &models.Session{Slug: "slug1", HostID: 1}
+	err = db.Create(session).Error
+	assert.NoError(t, err)
+
 	queueItem1 := &models.Queue{
 		TrackURI:  "spotify:track:123",
-		SessionID: 1,
+		SessionID: session.ID,
 		UserID:    1,
-		Weight:    10,
 	}
 	queueItem2 := &models.Queue{
 		TrackURI:  "spotify:track:456",
-		SessionID: 1,
+		SessionID: session.ID,
 		UserID:    2,
-		Weight:    20,
 	}
 
 	err = repo.CreateQueueItem(queueItem1)
 	assert.NoError(t, err)
 	err = repo.CreateQueueItem(queueItem2)
 	assert.NoError(t, err)
+	upvote(t, db, queueItem1, 1)
+	upvote(t, db, queueItem2, 2)
 
 	prioritize := true
-	queueItems, err := repo.GetQueueItemsBySessionID(1, &prioritize)
+	queueItems, err := repo.GetQueueItemsBySessionID(session.ID, &prioritize)
 	assert.NoError(t, err)
 	assert.Len(t, queueItems, 2)
 	assert.Equal(t, queueItem2.TrackURI, queueItems[0].TrackURI) // queueItem2 should come first due to higher weight
@@ -88,23 +116,30 @@ func TestGetQueueItemsByUserID(t *testing.T) {
 
 	repo := queue.NewGormQueueRepository(db)
 
+	session1 := &models.Session{Slug: "slug1", HostID: 1}
+	err = db.Create(session1).Error
+	assert.NoError(t, err)
+	session2 := &models.Session{Slug: "slug2", HostID: 2}
+	err = db.Create(session2).Error
+	assert.NoError(t, err)
+
 	queueItem1 := &models.Queue{
 		TrackURI:  "spotify:track:123",
-		SessionID: 1,
+		SessionID: session1.ID,
 		UserID:    1,
-		Weight:    10,
 	}
 	queueItem2 := &models.Queue{
 		TrackURI:  "spotify:track:456",
-		SessionID: 2,
+		SessionID: session2.ID,
 		UserID:    1,
-		Weight:    20,
 	}
 
 	err = repo.CreateQueueItem(queueItem1)
 	assert.NoError(t, err)
 	err = repo.CreateQueueItem(queueItem2)
 	assert.NoError(t, err)
+	upvote(t, db, queueItem1, 1)
+	upvote(t, db, queueItem2, 2)
 
 	prioritize := true
 	queueItems, err := repo.GetQueueItemsByUserID(1, &prioritize)
@@ -128,19 +163,16 @@ func TestGetQueueItemsBySessionIDByUserID(t *testing.T) {
 		TrackURI:  "spotify:track:123",
 		SessionID: session.ID,
 		UserID:    1,
-		Weight:    10,
 	}
 	queueItem2 := &models.Queue{
 		TrackURI:  "spotify:track:456",
 		SessionID: session.ID,
 		UserID:    1,
-		Weight:    20,
 	}
 	queueItem3 := &models.Queue{
 		TrackURI:  "spotify:track:789",
 		SessionID: session.ID,
 		UserID:    2,
-		Weight:    30,
 	}
 
 	err = repo.CreateQueueItem(queueItem1)
@@ -149,6 +181,9 @@ func TestGetQueueItemsBySessionIDByUserID(t *testing.T) {
 	assert.NoError(t, err)
 	err = repo.CreateQueueItem(queueItem3)
 	assert.NoError(t, err)
+	upvote(t, db, queueItem1, 1)
+	upvote(t, db, queueItem2, 2)
+	upvote(t, db, queueItem3, 3)
 
 	prioritize := true
 	queueItems, err := repo.GetQueueItemsBySessionIDByUserID(session.ID, 1, &prioritize)
@@ -164,9 +199,13 @@ func TestGetQueueItem(t *testing.T) {
 
 	repo := queue.NewGormQueueRepository(db)
 
+	session := &models.Session{Slug: "slug1", HostID: 1}
+	err = db.Create(session).Error
+	assert.NoError(t, err)
+
 	queueItem := &models.Queue{
 		TrackURI:  "spotify:track:123",
-		SessionID: 1,
+		SessionID: session.ID,
 		UserID:    1,
 		Weight:    10,
 	}
@@ -188,9 +227,13 @@ func TestUpdateQueueItem(t *testing.T) {
 
 	repo := queue.NewGormQueueRepository(db)
 
+	session := &models.Session{Slug: "slug1", HostID: 1}
+	err = db.Create(session).Error
+	assert.NoError(t, err)
+
 	queueItem := &models.Queue{
 		TrackURI:  "spotify:track:123",
-		SessionID: 1,
+		SessionID: session.ID,
 		UserID:    1,
 		Weight:    10,
 	}
@@ -198,6 +241,7 @@ func TestUpdateQueueItem(t *testing.T) {
 	err = repo.CreateQueueItem(queueItem)
 	assert.NoError(t, err)
 
+	queueItem.TrackURI = "spotify:track:456"
 	queueItem.Weight = 20
 	err = repo.UpdateQueueItem(queueItem)
 	assert.NoError(t, err)
@@ -205,7 +249,8 @@ func TestUpdateQueueItem(t *testing.T) {
 	var updatedQueueItem models.Queue
 	err = db.First(&updatedQueueItem, queueItem.ID).Error
 	assert.NoError(t, err)
-	assert.Equal(t, queueItem.Weight, updatedQueueItem.Weight)
+	assert.Equal(t, queueItem.TrackURI, updatedQueueItem.TrackURI)
+	assert.Equal(t, 0, updatedQueueItem.Weight) // the weight is derived from votes and cannot be set directly
 }
 
 func TestDeleteQueueItem(t *testing.T) {
@@ -214,9 +259,13 @@ func TestDeleteQueueItem(t *testing.T) {
 
 	repo := queue.NewGormQueueRepository(db)
 
+	session := &models.Session{Slug: "slug1", HostID: 1}
+	err = db.Create(session).Error
+	assert.NoError(t, err)
+
 	queueItem := &models.Queue{
 		TrackURI:  "spotify:track:123",
-		SessionID: 1,
+		SessionID: session.ID,
 		UserID:    1,
 		Weight:    10,
 	}
@@ -232,3 +281,690 @@ func TestDeleteQueueItem(t *testing.T) {
 	assert.Error(t, err)
 	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
 }
+
+type stubTrackResolver struct {
+	tracks map[string]*models.Track
+}
+
+func (r *stubTrackResolver) Resolve(ctx context.Context, uri string) (*models.Track, error) {
+	track, ok := r.tracks[uri]
+	if !ok {
+		return nil, fmt.Errorf("track %s not found", uri)
+	}
+	return track, nil
+}
+
+func TestCreateQueueItemResolvesTrack(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	resolved := &models.Track{URI: "spotify:track:123", Name: "Harvest Moon", DurationMs: 300000, FetchedAt: time.Now()}
+	err = db.Create(resolved).Error
+	assert.NoError(t, err)
+
+	repo := queue.NewGormQueueRepository(db).WithTrackResolver(&stubTrackResolver{
+		tracks: map[string]*models.Track{resolved.URI: resolved},
+	})
+
+	session := &models.Session{Slug: "slug1", HostID: 1}
+	err = db.Create(session).Error
+	assert.NoError(t, err)
+
+	queueItem := &models.Queue{
+		TrackURI:  "spotify:track:123",
+		SessionID: session.ID,
+		UserID:    1,
+	}
+
+	err = repo.CreateQueueItem(queueItem)
+	assert.NoError(t, err)
+	assert.Equal(t, "Harvest Moon", queueItem.Track.Name)
+
+	queueItems, err := repo.GetQueueItemsBySessionID(session.ID, nil)
+	assert.NoError(t, err)
+	assert.Len(t, queueItems, 1)
+	assert.NotNil(t, queueItems[0].Track)
+	assert.Equal(t, "Harvest Moon", queueItems[0].Track.Name)
+	assert.Equal(t, 300000, queueItems[0].Track.DurationMs)
+}
+
+func TestCreateQueueItemUnresolvableTrack(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := queue.NewGormQueueRepository(db).WithTrackResolver(&stubTrackResolver{})
+
+	err = repo.CreateQueueItem(&models.Queue{
+		TrackURI:  "spotify:track:404",
+		SessionID: 1,
+		UserID:    1,
+	})
+	assert.Error(t, err)
+
+	var count int64
+	err = db.Model(&models.Queue{}).Count(&count).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestGetOrderedQueueItems(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := queue.NewGormQueueRepository(db)
+
+	session := &models.Session{Slug: "slug1", HostID: 1}
+	err = db.Create(session).Error
+	assert.NoError(t, err)
+
+	// User 1 adds three tracks before user 2 adds one
+	for i, userID := range []uint{1, 1, 1, 2} {
+		err = repo.CreateQueueItem(&models.Queue{
+			TrackURI:  fmt.Sprintf("spotify:track:%d", i),
+			SessionID: session.ID,
+			UserID:    userID,
+		})
+		assert.NoError(t, err)
+	}
+
+	queueItems, err := repo.GetOrderedQueueItems(session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{1, 1, 1, 2}, []uint{queueItems[0].UserID, queueItems[1].UserID, queueItems[2].UserID, queueItems[3].UserID})
+
+	settings := models.DefaultSessionSettings()
+	settings.QueueOrder = "fair_share"
+	err = db.Model(session).Update("settings", settings).Error
+	assert.NoError(t, err)
+
+	queueItems, err = repo.GetOrderedQueueItems(session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{1, 2, 1, 1}, []uint{queueItems[0].UserID, queueItems[1].UserID, queueItems[2].UserID, queueItems[3].UserID})
+
+	// Listings number their items with the position they will play at, pins included, whatever order they are listed in
+	err = db.Model(&models.Queue{}).Where("track_uri = ?", "spotify:track:2").Update("pin_rank", 1).Error
+	assert.NoError(t, err)
+	listed, err := repo.GetQueueItemsBySessionID(session.ID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 4, 1, 3}, []int{listed[0].Position, listed[1].Position, listed[2].Position, listed[3].Position})
+
+	_, err = repo.GetOrderedQueueItems(session.ID + 1)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func TestPopNextQueueItem(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := queue.NewGormQueueRepository(db)
+
+	session := &models.Session{Slug: "slug1", HostID: 1}
+	err = db.Create(session).Error
+	assert.NoError(t, err)
+
+	queueItem1 := &models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 1}
+	queueItem2 := &models.Queue{TrackURI: "spotify:track:456", SessionID: session.ID, UserID: 1}
+	err = repo.CreateQueueItem(queueItem1)
+	assert.NoError(t, err)
+	err = repo.CreateQueueItem(queueItem2)
+	assert.NoError(t, err)
+	upvote(t, db, queueItem2, 1)
+
+	// The highest ranked item is played first
+	started := time.Now()
+	nowPlaying, err := repo.PopNextQueueItem(session.ID, started)
+	assert.NoError(t, err)
+	assert.Equal(t, queueItem2.ID, nowPlaying.ID)
+	assert.Equal(t, models.QueueStatusNowPlaying, nowPlaying.Status)
+
+	current, err := repo.GetNowPlaying(session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, queueItem2.ID, current.ID)
+	assert.WithinDuration(t, started, *current.StartedAt, time.Second)
+
+	var touched models.Session
+	err = db.First(&touched, session.ID).Error
+	assert.NoError(t, err)
+	assert.WithinDuration(t, started, *touched.LastActivityAt, time.Second)
+
+	queueItems, err := repo.GetQueueItemsBySessionID(session.ID, nil)
+	assert.NoError(t, err)
+	assert.Len(t, queueItems, 1)
+	assert.Equal(t, queueItem1.ID, queueItems[0].ID)
+
+	// Popping again finishes the playing item
+	nowPlaying, err = repo.PopNextQueueItem(session.ID, started.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, queueItem1.ID, nowPlaying.ID)
+
+	played, err := repo.GetQueueItem(queueItem2.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.QueueStatusPlayed, played.Status)
+	assert.NotNil(t, played.EndedAt)
+
+	_, err = repo.PopNextQueueItem(session.ID, started.Add(2*time.Minute))
+	assert.True(t, errors.Is(err, queue.ErrQueueEmpty))
+
+	// The last item is finished even though nothing followed it
+	_, err = repo.GetNowPlaying(session.ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func TestSessionNotOpen(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := queue.NewGormQueueRepository(db)
+
+	session := &models.Session{Slug: "slug1", HostID: 1}
+	err = db.Create(session).Error
+	assert.NoError(t, err)
+
+	queueItem := &models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 1}
+	err = repo.CreateQueueItem(queueItem)
+	assert.NoError(t, err)
+
+	// A paused session still takes requests, but does not start them
+	err = db.Model(session).Update("status", models.SessionStatusPaused).Error
+	assert.NoError(t, err)
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:456", SessionID: session.ID, UserID: 1})
+	assert.NoError(t, err)
+	_, err = repo.PopNextQueueItem(session.ID, time.Now())
+	assert.True(t, errors.Is(err, queue.ErrSessionNotOpen))
+
+	err = db.Model(session).Update("status", models.SessionStatusEnded).Error
+	assert.NoError(t, err)
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:789", SessionID: session.ID, UserID: 1})
+	assert.True(t, errors.Is(err, queue.ErrSessionNotOpen))
+	_, err = repo.PopNextQueueItem(session.ID, time.Now())
+	assert.True(t, errors.Is(err, queue.ErrSessionNotOpen))
+}
+
+func TestFinishQueueItem(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := queue.NewGormQueueRepository(db)
+
+	session := &models.Session{Slug: "slug1", HostID: 1}
+	err = db.Create(session).Error
+	assert.NoError(t, err)
+
+	queueItem1 := &models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 1}
+	queueItem2 := &models.Queue{TrackURI: "spotify:track:456", SessionID: session.ID, UserID: 1}
+	err = repo.CreateQueueItem(queueItem1)
+	assert.NoError(t, err)
+	err = repo.CreateQueueItem(queueItem2)
+	assert.NoError(t, err)
+
+	// Only playing items can be skipped, and only queued items can be removed
+	err = repo.FinishQueueItem(queueItem1.ID, models.QueueStatusSkipped, time.Now())
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+	err = repo.FinishQueueItem(queueItem2.ID, models.QueueStatusRemoved, time.Now())
+	assert.NoError(t, err)
+
+	_, err = repo.PopNextQueueItem(session.ID, time.Now())
+	assert.NoError(t, err)
+	err = repo.FinishQueueItem(queueItem1.ID, models.QueueStatusSkipped, time.Now())
+	assert.NoError(t, err)
+
+	skipped, err := repo.GetQueueItem(queueItem1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.QueueStatusSkipped, skipped.Status)
+
+	err = repo.FinishQueueItem(queueItem1.ID, models.QueueStatusQueued, time.Now())
+	assert.Error(t, err)
+}
+
+func TestGetHistory(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := queue.NewGormQueueRepository(db)
+
+	session := &models.Session{Slug: "slug1", HostID: 1}
+	err = db.Create(session).Error
+	assert.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		err = repo.CreateQueueItem(&models.Queue{TrackURI: fmt.Sprintf("spotify:track:%d", i), SessionID: session.ID, UserID: 1})
+		assert.NoError(t, err)
+	}
+
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err = repo.PopNextQueueItem(session.ID, started.Add(time.Duration(i)*time.Minute))
+		assert.NoError(t, err)
+	}
+	nowPlaying, err := repo.GetNowPlaying(session.ID)
+	assert.NoError(t, err)
+	err = repo.FinishQueueItem(nowPlaying.ID, models.QueueStatusSkipped, started.Add(3*time.Minute))
+	assert.NoError(t, err)
+
+	history, err := repo.GetHistory(session.ID, 0)
+	assert.NoError(t, err)
+	assert.Len(t, history, 3)
+	assert.Equal(t, "spotify:track:2", history[0].TrackURI)
+	assert.Equal(t, models.QueueStatusSkipped, history[0].Status)
+	assert.Equal(t, "spotify:track:1", history[1].TrackURI)
+	assert.Equal(t, "spotify:track:0", history[2].TrackURI)
+
+	history, err = repo.GetHistory(session.ID, 1)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	// Items that are still queued are not part of the history
+	queueItems, err := repo.GetQueueItemsBySessionID(session.ID, nil)
+	assert.NoError(t, err)
+	assert.Len(t, queueItems, 1)
+	assert.Equal(t, "spotify:track:3", queueItems[0].TrackURI)
+}
+
+func TestRequeueQueueItem(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := queue.NewGormQueueRepository(db)
+
+	session := &models.Session{Slug: "slug1", HostID: 1}
+	err = db.Create(session).Error
+	assert.NoError(t, err)
+
+	queueItem := &models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 1}
+	err = repo.CreateQueueItem(queueItem)
+	assert.NoError(t, err)
+
+	err = repo.RequeueQueueItem(queueItem.ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	_, err = repo.PopNextQueueItem(session.ID, time.Now())
+	assert.NoError(t, err)
+	err = repo.RequeueQueueItem(queueItem.ID)
+	assert.NoError(t, err)
+
+	requeued, err := repo.GetQueueItem(queueItem.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.QueueStatusQueued, requeued.Status)
+	assert.Nil(t, requeued.StartedAt)
+}
+
+// setupDuplicateSession creates a session with the given duplicate policy, and the users 1 to 3 who queue tracks in it.
+// Merged duplicates are upvotes cast through the voting service, which needs the voters to exist.
+func setupDuplicateSession(t *testing.T, db *gorm.DB, policy string, cooldownMinutes int) *models.Session {
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, db.Create(&models.User{Model: gorm.Model{ID: uint(i)}, Username: fmt.Sprintf("user%d", i)}).Error)
+	}
+
+	settings := models.DefaultSessionSettings()
+	settings.DuplicatePolicy = policy
+	settings.DuplicateCooldownMinutes = cooldownMinutes
+	session := &models.Session{Slug: "slug1", HostID: 1, Settings: settings}
+	assert.NoError(t, db.Create(session).Error)
+	return session
+}
+
+func TestCreateQueueItemDuplicateMerge(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := queue.NewGormQueueRepository(db)
+	session := setupDuplicateSession(t, db, models.DuplicatePolicyMerge, 0)
+
+	original := &models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 1}
+	err = repo.CreateQueueItem(original)
+	assert.NoError(t, err)
+
+	// Another user queueing the same track is refused, but can upvote the queued item instead
+	var duplicateErr *queue.DuplicateError
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 2})
+	assert.True(t, errors.As(err, &duplicateErr))
+	assert.Equal(t, original.ID, duplicateErr.ExistingID)
+	assert.True(t, duplicateErr.Mergeable)
+
+	// Neither the user who added it nor a user who already voted can merge into it
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 1})
+	assert.True(t, errors.As(err, &duplicateErr))
+	assert.False(t, duplicateErr.Mergeable)
+	_, err = voting.NewService(db).Vote(3, original.ID, models.VoteUp)
+	assert.NoError(t, err)
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 3})
+	assert.True(t, errors.As(err, &duplicateErr))
+	assert.False(t, duplicateErr.Mergeable)
+
+	queueItems, err := repo.GetQueueItemsBySessionID(session.ID, nil)
+	assert.NoError(t, err)
+	assert.Len(t, queueItems, 1)
+
+	// A track that is playing can not be merged into, but it can be queued again once it played
+	_, err = repo.PopNextQueueItem(session.ID, time.Now())
+	assert.NoError(t, err)
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 3})
+	assert.True(t, errors.As(err, &duplicateErr))
+	assert.False(t, duplicateErr.Mergeable)
+
+	_, err = repo.PopNextQueueItem(session.ID, time.Now())
+	assert.True(t, errors.Is(err, queue.ErrQueueEmpty))
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 3})
+	assert.NoError(t, err)
+}
+
+func TestCreateQueueItemDuplicateReject(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := queue.NewGormQueueRepository(db)
+	session := setupDuplicateSession(t, db, models.DuplicatePolicyReject, 0)
+
+	queueItem := &models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 1}
+	err = repo.CreateQueueItem(queueItem)
+	assert.NoError(t, err)
+
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 2})
+	assert.True(t, errors.Is(err, queue.ErrDuplicateTrack))
+
+	// A removed track can be queued again
+	err = repo.FinishQueueItem(queueItem.ID, models.QueueStatusRemoved, time.Now())
+	assert.NoError(t, err)
+	requeued := &models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 2}
+	err = repo.CreateQueueItem(requeued)
+	assert.NoError(t, err)
+
+	// A played track can never be queued again
+	_, err = repo.PopNextQueueItem(session.ID, time.Now())
+	assert.NoError(t, err)
+	_, err = repo.PopNextQueueItem(session.ID, time.Now())
+	assert.True(t, errors.Is(err, queue.ErrQueueEmpty))
+
+	var duplicateErr *queue.DuplicateError
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 3})
+	assert.True(t, errors.As(err, &duplicateErr))
+	assert.Equal(t, requeued.ID, duplicateErr.ExistingID)
+	assert.Nil(t, duplicateErr.RetryAt)
+
+	// The policy only applies within a session
+	other := &models.Session{Slug: "slug2", HostID: 2}
+	assert.NoError(t, db.Create(other).Error)
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:123", SessionID: other.ID, UserID: 3})
+	assert.NoError(t, err)
+}
+
+func TestCreateQueueItemDuplicateAllowAfter(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := queue.NewGormQueueRepository(db)
+	session := setupDuplicateSession(t, db, models.DuplicatePolicyAllowAfter, 30)
+
+	queueItem := &models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 1}
+	err = repo.CreateQueueItem(queueItem)
+	assert.NoError(t, err)
+
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 2})
+	assert.True(t, errors.Is(err, queue.ErrDuplicateTrack))
+
+	// The track played 10 minutes ago, so it can be queued again in 20 minutes
+	ended := time.Now().Add(-10 * time.Minute)
+	_, err = repo.PopNextQueueItem(session.ID, ended.Add(-3*time.Minute))
+	assert.NoError(t, err)
+	_, err = repo.PopNextQueueItem(session.ID, ended)
+	assert.True(t, errors.Is(err, queue.ErrQueueEmpty))
+
+	var duplicateErr *queue.DuplicateError
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 2})
+	assert.True(t, errors.As(err, &duplicateErr))
+	assert.Equal(t, queueItem.ID, duplicateErr.ExistingID)
+	if assert.NotNil(t, duplicateErr.RetryAt) {
+		assert.WithinDuration(t, ended.Add(30*time.Minute), *duplicateErr.RetryAt, time.Second)
+	}
+
+	err = db.Model(&models.Queue{}).Where("id = ?", queueItem.ID).Update("ended_at", time.Now().Add(-31*time.Minute)).Error
+	assert.NoError(t, err)
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 2})
+	assert.NoError(t, err)
+}
+
+func TestActiveTrackUniqueIndex(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	// The index guards against duplicates even when the repository is bypassed
+	err = db.Create(&models.Queue{TrackURI: "spotify:track:123", SessionID: 1, UserID: 1}).Error
+	assert.NoError(t, err)
+	err = db.Create(&models.Queue{TrackURI: "spotify:track:123", SessionID: 1, UserID: 2}).Error
+	assert.True(t, errors.Is(err, gorm.ErrDuplicatedKey), err)
+
+	// Only active items are unique
+	err = db.Create(&models.Queue{TrackURI: "spotify:track:123", SessionID: 1, UserID: 2, Status: models.QueueStatusPlayed}).Error
+	assert.NoError(t, err)
+	err = db.Create(&models.Queue{TrackURI: "spotify:track:123", SessionID: 2, UserID: 2}).Error
+	assert.NoError(t, err)
+}
+
+func TestCreateQueueItemDuplicateRace(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+	session := setupDuplicateSession(t, db, models.DuplicatePolicyReject, 0)
+
+	// Queue the track from another request after the duplicate policy passed, as if two adds raced, so only the
+	// unique index can refuse the second item
+	raced := false
+	err = db.Callback().Create().Before("gorm:create").Register("test:race", func(tx *gorm.DB) {
+		if raced || tx.Statement.Table != "queues" {
+			return
+		}
+		raced = true
+		tx.Error = tx.Session(&gorm.Session{NewDB: true}).Exec(
+			"INSERT INTO queues (created_at, updated_at, track_uri, session_id, user_id, status) VALUES (?, ?, ?, ?, ?, ?)",
+			time.Now(), time.Now(), "spotify:track:123", session.ID, 2, models.QueueStatusQueued).Error
+	})
+	assert.NoError(t, err)
+
+	repo := queue.NewGormQueueRepository(db)
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 1})
+	assert.True(t, errors.Is(err, queue.ErrDuplicateTrack), err)
+
+	var duplicateErr *queue.DuplicateError
+	assert.True(t, errors.As(err, &duplicateErr))
+	assert.Equal(t, models.DuplicatePolicyReject, duplicateErr.Policy)
+}
+
+// setupQuotaSession creates a session with the given quotas
+func setupQuotaSession(t *testing.T, db *gorm.DB, maxActiveItems, maxAddsPerHour, maxQueuedMinutes int) *models.Session {
+	settings := models.DefaultSessionSettings()
+	settings.MaxActiveItems = maxActiveItems
+	settings.MaxAddsPerHour = maxAddsPerHour
+	settings.MaxQueuedMinutes = maxQueuedMinutes
+	session := &models.Session{Slug: "slug1", HostID: 1, Settings: settings}
+	assert.NoError(t, db.Create(session).Error)
+	return session
+}
+
+func TestCreateQueueItemActiveItemsQuota(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := queue.NewGormQueueRepository(db)
+	session := setupQuotaSession(t, db, 2, 0, 0)
+
+	for i := 0; i < 2; i++ {
+		err = repo.CreateQueueItem(&models.Queue{TrackURI: fmt.Sprintf("spotify:track:%d", i), SessionID: session.ID, UserID: 1})
+		assert.NoError(t, err)
+	}
+
+	var quotaErr *queue.QuotaError
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:2", SessionID: session.ID, UserID: 1})
+	assert.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, queue.QuotaActiveItems, quotaErr.Limit)
+	assert.Equal(t, 2, quotaErr.Max)
+	assert.Equal(t, 2, quotaErr.Current)
+	assert.Nil(t, quotaErr.RetryAt)
+
+	// The quota is per user
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:2", SessionID: session.ID, UserID: 2})
+	assert.NoError(t, err)
+
+	// The playing item still counts, a played item does not
+	_, err = repo.PopNextQueueItem(session.ID, time.Now())
+	assert.NoError(t, err)
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:3", SessionID: session.ID, UserID: 1})
+	assert.True(t, errors.Is(err, queue.ErrQuotaExceeded))
+	_, err = repo.PopNextQueueItem(session.ID, time.Now())
+	assert.NoError(t, err)
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:3", SessionID: session.ID, UserID: 1})
+	assert.NoError(t, err)
+}
+
+func TestCreateQueueItemAddsPerHourQuota(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := queue.NewGormQueueRepository(db)
+	session := setupQuotaSession(t, db, 0, 2, 0)
+
+	queueItem := &models.Queue{TrackURI: "spotify:track:0", SessionID: session.ID, UserID: 1}
+	err = repo.CreateQueueItem(queueItem)
+	assert.NoError(t, err)
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:1", SessionID: session.ID, UserID: 1})
+	assert.NoError(t, err)
+
+	// Removing an item does not give the add back
+	err = repo.FinishQueueItem(queueItem.ID, models.QueueStatusRemoved, time.Now())
+	assert.NoError(t, err)
+
+	var quotaErr *queue.QuotaError
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:2", SessionID: session.ID, UserID: 1})
+	assert.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, queue.QuotaAddsPerHour, quotaErr.Limit)
+	assert.Equal(t, 2, quotaErr.Current)
+
+	// The user can add again once the oldest add leaves the window
+	oldest := time.Now().Add(-50 * time.Minute)
+	err = db.Model(&models.Queue{}).Where("id = ?", queueItem.ID).Update("created_at", oldest).Error
+	assert.NoError(t, err)
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:2", SessionID: session.ID, UserID: 1})
+	assert.True(t, errors.As(err, &quotaErr))
+	if assert.NotNil(t, quotaErr.RetryAt) {
+		assert.WithinDuration(t, oldest.Add(time.Hour), *quotaErr.RetryAt, time.Second)
+	}
+
+	err = db.Model(&models.Queue{}).Where("id = ?", queueItem.ID).Update("created_at", time.Now().Add(-61*time.Minute)).Error
+	assert.NoError(t, err)
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:2", SessionID: session.ID, UserID: 1})
+	assert.NoError(t, err)
+}
+
+func TestCreateQueueItemQueuedMinutesQuota(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	resolver := &stubTrackResolver{tracks: map[string]*models.Track{}}
+	for i, minutes := range []int{4, 4, 3} {
+		uri := fmt.Sprintf("spotify:track:%d", i)
+		track := &models.Track{URI: uri, Name: uri, DurationMs: minutes * 60 * 1000, FetchedAt: time.Now()}
+		resolver.tracks[uri] = track
+		assert.NoError(t, db.Create(track).Error)
+	}
+	repo := queue.NewGormQueueRepository(db).WithTrackResolver(resolver)
+	session := setupQuotaSession(t, db, 0, 0, 10)
+
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:0", SessionID: session.ID, UserID: 1})
+	assert.NoError(t, err)
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:1", SessionID: session.ID, UserID: 1})
+	assert.NoError(t, err)
+
+	// 8 minutes are queued, so another 3 minutes would exceed the quota
+	var quotaErr *queue.QuotaError
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:2", SessionID: session.ID, UserID: 1})
+	assert.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, queue.QuotaQueuedMinutes, quotaErr.Limit)
+	assert.Equal(t, 10, quotaErr.Max)
+	assert.Equal(t, 8, quotaErr.Current)
+
+	// Only items that are waiting count, so the quota frees up as the queue plays
+	_, err = repo.PopNextQueueItem(session.ID, time.Now())
+	assert.NoError(t, err)
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:2", SessionID: session.ID, UserID: 1})
+	assert.NoError(t, err)
+}
+
+func TestCreateQueueItemTrackRules(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	tracks := []*models.Track{
+		{URI: "spotify:track:clean", Name: "Clean", DurationMs: 3 * 60 * 1000, FetchedAt: time.Now()},
+		{URI: "spotify:track:explicit", Name: "Explicit", DurationMs: 3 * 60 * 1000, Explicit: true, FetchedAt: time.Now()},
+		{URI: "spotify:track:long", Name: "Long", DurationMs: 12 * 60 * 1000, FetchedAt: time.Now()},
+	}
+	for _, track := range tracks {
+		assert.NoError(t, db.Create(track).Error)
+	}
+
+	settings := models.DefaultSessionSettings()
+	settings.ExplicitFilter = true
+	settings.MaxTrackMinutes = 10
+	session := &models.Session{Slug: "slug1", HostID: 1, Settings: settings}
+	assert.NoError(t, db.Create(session).Error)
+
+	// Without a resolver the rules go by the cached metadata of the tracks
+	repo := queue.NewGormQueueRepository(db)
+
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:clean", SessionID: session.ID, UserID: 1})
+	assert.NoError(t, err)
+
+	var ruleErr *queue.TrackRuleError
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:explicit", SessionID: session.ID, UserID: 1})
+	assert.True(t, errors.As(err, &ruleErr))
+	assert.Equal(t, queue.TrackRuleExplicit, ruleErr.Rule)
+
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:long", SessionID: session.ID, UserID: 1})
+	assert.True(t, errors.Is(err, queue.ErrTrackNotAllowed))
+	assert.True(t, errors.As(err, &ruleErr))
+	assert.Equal(t, queue.TrackRuleMaxLength, ruleErr.Rule)
+	assert.Equal(t, 10, ruleErr.MaxMinutes)
+
+	// A track that was never resolved is let through
+	err = repo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:unknown", SessionID: session.ID, UserID: 1})
+	assert.NoError(t, err)
+}
+
+func TestGetOrderedQueueItemsDecay(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := queue.NewGormQueueRepository(db)
+
+	settings := models.DefaultSessionSettings()
+	settings.QueueOrder = "decay"
+	settings.VoteHalfLifeMinutes = 30
+	session := &models.Session{Slug: "slug1", HostID: 1, Settings: settings}
+	err = db.Create(session).Error
+	assert.NoError(t, err)
+
+	early := &models.Queue{TrackURI: "spotify:track:early", SessionID: session.ID, UserID: 1}
+	recent := &models.Queue{TrackURI: "spotify:track:recent", SessionID: session.ID, UserID: 1}
+	assert.NoError(t, repo.CreateQueueItem(early))
+	assert.NoError(t, repo.CreateQueueItem(recent))
+
+	// Three votes two hours ago are worth less than one vote now, even though they weigh more
+	for userID := uint(2); userID <= 4; userID++ {
+		err = db.Create(&models.Vote{UserID: userID, QueueID: early.ID, Direction: models.VoteUp}).Error
+		assert.NoError(t, err)
+	}
+	err = db.Model(&models.Vote{}).Where("queue_id = ?", early.ID).Update("updated_at", time.Now().Add(-2*time.Hour)).Error
+	assert.NoError(t, err)
+	err = db.Model(early).Update("weight", 3).Error
+	assert.NoError(t, err)
+	err = db.Create(&models.Vote{UserID: 2, QueueID: recent.ID, Direction: models.VoteUp}).Error
+	assert.NoError(t, err)
+
+	queueItems, err := repo.GetOrderedQueueItems(session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"spotify:track:recent", "spotify:track:early"}, []string{queueItems[0].TrackURI, queueItems[1].TrackURI})
+	assert.Len(t, queueItems[0].Votes, 1)
+
+	// The weight ranking still uses the raw sum
+	prioritize := true
+	queueItems, err = repo.GetQueueItemsBySessionID(session.ID, &prioritize)
+	assert.NoError(t, err)
+	assert.Equal(t, "spotify:track:early", queueItems[0].TrackURI)
+}
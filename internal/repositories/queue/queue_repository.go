@@ -1,25 +1,71 @@
-package queue
-
-import (
-	"garrettpfoy/orbit-api/internal/models"
-)
-
-type QueueRepository interface {
-	// CreateQueueItem validates and creates a new queue item in the database
-	CreateQueueItem(queueItem *models.Queue) error
-	// GetQueueItemsBySessionID retrieves all queue items in a session by the session ID
-	// If prioritize is true, the queue items are sorted by weight in descending order
-	GetQueueItemsBySessionID(sessionID uint, prioritize *bool) ([]models.Queue, error)
-	// GetQueueItemsByUserID retrieves all queue items in a session by the user ID
-	// If prioritize is true, the queue items are sorted by weight in descending order
-	GetQueueItemsByUserID(userID uint, prioritize *bool) ([]models.Queue, error)
-	// GetQueueItemsBySessionIDByUserID retrieves all queue items in a session by the session ID and user ID
-	// If prioritize is true, the queue items are sorted by weight in descending order
-	GetQueueItemsBySessionIDByUserID(sessionID, userID uint, prioritize *bool) ([]models.Queue, error)
-	// GetQueueItem retrieves a queue item from the database by its ID
-	GetQueueItem(id uint) (*models.Queue, error)
-	// UpdateQueueItem validates and updates a queue item in the database
-	UpdateQueueItem(queueItem *models.Queue) error
-	// DeleteQueueItem deletes a queue item from the database by its ID
-	DeleteQueueItem(id uint) error
-}
+package queue
+
+import (
+	"context"
+	"errors"
+	"garrettpfoy/orbit-api/internal/models"
+	"time"
+)
+
+// ErrQueueEmpty is returned when there is no queued item left to play
+var ErrQueueEmpty = errors.New("the queue is empty")
+
+// ErrQueueLocked is returned when an item is added to a session whose host locked the queue
+var ErrQueueLocked = errors.New("the queue is locked")
+
+// ErrSessionNotOpen is returned when an item is added to an ended session, or a track is started in a paused or ended one
+var ErrSessionNotOpen = errors.New("the session is not open")
+
+// TrackResolver resolves the metadata of the track a queue item refers to
+type TrackResolver interface {
+	// Resolve returns the metadata of the track with the given URI
+	Resolve(ctx context.Context, uri string) (*models.Track, error)
+}
+
+type QueueRepository interface {
+	// CreateQueueItem validates and creates a new queue item in the database, resolving the metadata of its track if a resolver is set
+	// A track that is already in the session is refused with a DuplicateError under the duplicate policy of the session, which is
+	// marked Mergeable when the requester can upvote the queued item instead, see the queueing service
+	// An item that would take its user over one of the quotas of the session is refused with a QuotaError, and every item is
+	// refused with ErrQueueLocked while the host has locked the queue
+	CreateQueueItem(queueItem *models.Queue) error
+	// GetQueueItemsBySessionID retrieves all queue items in a session by the session ID, numbered with their positions in GetOrderedQueueItems
+	// Listings only return items that are still queued, see GetNowPlaying and GetHistory for the others
+	// If prioritize is true, the queue items are ranked by weight, then by who reached their weight first, then by ID
+	// Otherwise they are sorted in the order they were queued
+	GetQueueItemsBySessionID(sessionID uint, prioritize *bool) ([]models.Queue, error)
+	// GetOrderedQueueItems retrieves all queue items in a session in the order chosen by the host of the session, numbering their positions
+	// Items the host pinned or moved come first, in the order the host placed them in
+	GetOrderedQueueItems(sessionID uint) ([]models.Queue, error)
+	// GetQueueItemsByUserID retrieves all queue items in a session by the user ID
+	// If prioritize is true, the queue items are ranked the same way as in GetQueueItemsBySessionID
+	GetQueueItemsByUserID(userID uint, prioritize *bool) ([]models.Queue, error)
+	// GetQueueItemsBySessionIDByUserID retrieves all queue items in a session by the session ID and user ID
+	// If prioritize is true, the queue items are ranked the same way as in GetQueueItemsBySessionID
+	GetQueueItemsBySessionIDByUserID(sessionID, userID uint, prioritize *bool) ([]models.Queue, error)
+	// GetQueueItem retrieves a queue item from the database by its ID, whatever its status
+	// Queue items are always returned with the metadata of their track, if it has been resolved
+	GetQueueItem(id uint) (*models.Queue, error)
+	// UpdateQueueItem validates and updates a queue item in the database
+	// The weight is derived from the votes on the queue item and the status only moves forward through
+	// PopNextQueueItem and FinishQueueItem, so neither is updated
+	UpdateQueueItem(queueItem *models.Queue) error
+	// PopNextQueueItem marks the item that is playing in a session as played and the top ranked queued item as now playing,
+	// returning the new now playing item, or ErrQueueEmpty if nothing is queued
+	PopNextQueueItem(sessionID uint, now time.Time) (*models.Queue, error)
+	// FinishQueueItem takes a queue item out of the queue with the given status: a now playing item can be played or skipped,
+	// a queued item can be removed
+	FinishQueueItem(id uint, status string, now time.Time) error
+	// RequeueQueueItem puts a now playing item back in the queue, for when it could not be played after all
+	RequeueQueueItem(id uint) error
+	// GetNowPlaying retrieves the queue item that is playing in a session
+	GetNowPlaying(sessionID uint) (*models.Queue, error)
+	// GetHistory retrieves the items that were played or skipped in a session, most recent first
+	// If limit is positive, at most limit items are returned
+	GetHistory(sessionID uint, limit int) ([]models.Queue, error)
+	// GetRemovedQueueItems retrieves the items of a user that were removed from a session's queue, most recent first,
+	// so the user can see the reason the host gave
+	GetRemovedQueueItems(sessionID, userID uint) ([]models.Queue, error)
+	// DeleteQueueItem deletes a queue item from the database by its ID
+	DeleteQueueItem(id uint) error
+}
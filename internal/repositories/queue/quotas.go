@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// QuotaActiveItems limits the number of items a user has queued or playing at once
+	QuotaActiveItems = "active_items"
+	// QuotaAddsPerHour limits the number of items a user adds within a rolling hour
+	QuotaAddsPerHour = "adds_per_hour"
+	// QuotaQueuedMinutes limits the total duration of the items a user has waiting in the queue
+	QuotaQueuedMinutes = "queued_minutes"
+)
+
+// quotaWindow is the length of the rolling window the adds per hour quota applies to
+const quotaWindow = time.Hour
+
+// ErrQuotaExceeded is matched by every QuotaError, for callers that only need to know a quota was hit
+var ErrQuotaExceeded = errors.New("queue quota exceeded")
+
+// QuotaError is returned when a user can not add an item to the queue because it would exceed one of the quotas of the session
+type QuotaError struct {
+	// Limit is the quota that was hit, one of QuotaActiveItems, QuotaAddsPerHour or QuotaQueuedMinutes
+	Limit string
+	// Max is the value of the quota, in items, adds or minutes depending on the limit
+	Max int
+	// Current is how much of the quota the user has used, in the same unit as Max
+	Current int
+	// RetryAt is when the user can add an item again, nil if it depends on the queue moving rather than on time
+	RetryAt *time.Time
+}
+
+func (e *QuotaError) Error() string {
+	switch e.Limit {
+	case QuotaActiveItems:
+		return fmt.Sprintf("user already has %d of at most %d items in the queue", e.Current, e.Max)
+	case QuotaAddsPerHour:
+		return fmt.Sprintf("user already added %d of at most %d items in the last hour", e.Current, e.Max)
+	case QuotaQueuedMinutes:
+		return fmt.Sprintf("user already has %d of at most %d minutes in the queue", e.Current, e.Max)
+	}
+	return ErrQuotaExceeded.Error()
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// checkQuotas checks that adding a queue item keeps its user within the quotas of the session. The duration of the
+// new item is taken from track, which is nil if the metadata of the track is unknown. The session must be locked by
+// the caller, so concurrent adds by the same user can not both pass the check.
+func checkQuotas(tx *gorm.DB, settings models.SessionSettings, queueItem *models.Queue, track *models.Track, now time.Time) error {
+	if settings.MaxActiveItems > 0 {
+		var active int64
+		err := tx.Model(&models.Queue{}).
+			Where("session_id = ? AND user_id = ? AND status IN ?", queueItem.SessionID, queueItem.UserID,
+				[]string{models.QueueStatusQueued, models.QueueStatusNowPlaying}).
+			Count(&active).Error
+		if err != nil {
+			return err
+		}
+		if int(active) >= settings.MaxActiveItems {
+			return &QuotaError{Limit: QuotaActiveItems, Max: settings.MaxActiveItems, Current: int(active)}
+		}
+	}
+
+	if settings.MaxAddsPerHour > 0 {
+		// Removed and deleted items still count, otherwise removing an item would hand out another add
+		var added []time.Time
+		err := tx.Unscoped().Model(&models.Queue{}).
+			Where("session_id = ? AND user_id = ? AND created_at > ?", queueItem.SessionID, queueItem.UserID, now.Add(-quotaWindow)).
+			Order("created_at DESC").Limit(settings.MaxAddsPerHour).
+			Pluck("created_at", &added).Error
+		if err != nil {
+			return err
+		}
+		if len(added) >= settings.MaxAddsPerHour {
+			// The user can add again once the oldest add that counts towards the quota leaves the window
+			retryAt := added[len(added)-1].Add(quotaWindow)
+			return &QuotaError{Limit: QuotaAddsPerHour, Max: settings.MaxAddsPerHour, Current: len(added), RetryAt: &retryAt}
+		}
+	}
+
+	if settings.MaxQueuedMinutes > 0 {
+		var queuedMs int64
+		err := tx.Model(&models.Queue{}).
+			Joins("JOIN tracks ON tracks.uri = queues.track_uri").
+			Where("queues.session_id = ? AND queues.user_id = ? AND queues.status = ?", queueItem.SessionID, queueItem.UserID, models.QueueStatusQueued).
+			Select("COALESCE(SUM(tracks.duration_ms), 0)").
+			Scan(&queuedMs).Error
+		if err != nil {
+			return err
+		}
+
+		var trackMs int64
+		if track != nil {
+			trackMs = int64(track.DurationMs)
+		}
+
+		max := int64(settings.MaxQueuedMinutes) * int64(time.Minute/time.Millisecond)
+		if queuedMs+trackMs > max {
+			return &QuotaError{Limit: QuotaQueuedMinutes, Max: settings.MaxQueuedMinutes, Current: int(queuedMs / int64(time.Minute/time.Millisecond))}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// TrackRuleExplicit keeps tracks with explicit lyrics out of the queue
+	TrackRuleExplicit = "explicit"
+	// TrackRuleMaxLength keeps tracks longer than the max track length of the session out of the queue
+	TrackRuleMaxLength = "max_length"
+)
+
+// ErrTrackNotAllowed is matched by every TrackRuleError, for callers that only need to know a track was refused by the rules of the session
+var ErrTrackNotAllowed = errors.New("track is not allowed in this session")
+
+// TrackRuleError is returned when a track can not be queued because it breaks one of the track rules of its session
+type TrackRuleError struct {
+	// Rule is the rule the track breaks, one of TrackRuleExplicit or TrackRuleMaxLength
+	Rule string
+	// MaxMinutes is the max track length of the session, only set for TrackRuleMaxLength
+	MaxMinutes int
+}
+
+func (e *TrackRuleError) Error() string {
+	switch e.Rule {
+	case TrackRuleExplicit:
+		return "tracks with explicit lyrics are not allowed in this session"
+	case TrackRuleMaxLength:
+		return fmt.Sprintf("tracks longer than %d minutes are not allowed in this session", e.MaxMinutes)
+	}
+	return ErrTrackNotAllowed.Error()
+}
+
+func (e *TrackRuleError) Is(target error) bool {
+	return target == ErrTrackNotAllowed
+}
+
+// checkTrackRules checks a track against the explicit filter and max track length of the session. A track whose
+// metadata is unknown is let through, rather than refusing every track while Spotify is unreachable.
+func checkTrackRules(settings models.SessionSettings, track *models.Track) error {
+	if track == nil {
+		return nil
+	}
+	if settings.ExplicitFilter && track.Explicit {
+		return &TrackRuleError{Rule: TrackRuleExplicit}
+	}
+	if settings.MaxTrackMinutes > 0 && time.Duration(track.DurationMs)*time.Millisecond > time.Duration(settings.MaxTrackMinutes)*time.Minute {
+		return &TrackRuleError{Rule: TrackRuleMaxLength, MaxMinutes: settings.MaxTrackMinutes}
+	}
+	return nil
+}
+
+// cachedTrack retrieves the cached metadata of a track, or nil if the track was never resolved
+func cachedTrack(tx *gorm.DB, uri string) (*models.Track, error) {
+	var track models.Track
+	result := tx.Where("uri = ?", uri).Limit(1).Find(&track)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &track, nil
+}
@@ -1,66 +1,262 @@
-package session
-
-import (
-	"garrettpfoy/orbit-api/internal/models"
-	"garrettpfoy/orbit-api/internal/services/validation"
-
-	"gorm.io/gorm"
-)
-
-type GormSessionRepository struct {
-	db *gorm.DB
-}
-
-func NewGormSessionRepository(db *gorm.DB) *GormSessionRepository {
-	return &GormSessionRepository{db: db}
-}
-
-func (r *GormSessionRepository) CreateSession(session *models.Session) error {
-	if err := validation.ValidateSession(*session); err != nil {
-		return err
-	}
-
-	return r.db.Create(session).Error
-}
-
-func (r *GormSessionRepository) GetSessions() ([]models.Session, error) {
-	var sessions []models.Session
-	err := r.db.Preload("Host").Preload("Users").Find(&sessions).Error
-	return sessions, err
-}
-
-func (r *GormSessionRepository) GetSession(id uint) (*models.Session, error) {
-	var session models.Session
-	err := r.db.Preload("Host").Preload("Users").First(&session, id).Error
-	return &session, err
-}
-
-func (r *GormSessionRepository) GetSessionByHostID(userID uint) (*models.Session, error) {
-	var session models.Session
-	err := r.db.Where("host_id = ?", userID).Preload("Host").Preload("Users").First(&session).Error
-	return &session, err
-}
-
-func (r *GormSessionRepository) GetUsersInSession(sessionID uint) ([]*models.User, error) {
-	var session models.Session
-	err := r.db.Preload("Users").First(&session, sessionID).Error
-	return session.Users, err
-}
-
-func (r *GormSessionRepository) GetSessionBySlug(slug string) (*models.Session, error) {
-	var session models.Session
-	err := r.db.Where("slug = ?", slug).Preload("Host").Preload("Users").First(&session).Error
-	return &session, err
-}
-
-func (r *GormSessionRepository) UpdateSession(session *models.Session) error {
-	if err := validation.ValidateSession(*session); err != nil {
-		return err
-	}
-
-	return r.db.Save(session).Error
-}
-
-func (r *GormSessionRepository) DeleteSession(id uint) error {
-	return r.db.Delete(&models.Session{}, id).Error
-}
+package session
+
+import (
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/services/slug"
+	"garrettpfoy/orbit-api/internal/services/validation"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrSessionEnded is returned when a session is looked up to be joined by its slug or join code, but it has ended
+var ErrSessionEnded = errors.New("the session has ended")
+
+// ErrInvalidTransition is returned when a session can not move from its current status to the requested one
+var ErrInvalidTransition = errors.New("invalid session status transition")
+
+// transitions lists the statuses a session can move to from each status. Ended is final.
+var transitions = map[string][]string{
+	models.SessionStatusOpen:   {models.SessionStatusPaused, models.SessionStatusEnded},
+	models.SessionStatusPaused: {models.SessionStatusOpen, models.SessionStatusEnded},
+}
+
+type GormSessionRepository struct {
+	db *gorm.DB
+}
+
+func NewGormSessionRepository(db *gorm.DB) *GormSessionRepository {
+	return &GormSessionRepository{db: db}
+}
+
+func (r *GormSessionRepository) CreateSession(session *models.Session) error {
+	// A session created without a slug gets a generated one, and a join code unless it already has one
+	if session.Slug == "" {
+		var err error
+		slugs := slug.NewService(r)
+		if session.JoinCode != nil {
+			session.Slug, err = slugs.Slug()
+		} else {
+			err = slugs.Assign(session, "")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := validation.ValidateSession(*session); err != nil {
+		return err
+	}
+
+	if session.StartedAt == nil {
+		now := time.Now()
+		session.StartedAt = &now
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+
+		// The host's Spotify token is linked to the session, so the session can be played and its token is kept
+		// fresh. A host who has not signed in with Spotify has no token, and the session is not played until they do
+		return tx.Model(&models.AccessToken{}).Where("user_id = ?", session.HostID).Update("session_id", session.ID).Error
+	})
+}
+
+func (r *GormSessionRepository) GetSessions() ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Preload("Host").Preload("Users").Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *GormSessionRepository) GetSession(id uint) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Preload("Host").Preload("Users").First(&session, id).Error
+	return &session, err
+}
+
+func (r *GormSessionRepository) GetSessionByHostID(userID uint) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("host_id = ?", userID).Preload("Host").Preload("Users").First(&session).Error
+	return &session, err
+}
+
+func (r *GormSessionRepository) GetUsersInSession(sessionID uint) ([]*models.User, error) {
+	var session models.Session
+	err := r.db.Preload("Users").First(&session, sessionID).Error
+	return session.Users, err
+}
+
+func (r *GormSessionRepository) GetSessionBySlug(slug string) (*models.Session, error) {
+	var session models.Session
+	if err := r.db.Where("slug = ?", slug).Preload("Host").Preload("Users").First(&session).Error; err != nil {
+		return nil, err
+	}
+	if session.Status == models.SessionStatusEnded {
+		return nil, ErrSessionEnded
+	}
+	return &session, nil
+}
+
+func (r *GormSessionRepository) GetSessionByJoinCode(joinCode string) (*models.Session, error) {
+	var session models.Session
+	if err := r.db.Where("join_code = ?", joinCode).Preload("Host").Preload("Users").First(&session).Error; err != nil {
+		return nil, err
+	}
+	if session.Status == models.SessionStatusEnded {
+		return nil, ErrSessionEnded
+	}
+	return &session, nil
+}
+
+func (r *GormSessionRepository) SlugTaken(slug string) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&models.Session{}).Where("slug = ?", slug).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *GormSessionRepository) JoinCodeTaken(joinCode string) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&models.Session{}).Where("join_code = ?", joinCode).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *GormSessionRepository) UpdateSession(session *models.Session) error {
+	if err := validation.ValidateSession(*session); err != nil {
+		return err
+	}
+
+	return r.db.Save(session).Error
+}
+
+func (r *GormSessionRepository) UpdateSessionSettings(id uint, settings models.SessionSettings) error {
+	if err := validation.ValidateSessionSettings(settings); err != nil {
+		return err
+	}
+
+	result := r.db.Model(&models.Session{}).Where("id = ?", id).Update("settings", settings)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormSessionRepository) PatchSessionSettings(id uint, patch func(current models.SessionSettings) (models.SessionSettings, error)) (models.SessionSettings, error) {
+	var patched models.SessionSettings
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Locking the session serializes patches, so two hosts patching different settings at once both keep their change
+		var session models.Session
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status", "settings").First(&session, id).Error; err != nil {
+			return err
+		}
+		if session.Status == models.SessionStatusEnded {
+			return ErrSessionEnded
+		}
+
+		var err error
+		if patched, err = patch(session.Settings); err != nil {
+			return err
+		}
+		return NewGormSessionRepository(tx).UpdateSessionSettings(id, patched)
+	})
+	if err != nil {
+		return models.SessionSettings{}, err
+	}
+	return patched, nil
+}
+
+func (r *GormSessionRepository) TransitionSession(id uint, status string, now time.Time) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, id).Error; err != nil {
+			return err
+		}
+
+		current := session.Status
+		if current == "" {
+			current = models.SessionStatusOpen
+		}
+		if !canTransition(current, status) {
+			return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, current, status)
+		}
+
+		updates := map[string]interface{}{"status": status}
+		if status == models.SessionStatusEnded {
+			// The join code is freed for other sessions. The slug stays taken so old links can not lead into another
+			// party, looking the session up by it reports ErrSessionEnded instead
+			updates["ended_at"] = now
+			updates["join_code"] = nil
+		}
+		return tx.Model(&session).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *GormSessionRepository) TouchSession(id uint, now time.Time) error {
+	return r.db.Model(&models.Session{}).Where("id = ?", id).Update("last_activity_at", now).Error
+}
+
+func (r *GormSessionRepository) GetPlayableSessions() ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("status IS NULL OR status <> ?", models.SessionStatusEnded).
+		Where("id IN (?)", r.db.Model(&models.AccessToken{}).Select("session_id").Where("session_id IS NOT NULL")).
+		Order("id").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *GormSessionRepository) GetIdleSessions(now time.Time) ([]models.Session, error) {
+	var candidates []models.Session
+	err := r.db.Where("status IS NULL OR status <> ?", models.SessionStatusEnded).
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// The timeout is part of the settings document of each session, so it is compared here rather than in the query
+	var idle []models.Session
+	for _, session := range candidates {
+		if session.Settings.IdleTimeoutMinutes <= 0 {
+			continue
+		}
+		if now.Sub(lastActive(session)) > time.Duration(session.Settings.IdleTimeoutMinutes)*time.Minute {
+			idle = append(idle, session)
+		}
+	}
+	return idle, nil
+}
+
+func (r *GormSessionRepository) DeleteSession(id uint) error {
+	return r.db.Delete(&models.Session{}, id).Error
+}
+
+// canTransition reports whether a session can move from one lifecycle status to another
+func canTransition(from, to string) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// lastActive is the last time anything happened in a session, falling back to when it started for a session with no activity yet
+func lastActive(session models.Session) time.Time {
+	if session.LastActivityAt != nil {
+		return *session.LastActivityAt
+	}
+	if session.StartedAt != nil {
+		return *session.StartedAt
+	}
+	return session.CreatedAt
+}
@@ -5,7 +5,9 @@ import (
 	"garrettpfoy/orbit-api/internal/models"
 	"garrettpfoy/orbit-api/internal/repositories/session"
 	"garrettpfoy/orbit-api/internal/services/encryption"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
@@ -20,7 +22,7 @@ func setupTestDB() (*gorm.DB, error) {
 
 	models.SetEncryptionService(encryption.NewEncryptionService("abcdefghijklmnopqrstuvwxyz123456"))
 
-	err = db.AutoMigrate(&models.Session{}, &models.User{})
+	err = db.AutoMigrate(&models.Session{}, &models.User{}, &models.AccessToken{})
 	if err != nil {
 		return nil, err
 	}
@@ -49,6 +51,26 @@ func TestCreateSession(t *testing.T) {
 	assert.Equal(t, session.Slug, createdSession.Slug)
 }
 
+func TestCreateSessionGeneratesSlug(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := session.NewGormSessionRepository(db)
+
+	generated := &models.Session{HostID: 1}
+	assert.NoError(t, repo.CreateSession(generated))
+	assert.NotEmpty(t, generated.Slug)
+	assert.NotNil(t, generated.JoinCode)
+
+	// A join code the session already has is kept
+	joinCode := "123456"
+	withJoinCode := &models.Session{HostID: 2, JoinCode: &joinCode}
+	assert.NoError(t, repo.CreateSession(withJoinCode))
+	assert.NotEmpty(t, withJoinCode.Slug)
+	assert.NotEqual(t, generated.Slug, withJoinCode.Slug)
+	assert.Equal(t, "123456", *withJoinCode.JoinCode)
+}
+
 func TestGetSessions(t *testing.T) {
 	db, err := setupTestDB()
 	assert.NoError(t, err)
@@ -160,6 +182,31 @@ func TestGetSessionBySlug(t *testing.T) {
 	assert.Equal(t, session.Slug, retrievedSession.Slug)
 }
 
+func TestGetSessionByJoinCode(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := session.NewGormSessionRepository(db)
+
+	joinCode := "482913"
+	session := &models.Session{
+		Slug:     "unique_slug",
+		JoinCode: &joinCode,
+		HostID:   1,
+		Host:     models.User{Model: gorm.Model{ID: 1}},
+	}
+
+	err = repo.CreateSession(session)
+	assert.NoError(t, err)
+
+	retrievedSession, err := repo.GetSessionByJoinCode(joinCode)
+	assert.NoError(t, err)
+	assert.Equal(t, session.ID, retrievedSession.ID)
+
+	_, err = repo.GetSessionByJoinCode("000000")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
 func TestUpdateSession(t *testing.T) {
 	db, err := setupTestDB()
 	assert.NoError(t, err)
@@ -208,3 +255,205 @@ func TestDeleteSession(t *testing.T) {
 	assert.Error(t, err)
 	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
 }
+
+func TestUpdateSessionSettings(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := session.NewGormSessionRepository(db)
+
+	created := &models.Session{
+		Slug:   "unique_slug",
+		HostID: 1,
+		Host:   models.User{Model: gorm.Model{ID: 1}},
+	}
+
+	err = repo.CreateSession(created)
+	assert.NoError(t, err)
+
+	// A session created without settings starts out with the defaults
+	retrievedSession, err := repo.GetSession(created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.DefaultSessionSettings(), retrievedSession.Settings)
+
+	// Zero values are stored as they are
+	settings := models.DefaultSessionSettings()
+	settings.VoteCooldownSeconds = 0
+	settings.ExplicitFilter = true
+	err = repo.UpdateSessionSettings(created.ID, settings)
+	assert.NoError(t, err)
+
+	retrievedSession, err = repo.GetSession(created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, settings, retrievedSession.Settings)
+
+	settings.SkipThreshold = 2
+	err = repo.UpdateSessionSettings(created.ID, settings)
+	assert.EqualError(t, err, "skip threshold must be between 0 and 1")
+
+	err = repo.UpdateSessionSettings(999, models.DefaultSessionSettings())
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestPatchSessionSettings(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	// Every connection to an in-memory database opens a new, empty database
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	repo := session.NewGormSessionRepository(db)
+	created := &models.Session{Slug: "unique_slug", HostID: 1}
+	assert.NoError(t, repo.CreateSession(created))
+
+	// Concurrent patches each see the settings the one before them stored, so no change is lost
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.PatchSessionSettings(created.ID, func(current models.SessionSettings) (models.SessionSettings, error) {
+				current.VoteBudget++
+				return current, nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	retrievedSession, err := repo.GetSession(created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.DefaultVoteBudget+20, retrievedSession.Settings.VoteBudget)
+
+	// An error from the patch leaves the settings alone
+	_, err = repo.PatchSessionSettings(created.ID, func(current models.SessionSettings) (models.SessionSettings, error) {
+		return current, errors.New("bad patch")
+	})
+	assert.EqualError(t, err, "bad patch")
+
+	_, err = repo.TransitionSession(created.ID, models.SessionStatusEnded, time.Now())
+	assert.NoError(t, err)
+	_, err = repo.PatchSessionSettings(created.ID, func(current models.SessionSettings) (models.SessionSettings, error) {
+		return current, nil
+	})
+	assert.ErrorIs(t, err, session.ErrSessionEnded)
+}
+
+func TestTransitionSession(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := session.NewGormSessionRepository(db)
+
+	joinCode := "482913"
+	created := &models.Session{
+		Slug:     "unique_slug",
+		JoinCode: &joinCode,
+		HostID:   1,
+		Host:     models.User{Model: gorm.Model{ID: 1}},
+	}
+
+	err = repo.CreateSession(created)
+	assert.NoError(t, err)
+	assert.NotNil(t, created.StartedAt)
+
+	now := time.Now()
+
+	paused, err := repo.TransitionSession(created.ID, models.SessionStatusPaused, now)
+	assert.NoError(t, err)
+	assert.Equal(t, models.SessionStatusPaused, paused.Status)
+
+	_, err = repo.TransitionSession(created.ID, models.SessionStatusPaused, now)
+	assert.ErrorIs(t, err, session.ErrInvalidTransition)
+
+	resumed, err := repo.TransitionSession(created.ID, models.SessionStatusOpen, now)
+	assert.NoError(t, err)
+	assert.Equal(t, models.SessionStatusOpen, resumed.Status)
+
+	ended, err := repo.TransitionSession(created.ID, models.SessionStatusEnded, now)
+	assert.NoError(t, err)
+	assert.Equal(t, models.SessionStatusEnded, ended.Status)
+	assert.NotNil(t, ended.EndedAt)
+
+	// Ending a session frees its join code, and its slug can no longer be used to join it
+	_, err = repo.GetSessionByJoinCode(joinCode)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = repo.GetSessionBySlug("unique_slug")
+	assert.ErrorIs(t, err, session.ErrSessionEnded)
+
+	// An ended session can not be reopened
+	_, err = repo.TransitionSession(created.ID, models.SessionStatusOpen, now)
+	assert.ErrorIs(t, err, session.ErrInvalidTransition)
+
+	_, err = repo.TransitionSession(999, models.SessionStatusEnded, now)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestGetPlayableSessions(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := session.NewGormSessionRepository(db)
+
+	// Hosts who signed in with Spotify have a token, which is linked to the sessions they create
+	newSession := func(slug string, hostID uint, signedInWithSpotify bool) *models.Session {
+		if signedInWithSpotify {
+			token := &models.AccessToken{UserID: hostID, AccessToken: slug, RefreshToken: slug, ExpiryTime: time.Now().Add(time.Hour)}
+			assert.NoError(t, db.Create(token).Error)
+		}
+		created := &models.Session{Slug: slug, HostID: hostID, Host: models.User{Model: gorm.Model{ID: hostID}}}
+		assert.NoError(t, repo.CreateSession(created))
+		return created
+	}
+
+	playable := newSession("playable", 1, true)
+	newSession("no-token", 2, false)
+	ended := newSession("ended", 3, true)
+	_, err = repo.TransitionSession(ended.ID, models.SessionStatusEnded, time.Now())
+	assert.NoError(t, err)
+
+	sessions, err := repo.GetPlayableSessions()
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, playable.ID, sessions[0].ID)
+}
+
+func TestGetIdleSessions(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := session.NewGormSessionRepository(db)
+
+	now := time.Now()
+	startedAt := now.Add(-3 * time.Hour)
+
+	newSession := func(slug string, hostID uint, idleTimeoutMinutes int) *models.Session {
+		settings := models.DefaultSessionSettings()
+		settings.IdleTimeoutMinutes = idleTimeoutMinutes
+		created := &models.Session{
+			Slug:      slug,
+			HostID:    hostID,
+			Host:      models.User{Model: gorm.Model{ID: hostID}},
+			StartedAt: &startedAt,
+			Settings:  settings,
+		}
+		assert.NoError(t, repo.CreateSession(created))
+		return created
+	}
+
+	idle := newSession("idle", 1, 120)
+	active := newSession("active", 2, 120)
+	ended := newSession("ended", 3, 120)
+	newSession("disabled", 4, 0)
+
+	assert.NoError(t, repo.TouchSession(active.ID, now.Add(-time.Hour)))
+	_, err = repo.TransitionSession(ended.ID, models.SessionStatusEnded, now)
+	assert.NoError(t, err)
+
+	sessions, err := repo.GetIdleSessions(now)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, idle.ID, sessions[0].ID)
+}
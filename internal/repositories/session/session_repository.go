@@ -1,22 +1,44 @@
-package session
-
-import (
-	"garrettpfoy/orbit-api/internal/models"
-)
-
-type SessionRepository interface {
-	// CreateSession validates a session and creates a new session in the database
-	CreateSession(session *models.Session) error
-	// GetSessions retrieves all sessions from the database
-	GetSessions() ([]models.Session, error)
-	// GetSession retrieves a session from the database by its ID
-	GetSession(id uint) (*models.Session, error)
-	// GetSessionByUserID retrieves a session from the database by its user ID, if it exists
-	GetSessionByHostID(userID uint) (*models.Session, error)
-	// GetUsersInSession retrieves all users in a session by the session ID
-	GetUsersInSession(sessionID uint) ([]models.User, error)
-	// GetSessionBySlug retrieves a session from the database by its slug
-	UpdateSession(session *models.Session) error
-	// DeleteSession deletes a session from the database by its ID
-	DeleteSession(id uint) error
-}
+package session
+
+import (
+	"garrettpfoy/orbit-api/internal/models"
+	"time"
+)
+
+type SessionRepository interface {
+	// CreateSession validates a session and creates a new session in the database, generating its slug and join code if it has no slug,
+	// and links the host's access token to it
+	CreateSession(session *models.Session) error
+	// GetSessions retrieves all sessions from the database
+	GetSessions() ([]models.Session, error)
+	// GetSession retrieves a session from the database by its ID
+	GetSession(id uint) (*models.Session, error)
+	// GetSessionByUserID retrieves a session from the database by its user ID, if it exists
+	GetSessionByHostID(userID uint) (*models.Session, error)
+	// GetUsersInSession retrieves all users in a session by the session ID
+	GetUsersInSession(sessionID uint) ([]*models.User, error)
+	// GetSessionBySlug retrieves a session from the database by its slug to join it, returning ErrSessionEnded if it has ended
+	GetSessionBySlug(slug string) (*models.Session, error)
+	// GetSessionByJoinCode retrieves a session from the database by its join code to join it, returning ErrSessionEnded if it has ended
+	GetSessionByJoinCode(joinCode string) (*models.Session, error)
+	// SlugTaken reports whether any session, including ended and deleted ones, has the slug
+	SlugTaken(slug string) (bool, error)
+	// JoinCodeTaken reports whether any session, including ended and deleted ones, has the join code
+	JoinCodeTaken(joinCode string) (bool, error)
+	// UpdateSession validates a session and updates it in the database
+	UpdateSession(session *models.Session) error
+	// UpdateSessionSettings validates the settings of a session and replaces its settings document with them
+	UpdateSessionSettings(id uint, settings models.SessionSettings) error
+	// PatchSessionSettings applies a patch to the current settings of a session and stores the result, with the session locked so concurrent patches are not lost. It returns ErrSessionEnded if the session has ended
+	PatchSessionSettings(id uint, patch func(current models.SessionSettings) (models.SessionSettings, error)) (models.SessionSettings, error)
+	// TransitionSession moves a session to a new lifecycle status, returning ErrInvalidTransition if it can not get there from its current status
+	TransitionSession(id uint, status string, now time.Time) (*models.Session, error)
+	// TouchSession records playback or voting activity in a session
+	TouchSession(id uint, now time.Time) error
+	// GetPlayableSessions retrieves all sessions that have not ended and have their host's access token linked, so their queue can be played
+	GetPlayableSessions() ([]models.Session, error)
+	// GetIdleSessions retrieves all sessions that are not ended and have been idle for longer than their idle timeout
+	GetIdleSessions(now time.Time) ([]models.Session, error)
+	// DeleteSession deletes a session from the database by its ID
+	DeleteSession(id uint) error
+}
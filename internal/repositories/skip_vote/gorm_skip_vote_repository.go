@@ -0,0 +1,63 @@
+package skip_vote
+
+import (
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/services/validation"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GormSkipVoteRepository struct {
+	db *gorm.DB
+}
+
+func NewGormSkipVoteRepository(db *gorm.DB) *GormSkipVoteRepository {
+	return &GormSkipVoteRepository{db: db}
+}
+
+func (r *GormSkipVoteRepository) CastSkipVote(skipVote *models.SkipVote) error {
+	if err := validation.ValidateSkipVote(*skipVote); err != nil {
+		return fmt.Errorf("error validating skip vote: %w", err)
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Locking the queue item keeps it from finishing while the vote is cast
+		var queueItem models.Queue
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&queueItem, skipVote.QueueID).Error; err != nil {
+			return err
+		}
+		if queueItem.Status != models.QueueStatusNowPlaying {
+			return ErrNotPlaying
+		}
+
+		var existing int64
+		if err := tx.Model(&models.SkipVote{}).Where("user_id = ? AND queue_id = ?", skipVote.UserID, skipVote.QueueID).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrAlreadyVotedToSkip
+		}
+
+		return tx.Omit("User", "Queue").Create(skipVote).Error
+	})
+}
+
+func (r *GormSkipVoteRepository) RetractSkipVote(userID, queueID uint) error {
+	// Skip votes are deleted for good, so the unique index lets the user vote to skip again
+	result := r.db.Unscoped().Where("user_id = ? AND queue_id = ?", userID, queueID).Delete(&models.SkipVote{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormSkipVoteRepository) CountSkipVotes(queueID uint) (int, error) {
+	var count int64
+	err := r.db.Model(&models.SkipVote{}).Where("queue_id = ?", queueID).Count(&count).Error
+	return int(count), err
+}
@@ -0,0 +1,95 @@
+package skip_vote_test
+
+import (
+	"errors"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/skip_vote"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AutoMigrate(&models.SkipVote{}, &models.Queue{}, &models.Session{}, &models.User{}, &models.Track{})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func createQueueItem(t *testing.T, db *gorm.DB, status string) *models.Queue {
+	queueItem := &models.Queue{
+		TrackURI:  "spotify:track:123",
+		SessionID: 1,
+		UserID:    1,
+		Status:    status,
+	}
+	err := db.Create(queueItem).Error
+	assert.NoError(t, err)
+	return queueItem
+}
+
+func TestCastSkipVote(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := skip_vote.NewGormSkipVoteRepository(db)
+	queueItem := createQueueItem(t, db, models.QueueStatusNowPlaying)
+
+	err = repo.CastSkipVote(&models.SkipVote{UserID: 1, QueueID: queueItem.ID})
+	assert.NoError(t, err)
+	err = repo.CastSkipVote(&models.SkipVote{UserID: 2, QueueID: queueItem.ID})
+	assert.NoError(t, err)
+
+	err = repo.CastSkipVote(&models.SkipVote{UserID: 1, QueueID: queueItem.ID})
+	assert.True(t, errors.Is(err, skip_vote.ErrAlreadyVotedToSkip))
+
+	count, err := repo.CountSkipVotes(queueItem.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestCastSkipVoteNotPlaying(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := skip_vote.NewGormSkipVoteRepository(db)
+	queueItem := createQueueItem(t, db, models.QueueStatusQueued)
+
+	err = repo.CastSkipVote(&models.SkipVote{UserID: 1, QueueID: queueItem.ID})
+	assert.True(t, errors.Is(err, skip_vote.ErrNotPlaying))
+
+	err = repo.CastSkipVote(&models.SkipVote{UserID: 1, QueueID: queueItem.ID + 1})
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func TestRetractSkipVote(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := skip_vote.NewGormSkipVoteRepository(db)
+	queueItem := createQueueItem(t, db, models.QueueStatusNowPlaying)
+
+	err = repo.CastSkipVote(&models.SkipVote{UserID: 1, QueueID: queueItem.ID})
+	assert.NoError(t, err)
+	err = repo.RetractSkipVote(1, queueItem.ID)
+	assert.NoError(t, err)
+	err = repo.RetractSkipVote(1, queueItem.ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	count, err := repo.CountSkipVotes(queueItem.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// A retracted skip vote can be cast again
+	err = repo.CastSkipVote(&models.SkipVote{UserID: 1, QueueID: queueItem.ID})
+	assert.NoError(t, err)
+}
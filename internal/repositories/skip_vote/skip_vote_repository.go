@@ -0,0 +1,22 @@
+package skip_vote
+
+import (
+	"errors"
+	"garrettpfoy/orbit-api/internal/models"
+)
+
+// ErrAlreadyVotedToSkip is returned when a user votes to skip a queue item they have already voted to skip
+var ErrAlreadyVotedToSkip = errors.New("user has already voted to skip this queue item")
+
+// ErrNotPlaying is returned when a user votes to skip a queue item that is not playing
+var ErrNotPlaying = errors.New("only the now playing queue item can be skipped")
+
+type SkipVoteRepository interface {
+	// CastSkipVote validates and creates a new skip vote on the now playing queue item, returning ErrNotPlaying if the queue item
+	// is not playing and ErrAlreadyVotedToSkip if the user already voted to skip it
+	CastSkipVote(skipVote *models.SkipVote) error
+	// RetractSkipVote removes the skip vote of a user on a queue item
+	RetractSkipVote(userID, queueID uint) error
+	// CountSkipVotes counts the skip votes on a queue item
+	CountSkipVotes(queueID uint) (int, error)
+}
@@ -0,0 +1,44 @@
+package track
+
+import (
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/services/validation"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GormTrackRepository struct {
+	db *gorm.DB
+}
+
+func NewGormTrackRepository(db *gorm.DB) *GormTrackRepository {
+	return &GormTrackRepository{db: db}
+}
+
+func (r *GormTrackRepository) GetTrack(uri string) (*models.Track, error) {
+	var track models.Track
+	err := r.db.Where("uri = ?", uri).First(&track).Error
+	return &track, err
+}
+
+func (r *GormTrackRepository) GetTracks(uris []string) ([]models.Track, error) {
+	var tracks []models.Track
+	if len(uris) == 0 {
+		return tracks, nil
+	}
+	err := r.db.Where("uri IN ?", uris).Find(&tracks).Error
+	return tracks, err
+}
+
+func (r *GormTrackRepository) SaveTrack(track *models.Track) error {
+	if err := validation.ValidateTrack(*track); err != nil {
+		return fmt.Errorf("error validating track: %w", err)
+	}
+
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "uri"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "name", "artists", "album", "artwork_url", "duration_ms", "explicit", "fetched_at"}),
+	}).Create(track).Error
+}
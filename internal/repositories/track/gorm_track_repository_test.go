@@ -0,0 +1,121 @@
+package track_test
+
+import (
+	"errors"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/track"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AutoMigrate(&models.Track{})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func TestSaveTrack(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := track.NewGormTrackRepository(db)
+
+	newTrack := &models.Track{
+		URI:        "spotify:track:123",
+		Name:       "Harvest Moon",
+		Artists:    "Neil Young",
+		DurationMs: 300000,
+		FetchedAt:  time.Now(),
+	}
+
+	err = repo.SaveTrack(newTrack)
+	assert.NoError(t, err)
+
+	var createdTrack models.Track
+	err = db.Where("uri = ?", newTrack.URI).First(&createdTrack).Error
+	assert.NoError(t, err)
+	assert.Equal(t, newTrack.Name, createdTrack.Name)
+	assert.Equal(t, newTrack.Artists, createdTrack.Artists)
+	assert.Equal(t, newTrack.DurationMs, createdTrack.DurationMs)
+}
+
+func TestSaveTrackReplacesExisting(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := track.NewGormTrackRepository(db)
+
+	err = repo.SaveTrack(&models.Track{URI: "spotify:track:123", Name: "Old Name", DurationMs: 1000, FetchedAt: time.Now().Add(-time.Hour)})
+	assert.NoError(t, err)
+
+	fetchedAt := time.Now()
+	err = repo.SaveTrack(&models.Track{URI: "spotify:track:123", Name: "New Name", DurationMs: 2000, FetchedAt: fetchedAt})
+	assert.NoError(t, err)
+
+	var tracks []models.Track
+	err = db.Find(&tracks).Error
+	assert.NoError(t, err)
+	assert.Len(t, tracks, 1)
+	assert.Equal(t, "New Name", tracks[0].Name)
+	assert.Equal(t, 2000, tracks[0].DurationMs)
+	assert.WithinDuration(t, fetchedAt, tracks[0].FetchedAt, time.Second)
+}
+
+func TestSaveInvalidTrack(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := track.NewGormTrackRepository(db)
+
+	err = repo.SaveTrack(&models.Track{URI: "spotify:track:123", DurationMs: 1000, FetchedAt: time.Now()})
+	assert.Error(t, err)
+}
+
+func TestGetTrack(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := track.NewGormTrackRepository(db)
+
+	err = repo.SaveTrack(&models.Track{URI: "spotify:track:123", Name: "Harvest Moon", DurationMs: 300000, FetchedAt: time.Now()})
+	assert.NoError(t, err)
+
+	retrievedTrack, err := repo.GetTrack("spotify:track:123")
+	assert.NoError(t, err)
+	assert.Equal(t, "Harvest Moon", retrievedTrack.Name)
+
+	_, err = repo.GetTrack("spotify:track:456")
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func TestGetTracks(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := track.NewGormTrackRepository(db)
+
+	for _, uri := range []string{"spotify:track:1", "spotify:track:2", "spotify:track:3"} {
+		err = repo.SaveTrack(&models.Track{URI: uri, Name: uri, DurationMs: 1000, FetchedAt: time.Now()})
+		assert.NoError(t, err)
+	}
+
+	tracks, err := repo.GetTracks([]string{"spotify:track:1", "spotify:track:3", "spotify:track:4"})
+	assert.NoError(t, err)
+	assert.Len(t, tracks, 2)
+
+	tracks, err = repo.GetTracks(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, tracks)
+}
@@ -0,0 +1,14 @@
+package track
+
+import (
+	"garrettpfoy/orbit-api/internal/models"
+)
+
+type TrackRepository interface {
+	// GetTrack retrieves the cached metadata of a track from the database by its URI
+	GetTrack(uri string) (*models.Track, error)
+	// GetTracks retrieves the cached metadata of every track in the given list of URIs that has been cached
+	GetTracks(uris []string) ([]models.Track, error)
+	// SaveTrack validates and creates or replaces the cached metadata of a track in the database
+	SaveTrack(track *models.Track) error
+}
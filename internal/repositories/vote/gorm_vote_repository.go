@@ -0,0 +1,141 @@
+package vote
+
+import (
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/services/validation"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GormVoteRepository struct {
+	db *gorm.DB
+}
+
+func NewGormVoteRepository(db *gorm.DB) *GormVoteRepository {
+	return &GormVoteRepository{db: db}
+}
+
+func (r *GormVoteRepository) CastVote(vote *models.Vote) error {
+	if err := validation.ValidateVote(*vote); err != nil {
+		return fmt.Errorf("error validating vote: %w", err)
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockQueueItem(tx, vote.QueueID); err != nil {
+			return err
+		}
+
+		var existing models.Vote
+		result := tx.Unscoped().Where("user_id = ? AND queue_id = ?", vote.UserID, vote.QueueID).Limit(1).Find(&existing)
+		switch {
+		case result.Error != nil:
+			return result.Error
+		case result.RowsAffected == 0:
+			if err := tx.Omit("User", "Queue").Create(vote).Error; err != nil {
+				return err
+			}
+		case existing.DeletedAt.Valid:
+			// The unique index still covers retracted votes, so they are restored instead of recreated
+			if err := tx.Unscoped().Model(&existing).Updates(map[string]interface{}{"direction": vote.Direction, "deleted_at": nil}).Error; err != nil {
+				return err
+			}
+			vote.Model = existing.Model
+			vote.DeletedAt = gorm.DeletedAt{}
+		default:
+			return ErrAlreadyVoted
+		}
+
+		return recomputeWeight(tx, vote.QueueID)
+	})
+}
+
+func (r *GormVoteRepository) ChangeVote(userID, queueID uint, direction int) (*models.Vote, error) {
+	if err := validation.ValidateVote(models.Vote{UserID: userID, QueueID: queueID, Direction: direction}); err != nil {
+		return nil, fmt.Errorf("error validating vote: %w", err)
+	}
+
+	var vote models.Vote
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockQueueItem(tx, queueID); err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ? AND queue_id = ?", userID, queueID).First(&vote).Error; err != nil {
+			return err
+		}
+		if vote.Direction == direction {
+			return nil
+		}
+
+		if err := tx.Model(&vote).Update("direction", direction).Error; err != nil {
+			return err
+		}
+		return recomputeWeight(tx, queueID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &vote, nil
+}
+
+func (r *GormVoteRepository) RetractVote(userID, queueID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockQueueItem(tx, queueID); err != nil {
+			return err
+		}
+
+		result := tx.Where("user_id = ? AND queue_id = ?", userID, queueID).Delete(&models.Vote{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return recomputeWeight(tx, queueID)
+	})
+}
+
+func (r *GormVoteRepository) GetVote(userID, queueID uint) (*models.Vote, error) {
+	var vote models.Vote
+	err := r.db.Where("user_id = ? AND queue_id = ?", userID, queueID).First(&vote).Error
+	return &vote, err
+}
+
+func (r *GormVoteRepository) GetVotesByQueueID(queueID uint) ([]models.Vote, error) {
+	var votes []models.Vote
+	err := r.db.Where("queue_id = ?", queueID).Find(&votes).Error
+	return votes, err
+}
+
+// lockQueueItem locks the row of a queue item until the transaction ends, which serializes every vote on it.
+// Databases without row locks (SQLite) serialize write transactions instead.
+func lockQueueItem(tx *gorm.DB, queueID uint) error {
+	var queueItem models.Queue
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&queueItem, queueID).Error
+}
+
+// recomputeWeight sets the weight of a queue item to the sum of its active votes. The sum is recomputed
+// rather than incremented so the weight can never drift from the votes it is derived from. When the weight
+// changes, the time it was reached is recorded so ties are ranked by who reached the weight first.
+func recomputeWeight(tx *gorm.DB, queueID uint) error {
+	var queueItem models.Queue
+	if err := tx.Select("id", "weight").First(&queueItem, queueID).Error; err != nil {
+		return err
+	}
+
+	var weight int
+	if err := tx.Model(&models.Vote{}).Select("COALESCE(SUM(direction), 0)").Where("queue_id = ?", queueID).Scan(&weight).Error; err != nil {
+		return err
+	}
+	if weight == queueItem.Weight {
+		return nil
+	}
+
+	return tx.Model(&models.Queue{}).Where("id = ?", queueID).Updates(map[string]interface{}{
+		"weight":            weight,
+		"weight_reached_at": time.Now(),
+	}).Error
+}
@@ -0,0 +1,208 @@
+package vote_test
+
+import (
+	"errors"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/vote"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection to an in-memory database opens a new, empty database
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	err = db.AutoMigrate(&models.Vote{}, &models.Queue{}, &models.Session{}, &models.User{}, &models.Track{})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func createQueueItem(t *testing.T, db *gorm.DB) *models.Queue {
+	queueItem := &models.Queue{
+		TrackURI:  "spotify:track:123",
+		SessionID: 1,
+		UserID:    1,
+	}
+	err := db.Create(queueItem).Error
+	assert.NoError(t, err)
+	return queueItem
+}
+
+func queueItemWeight(t *testing.T, db *gorm.DB, queueID uint) int {
+	var queueItem models.Queue
+	err := db.First(&queueItem, queueID).Error
+	assert.NoError(t, err)
+	return queueItem.Weight
+}
+
+func TestCastVote(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := vote.NewGormVoteRepository(db)
+	queueItem := createQueueItem(t, db)
+
+	err = repo.CastVote(&models.Vote{UserID: 1, QueueID: queueItem.ID, Direction: models.VoteUp})
+	assert.NoError(t, err)
+	err = repo.CastVote(&models.Vote{UserID: 2, QueueID: queueItem.ID, Direction: models.VoteUp})
+	assert.NoError(t, err)
+	err = repo.CastVote(&models.Vote{UserID: 3, QueueID: queueItem.ID, Direction: models.VoteDown})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, queueItemWeight(t, db, queueItem.ID))
+}
+
+func TestCastVoteTwice(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := vote.NewGormVoteRepository(db)
+	queueItem := createQueueItem(t, db)
+
+	err = repo.CastVote(&models.Vote{UserID: 1, QueueID: queueItem.ID, Direction: models.VoteUp})
+	assert.NoError(t, err)
+
+	err = repo.CastVote(&models.Vote{UserID: 1, QueueID: queueItem.ID, Direction: models.VoteUp})
+	assert.True(t, errors.Is(err, vote.ErrAlreadyVoted))
+	assert.Equal(t, 1, queueItemWeight(t, db, queueItem.ID))
+}
+
+func TestCastInvalidVote(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := vote.NewGormVoteRepository(db)
+	queueItem := createQueueItem(t, db)
+
+	err = repo.CastVote(&models.Vote{UserID: 1, QueueID: queueItem.ID, Direction: 10})
+	assert.Error(t, err)
+	assert.Equal(t, 0, queueItemWeight(t, db, queueItem.ID))
+}
+
+func TestCastVoteOnMissingQueueItem(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := vote.NewGormVoteRepository(db)
+
+	err = repo.CastVote(&models.Vote{UserID: 1, QueueID: 42, Direction: models.VoteUp})
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func TestChangeVote(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := vote.NewGormVoteRepository(db)
+	queueItem := createQueueItem(t, db)
+
+	err = repo.CastVote(&models.Vote{UserID: 1, QueueID: queueItem.ID, Direction: models.VoteUp})
+	assert.NoError(t, err)
+
+	changedVote, err := repo.ChangeVote(1, queueItem.ID, models.VoteDown)
+	assert.NoError(t, err)
+	assert.Equal(t, models.VoteDown, changedVote.Direction)
+	assert.Equal(t, -1, queueItemWeight(t, db, queueItem.ID))
+
+	_, err = repo.ChangeVote(2, queueItem.ID, models.VoteDown)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func TestRetractVote(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := vote.NewGormVoteRepository(db)
+	queueItem := createQueueItem(t, db)
+
+	err = repo.CastVote(&models.Vote{UserID: 1, QueueID: queueItem.ID, Direction: models.VoteUp})
+	assert.NoError(t, err)
+
+	err = repo.RetractVote(1, queueItem.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, queueItemWeight(t, db, queueItem.ID))
+
+	_, err = repo.GetVote(1, queueItem.ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	err = repo.RetractVote(1, queueItem.ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func TestCastVoteAfterRetracting(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := vote.NewGormVoteRepository(db)
+	queueItem := createQueueItem(t, db)
+
+	err = repo.CastVote(&models.Vote{UserID: 1, QueueID: queueItem.ID, Direction: models.VoteUp})
+	assert.NoError(t, err)
+	err = repo.RetractVote(1, queueItem.ID)
+	assert.NoError(t, err)
+
+	recastVote := &models.Vote{UserID: 1, QueueID: queueItem.ID, Direction: models.VoteDown}
+	err = repo.CastVote(recastVote)
+	assert.NoError(t, err)
+	assert.NotZero(t, recastVote.ID)
+	assert.Equal(t, -1, queueItemWeight(t, db, queueItem.ID))
+
+	votes, err := repo.GetVotesByQueueID(queueItem.ID)
+	assert.NoError(t, err)
+	assert.Len(t, votes, 1)
+	assert.Equal(t, models.VoteDown, votes[0].Direction)
+}
+
+func TestConcurrentVotes(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	repo := vote.NewGormVoteRepository(db)
+	queueItem := createQueueItem(t, db)
+
+	// Every user votes twice at the same time, only one of the two may count
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for userID := uint(1); userID <= 20; userID++ {
+		for attempt := 0; attempt < 2; attempt++ {
+			wg.Add(1)
+			userID := userID
+			go func() {
+				defer wg.Done()
+				err := repo.CastVote(&models.Vote{UserID: userID, QueueID: queueItem.ID, Direction: models.VoteUp})
+				if errors.Is(err, vote.ErrAlreadyVoted) {
+					return
+				}
+				assert.NoError(t, err)
+
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}()
+		}
+	}
+	wg.Wait()
+
+	assert.Equal(t, 20, accepted)
+	votes, err := repo.GetVotesByQueueID(queueItem.ID)
+	assert.NoError(t, err)
+	assert.Len(t, votes, 20)
+	assert.Equal(t, 20, queueItemWeight(t, db, queueItem.ID))
+}
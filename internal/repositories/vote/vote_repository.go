@@ -0,0 +1,25 @@
+package vote
+
+import (
+	"errors"
+	"garrettpfoy/orbit-api/internal/models"
+)
+
+// ErrAlreadyVoted is returned when a user casts a vote on a queue item they have already voted on
+var ErrAlreadyVoted = errors.New("user has already voted on this queue item")
+
+// Every operation that changes a vote recomputes the weight of its queue item in the same transaction,
+// while holding a lock on the queue item, so concurrent votes never lose updates
+type VoteRepository interface {
+	// CastVote validates and creates a new vote, returning ErrAlreadyVoted if the user has an active vote on the queue item
+	// A vote the user retracted earlier is restored with the new direction
+	CastVote(vote *models.Vote) error
+	// ChangeVote changes the direction of the active vote of a user on a queue item
+	ChangeVote(userID, queueID uint, direction int) (*models.Vote, error)
+	// RetractVote removes the active vote of a user on a queue item
+	RetractVote(userID, queueID uint) error
+	// GetVote retrieves the active vote of a user on a queue item
+	GetVote(userID, queueID uint) (*models.Vote, error)
+	// GetVotesByQueueID retrieves all active votes on a queue item
+	GetVotesByQueueID(queueID uint) ([]models.Vote, error)
+}
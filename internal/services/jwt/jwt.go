@@ -49,6 +49,20 @@ func CreateJWT(userID string, duration time.Duration, secret []byte) (string, er
 // The function returns an error if the JWT is not valid, otherwise,
 // it returns nil.
 func VerifyJWT(tokenString string, secret []byte) error {
+	_, err := ParseJWT(tokenString, secret)
+	return err
+}
+
+// ParseJWT verifies the provided JWT token using the given secret key and
+// returns the ID of the user it was issued to.
+//
+// Parameters:
+//   - tokenString: The JWT token to parse.
+//   - secret: The secret key the token was signed with.
+//
+// Returns:
+//   - string: The ID of the user, as passed to CreateJWT.
+func ParseJWT(tokenString string, secret []byte) (string, error) {
 	// Parse the token
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Make sure that the token's signing method is what we expect
@@ -59,23 +73,29 @@ func VerifyJWT(tokenString string, secret []byte) error {
 	})
 
 	if err != nil {
-		return fmt.Errorf("failed to parse JWT token: %w", err)
+		return "", fmt.Errorf("failed to parse JWT token: %w", err)
 	}
 
 	// Validate the token and its claims
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		// Check token expiration
-		if exp, ok := claims["exp"].(float64); ok {
-			if time.Unix(int64(exp), 0).Before(time.Now()) {
-				return fmt.Errorf("token has expired")
-			}
-		} else {
-			return fmt.Errorf("token does not contain an exp claim")
-		}
-		return nil
-	} else {
-		return fmt.Errorf("invalid token")
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return "", fmt.Errorf("invalid token")
+	}
+
+	// Check token expiration
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return "", fmt.Errorf("token does not contain an exp claim")
+	}
+	if time.Unix(int64(exp), 0).Before(time.Now()) {
+		return "", fmt.Errorf("token has expired")
+	}
+
+	userID, ok := claims["id"].(string)
+	if !ok || userID == "" {
+		return "", fmt.Errorf("token does not contain an id claim")
 	}
+	return userID, nil
 }
 
 // ReturnJWT sets the JWT cookie and additional headers based on the provided parameters.
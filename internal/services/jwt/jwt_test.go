@@ -52,6 +52,62 @@ func TestVerifyJWT(t *testing.T) {
 	assert.Contains(t, err.Error(), "failed to parse JWT token")
 }
 
+func TestParseJWT(t *testing.T) {
+	secret := []byte("my-secret-key")
+
+	token, err := auth.CreateJWT("123", time.Hour, secret)
+	assert.NoError(t, err)
+
+	userID, err := auth.ParseJWT(token, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, "123", userID)
+
+	// Test with the wrong secret
+	_, err = auth.ParseJWT(token, []byte("other-secret-key"))
+	assert.Error(t, err)
+}
+
+func TestRequireJWT(t *testing.T) {
+	secret := []byte("my-secret-key")
+	key := "orbit"
+
+	token, err := auth.CreateJWT("123", time.Hour, secret)
+	assert.NoError(t, err)
+
+	handler := auth.RequireJWT(key, secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserID(r.Context())
+		assert.True(t, ok)
+		assert.Equal(t, uint(123), userID)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// The JWT is accepted from the cookie
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: key, Value: token})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// And from a bearer header
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// Requests without a valid JWT are turned away
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer invalid-token")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
 func TestReturnJWT(t *testing.T) {
 	secret := []byte("my-secret-key")
 	userID := "123"
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// userIDKey is the context key the middleware stores the ID of the authenticated user under.
+type userIDKey struct{}
+
+// RequireJWT returns middleware that only lets requests with a valid JWT through, and stores the ID of the user the
+// JWT was issued to in the request context, see UserID. The JWT is read from the cookie with the given name, or from
+// a bearer Authorization header for native apps, which receive the JWT in their redirect URL instead of a cookie.
+//
+// Parameters:
+//   - cookieName: The name of the cookie the JWT is returned in.
+//   - secret: The secret key the JWT is signed with.
+//
+// Example usage:
+//
+//	router.With(RequireJWT(env.JWT_KEY, []byte(env.JWT_SECRET))).Get("/me", handleMe)
+func RequireJWT(cookieName string, secret []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := bearerToken(r)
+			if token == "" {
+				if cookie, err := r.Cookie(cookieName); err == nil {
+					token = cookie.Value
+				}
+			}
+			if token == "" {
+				http.Error(w, "authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			subject, err := ParseJWT(token, secret)
+			if err != nil {
+				http.Error(w, "invalid or expired token", http.StatusUnauthorized)
+				return
+			}
+			userID, err := strconv.ParseUint(subject, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid or expired token", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userIDKey{}, uint(userID))))
+		})
+	}
+}
+
+// UserID returns the ID of the user authenticated by RequireJWT, and false if the request did not pass through it.
+func UserID(ctx context.Context) (uint, bool) {
+	userID, ok := ctx.Value(userIDKey{}).(uint)
+	return userID, ok
+}
+
+// bearerToken returns the token of a bearer Authorization header, or an empty string if the request has none.
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < len("Bearer ") || !strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[len("Bearer "):])
+}
@@ -0,0 +1,157 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/access_token"
+	"garrettpfoy/orbit-api/internal/repositories/session"
+	"log"
+	"time"
+)
+
+// This package moves sessions through their lifecycle. A session starts out open, the host can pause it so no new
+// tracks are started and resume it again, and it ends either when the host ends it or when it has gone longer than its
+// idle timeout without a track starting or a vote being cast. Ending a session is final: its join code is freed, the
+// host's player is paused if it is playing the session's track, and its access token is unlinked from it, so nothing
+// can play on the host's account in its name anymore.
+
+// ErrNotHost is returned when a user who is not the host of a session tries to pause, resume or end it.
+var ErrNotHost = errors.New("only the host of the session can change its status")
+
+// PlaybackStopper stops the playback of sessions on their host's player.
+type PlaybackStopper interface {
+	// StopPlayback stops playing the queue of the session and pauses the host's player if it is playing the session's track
+	StopPlayback(sessionID uint) error
+}
+
+// Service applies lifecycle transitions to sessions.
+type Service struct {
+	sessions session.SessionRepository
+	tokens   access_token.AccessTokenRepository
+	playback PlaybackStopper
+	now      func() time.Time
+}
+
+// NewService creates a lifecycle service that transitions sessions in the given repository and unlinks their tokens
+// in the given access token repository when they end.
+func NewService(sessions session.SessionRepository, tokens access_token.AccessTokenRepository) *Service {
+	return &Service{sessions: sessions, tokens: tokens, now: time.Now}
+}
+
+// WithPlayback makes the service stop the playback of sessions when they end
+func (s *Service) WithPlayback(playback PlaybackStopper) *Service {
+	s.playback = playback
+	return s
+}
+
+// Pause stops new tracks from starting in the session until the host resumes it. Guests can still add and vote.
+func (s *Service) Pause(hostID, sessionID uint) (*models.Session, error) {
+	if err := s.checkHost(hostID, sessionID); err != nil {
+		return nil, err
+	}
+	return s.sessions.TransitionSession(sessionID, models.SessionStatusPaused, s.now())
+}
+
+// Resume reopens a paused session.
+func (s *Service) Resume(hostID, sessionID uint) (*models.Session, error) {
+	if err := s.checkHost(hostID, sessionID); err != nil {
+		return nil, err
+	}
+	return s.sessions.TransitionSession(sessionID, models.SessionStatusOpen, s.now())
+}
+
+// End ends the session for good, stops its playback and unlinks its access token.
+func (s *Service) End(hostID, sessionID uint) (*models.Session, error) {
+	if err := s.checkHost(hostID, sessionID); err != nil {
+		return nil, err
+	}
+	return s.end(sessionID)
+}
+
+// Sweep ends every session that has been idle for longer than its idle timeout, and returns how many were ended.
+// A failure to end one session does not stop the others from being ended.
+func (s *Service) Sweep() (int, error) {
+	idle, err := s.sessions.GetIdleSessions(s.now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to find idle sessions: %w", err)
+	}
+
+	var ended int
+	var failures []error
+	for _, idleSession := range idle {
+		if _, err := s.end(idleSession.ID); err != nil {
+			failures = append(failures, fmt.Errorf("session %d: %w", idleSession.ID, err))
+			continue
+		}
+		ended++
+	}
+
+	if len(failures) > 0 {
+		return ended, fmt.Errorf("failed to end %d idle sessions: %v", len(failures), failures)
+	}
+	return ended, nil
+}
+
+// end transitions a session to ended, stops its playback and unlinks its access token. The session is ended first, so
+// a session whose playback could not be stopped or whose token could not be unlinked is still closed to guests.
+// Playback is stopped before the token is unlinked, as the host's player can only be reached with it.
+func (s *Service) end(sessionID uint) (*models.Session, error) {
+	ended, err := s.sessions.TransitionSession(sessionID, models.SessionStatusEnded, s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	var failures []error
+	if s.playback != nil {
+		if err := s.playback.StopPlayback(sessionID); err != nil {
+			failures = append(failures, fmt.Errorf("error stopping the playback of session %d: %w", sessionID, err))
+		}
+	}
+	if err := s.tokens.UnlinkSessionAccessToken(sessionID); err != nil {
+		failures = append(failures, fmt.Errorf("error unlinking the access token of session %d: %w", sessionID, err))
+	}
+	return ended, errors.Join(failures...)
+}
+
+// checkHost returns ErrNotHost unless the user hosts the session.
+func (s *Service) checkHost(hostID, sessionID uint) error {
+	found, err := s.sessions.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if found.HostID != hostID {
+		return ErrNotHost
+	}
+	return nil
+}
+
+// Sweeper periodically ends the sessions that went idle.
+type Sweeper struct {
+	service  *Service
+	interval time.Duration
+}
+
+// NewSweeper creates a sweeper that ends idle sessions with the given service every interval.
+func NewSweeper(service *Service, interval time.Duration) *Sweeper {
+	return &Sweeper{service: service, interval: interval}
+}
+
+// Run ends idle sessions every interval until the context is cancelled.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if ended, err := s.service.Sweep(); err != nil {
+			log.Printf("Failed to end idle sessions (%d ended): %v", ended, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/access_token"
+	"garrettpfoy/orbit-api/internal/repositories/session"
+	"garrettpfoy/orbit-api/internal/services/encryption"
+	"garrettpfoy/orbit-api/internal/services/lifecycle"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection to an in-memory database opens a new, empty database
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	models.SetEncryptionService(encryption.NewEncryptionService("abcdefghijklmnopqrstuvwxyz123456"))
+
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.AccessToken{})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// setupSession creates a session that started at the given time, hosted by a host whose access token is linked to it.
+func setupSession(t *testing.T, db *gorm.DB, slug string, startedAt time.Time) (*models.User, *models.Session) {
+	host := &models.User{Username: slug + "_host"}
+	assert.NoError(t, db.Create(host).Error)
+
+	created := &models.Session{Slug: slug, HostID: host.ID, StartedAt: &startedAt}
+	assert.NoError(t, db.Create(created).Error)
+
+	token := &models.AccessToken{
+		UserID:       host.ID,
+		AccessToken:  slug + "_access",
+		RefreshToken: slug + "_refresh",
+		ExpiryTime:   time.Now().Add(time.Hour),
+		SessionID:    &created.ID,
+	}
+	assert.NoError(t, db.Create(token).Error)
+
+	return host, created
+}
+
+func TestPauseResumeEnd(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	tokens := access_token.NewGormAccessTokenRepository(db)
+	service := lifecycle.NewService(session.NewGormSessionRepository(db), tokens)
+
+	host, created := setupSession(t, db, "party", time.Now())
+
+	_, err = service.Pause(host.ID+1, created.ID)
+	assert.True(t, errors.Is(err, lifecycle.ErrNotHost))
+
+	paused, err := service.Pause(host.ID, created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.SessionStatusPaused, paused.Status)
+
+	resumed, err := service.Resume(host.ID, created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.SessionStatusOpen, resumed.Status)
+
+	ended, err := service.End(host.ID, created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.SessionStatusEnded, ended.Status)
+	assert.NotNil(t, ended.EndedAt)
+
+	_, err = tokens.GetAccessTokenBySessionID(created.ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	_, err = service.Resume(host.ID, created.ID)
+	assert.True(t, errors.Is(err, session.ErrInvalidTransition))
+}
+
+func TestSweep(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	tokens := access_token.NewGormAccessTokenRepository(db)
+	sessions := session.NewGormSessionRepository(db)
+	service := lifecycle.NewService(sessions, tokens)
+
+	_, stale := setupSession(t, db, "stale", time.Now().Add(-3*time.Hour))
+	_, fresh := setupSession(t, db, "fresh", time.Now().Add(-3*time.Hour))
+	assert.NoError(t, sessions.TouchSession(fresh.ID, time.Now().Add(-time.Minute)))
+
+	ended, err := service.Sweep()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ended)
+
+	swept, err := sessions.GetSession(stale.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.SessionStatusEnded, swept.Status)
+	_, err = tokens.GetAccessTokenBySessionID(stale.ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	kept, err := sessions.GetSession(fresh.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.SessionStatusOpen, kept.Status)
+	_, err = tokens.GetAccessTokenBySessionID(fresh.ID)
+	assert.NoError(t, err)
+
+	// An ended session is not swept again
+	ended, err = service.Sweep()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, ended)
+}
+
+func TestSweeperRun(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	sessions := session.NewGormSessionRepository(db)
+	service := lifecycle.NewService(sessions, access_token.NewGormAccessTokenRepository(db))
+
+	_, stale := setupSession(t, db, "stale", time.Now().Add(-3*time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		lifecycle.NewSweeper(service, time.Hour).Run(ctx)
+		close(done)
+	}()
+
+	// The sweeper sweeps once right away, before waiting for the first tick
+	assert.Eventually(t, func() bool {
+		swept, err := sessions.GetSession(stale.ID)
+		return err == nil && swept.Status == models.SessionStatusEnded
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
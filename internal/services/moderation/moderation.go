@@ -0,0 +1,200 @@
+package moderation
+
+import (
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/moderation_action"
+	"garrettpfoy/orbit-api/internal/repositories/queue"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// This package gives the host of a session the final say over its queue. The host can pin an item to play next,
+// move an item to a position of their choosing, remove an item with a reason the user who added it can see, lock the
+// queue against new items and freeze voting. Every action is checked against the host of the session and recorded in
+// the session's audit log in the same transaction as the change itself.
+
+// ErrNotHost is returned when a user who is not the host of a session tries to moderate it.
+var ErrNotHost = errors.New("only the host of the session can moderate it")
+
+// ErrNotQueued is returned when the host moderates a queue item that is no longer queued.
+var ErrNotQueued = errors.New("the queue item is not queued")
+
+// Service applies the moderation actions of hosts to their session.
+type Service struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+// NewService creates a moderation service that stores its changes and audit log in the given database.
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, now: time.Now}
+}
+
+// Pin makes a queue item play next, ahead of the items that were pinned before it.
+func (s *Service) Pin(hostID, queueID uint) error {
+	return s.moderateItem(hostID, queueID, func(tx *gorm.DB, queueItem *models.Queue) (*models.ModerationAction, error) {
+		if err := tx.Model(&models.Queue{}).
+			Where("session_id = ? AND status = ? AND pin_rank > 0 AND id <> ?", queueItem.SessionID, models.QueueStatusQueued, queueItem.ID).
+			Update("pin_rank", gorm.Expr("pin_rank + 1")).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Model(queueItem).Update("pin_rank", 1).Error; err != nil {
+			return nil, err
+		}
+		return &models.ModerationAction{Action: models.ModerationPin}, nil
+	})
+}
+
+// Unpin returns a queue item to the place the session's queue order gives it.
+func (s *Service) Unpin(hostID, queueID uint) error {
+	return s.moderateItem(hostID, queueID, func(tx *gorm.DB, queueItem *models.Queue) (*models.ModerationAction, error) {
+		if err := tx.Model(queueItem).Update("pin_rank", 0).Error; err != nil {
+			return nil, err
+		}
+		return &models.ModerationAction{Action: models.ModerationUnpin}, nil
+	})
+}
+
+// Move puts a queue item at the given 1-based position of the queue. The items ahead of it are pinned in their current
+// order along with it, so the crowd can not vote anything between them, while the items behind it keep following the
+// session's queue order. A position past the end of the queue moves the item to the end.
+func (s *Service) Move(hostID, queueID uint, position int) error {
+	if position < 1 {
+		return fmt.Errorf("position must be positive")
+	}
+
+	return s.moderateItem(hostID, queueID, func(tx *gorm.DB, queueItem *models.Queue) (*models.ModerationAction, error) {
+		ordered, err := queue.NewGormQueueRepository(tx).GetOrderedQueueItems(queueItem.SessionID)
+		if err != nil {
+			return nil, err
+		}
+
+		others := make([]models.Queue, 0, len(ordered))
+		for _, other := range ordered {
+			if other.ID != queueItem.ID {
+				others = append(others, other)
+			}
+		}
+		if position > len(others)+1 {
+			position = len(others) + 1
+		}
+		moved := append(append(append([]models.Queue(nil), others[:position-1]...), *queueItem), others[position-1:]...)
+
+		// Pinned items always lead the ordered queue, so the pinned items form one run at its start
+		rank := 0
+		for i, item := range moved {
+			if i >= position && item.PinRank == 0 {
+				break
+			}
+			rank++
+			if err := tx.Model(&models.Queue{}).Where("id = ?", item.ID).Update("pin_rank", rank).Error; err != nil {
+				return nil, err
+			}
+		}
+		return &models.ModerationAction{Action: models.ModerationMove, Position: position}, nil
+	})
+}
+
+// Remove takes a queue item off the queue before it plays, with a reason that is shown to the user who added it.
+func (s *Service) Remove(hostID, queueID uint, reason string) error {
+	return s.moderateItem(hostID, queueID, func(tx *gorm.DB, queueItem *models.Queue) (*models.ModerationAction, error) {
+		if err := queue.NewGormQueueRepository(tx).FinishQueueItem(queueItem.ID, models.QueueStatusRemoved, s.now()); err != nil {
+			return nil, err
+		}
+		if err := tx.Model(queueItem).Update("removal_reason", reason).Error; err != nil {
+			return nil, err
+		}
+		return &models.ModerationAction{Action: models.ModerationRemove, Reason: reason}, nil
+	})
+}
+
+// LockQueue locks or unlocks the queue of a session. While it is locked, no items can be added to it.
+func (s *Service) LockQueue(hostID, sessionID uint, locked bool) error {
+	action := models.ModerationUnlock
+	if locked {
+		action = models.ModerationLock
+	}
+	return s.moderateSession(hostID, sessionID, action, "queue_locked", locked)
+}
+
+// FreezeVoting freezes or unfreezes voting in a session. While it is frozen, no votes or skip votes can be cast,
+// changed or retracted.
+func (s *Service) FreezeVoting(hostID, sessionID uint, frozen bool) error {
+	action := models.ModerationUnfreeze
+	if frozen {
+		action = models.ModerationFreeze
+	}
+	return s.moderateSession(hostID, sessionID, action, "voting_frozen", frozen)
+}
+
+// AuditLog returns the moderation actions taken in a session, most recent first. Only the host can read it.
+func (s *Service) AuditLog(hostID, sessionID uint) ([]models.ModerationAction, error) {
+	var session models.Session
+	if err := s.db.Select("id", "host_id").First(&session, sessionID).Error; err != nil {
+		return nil, fmt.Errorf("error loading session: %w", err)
+	}
+	if session.HostID != hostID {
+		return nil, ErrNotHost
+	}
+	return moderation_action.NewGormModerationActionRepository(s.db).GetModerationActionsBySessionID(sessionID)
+}
+
+// moderateItem applies a moderation action to a queued item and records it in the audit log, in one transaction.
+func (s *Service) moderateItem(hostID, queueID uint, apply func(tx *gorm.DB, queueItem *models.Queue) (*models.ModerationAction, error)) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var queueItem models.Queue
+		if err := tx.First(&queueItem, queueID).Error; err != nil {
+			return fmt.Errorf("error loading queue item: %w", err)
+		}
+
+		if err := lockSession(tx, hostID, queueItem.SessionID); err != nil {
+			return err
+		}
+		if queueItem.Status != models.QueueStatusQueued {
+			return ErrNotQueued
+		}
+
+		action, err := apply(tx, &queueItem)
+		if err != nil {
+			return err
+		}
+		action.SessionID = queueItem.SessionID
+		action.ActorID = hostID
+		action.QueueID = &queueItem.ID
+		return moderation_action.NewGormModerationActionRepository(tx).CreateModerationAction(action)
+	})
+}
+
+// moderateSession sets a flag of a session and records the action in the audit log, in one transaction.
+func (s *Service) moderateSession(hostID, sessionID uint, action, column string, value bool) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockSession(tx, hostID, sessionID); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Session{}).Where("id = ?", sessionID).Update(column, value).Error; err != nil {
+			return err
+		}
+		return moderation_action.NewGormModerationActionRepository(tx).CreateModerationAction(&models.ModerationAction{
+			SessionID: sessionID,
+			ActorID:   hostID,
+			Action:    action,
+		})
+	})
+}
+
+// lockSession locks the session row and checks the user is its host. Locking the session serializes moderation with
+// adds and pops, which lock it too, so the host always acts on the queue as it is.
+func lockSession(tx *gorm.DB, hostID, sessionID uint) error {
+	var session models.Session
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "host_id").First(&session, sessionID).Error; err != nil {
+		return fmt.Errorf("error loading session: %w", err)
+	}
+	if session.HostID != hostID {
+		return ErrNotHost
+	}
+	return nil
+}
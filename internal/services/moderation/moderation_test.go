@@ -0,0 +1,225 @@
+package moderation_test
+
+import (
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/queue"
+	"garrettpfoy/orbit-api/internal/services/moderation"
+	"garrettpfoy/orbit-api/internal/services/voting"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection to an in-memory database opens a new, empty database
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.Queue{}, &models.Track{}, &models.Vote{}, &models.SkipVote{}, &models.VoteEvent{}, &models.ModerationAction{})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// setupSession creates a session hosted by a host with the given number of queue items added by a guest, ranked in the
+// order they are returned in.
+func setupSession(t *testing.T, db *gorm.DB, items int) (*models.User, *models.User, *queue.GormQueueRepository, []models.Queue) {
+	host := &models.User{Username: "host"}
+	assert.NoError(t, db.Create(host).Error)
+	guest := &models.User{Username: "guest"}
+	assert.NoError(t, db.Create(guest).Error)
+
+	settings := models.DefaultSessionSettings()
+	settings.MaxActiveItems = 0
+	session := &models.Session{Slug: "party", HostID: host.ID, Settings: settings}
+	assert.NoError(t, db.Create(session).Error)
+
+	queueRepo := queue.NewGormQueueRepository(db)
+	queueItems := make([]models.Queue, items)
+	for i := range queueItems {
+		queueItems[i] = models.Queue{TrackURI: fmt.Sprintf("spotify:track:%d", i), SessionID: session.ID, UserID: guest.ID}
+		assert.NoError(t, queueRepo.CreateQueueItem(&queueItems[i]))
+	}
+	return host, guest, queueRepo, queueItems
+}
+
+func orderedIDs(t *testing.T, queueRepo *queue.GormQueueRepository, sessionID uint) []uint {
+	queueItems, err := queueRepo.GetOrderedQueueItems(sessionID)
+	assert.NoError(t, err)
+	ids := make([]uint, len(queueItems))
+	for i, queueItem := range queueItems {
+		ids[i] = queueItem.ID
+	}
+	return ids
+}
+
+func TestPin(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	host, guest, queueRepo, queueItems := setupSession(t, db, 4)
+	sessionID := queueItems[0].SessionID
+	service := moderation.NewService(db)
+
+	err = service.Pin(guest.ID, queueItems[3].ID)
+	assert.True(t, errors.Is(err, moderation.ErrNotHost))
+
+	// The most recent pin plays next
+	assert.NoError(t, service.Pin(host.ID, queueItems[2].ID))
+	assert.NoError(t, service.Pin(host.ID, queueItems[3].ID))
+	assert.Equal(t, []uint{queueItems[3].ID, queueItems[2].ID, queueItems[0].ID, queueItems[1].ID}, orderedIDs(t, queueRepo, sessionID))
+
+	next, err := queueRepo.PopNextQueueItem(sessionID, db.NowFunc())
+	assert.NoError(t, err)
+	assert.Equal(t, queueItems[3].ID, next.ID)
+
+	assert.NoError(t, service.Unpin(host.ID, queueItems[2].ID))
+	assert.Equal(t, []uint{queueItems[0].ID, queueItems[1].ID, queueItems[2].ID}, orderedIDs(t, queueRepo, sessionID))
+
+	// Only queued items can be moderated
+	err = service.Pin(host.ID, queueItems[3].ID)
+	assert.True(t, errors.Is(err, moderation.ErrNotQueued))
+}
+
+func TestMove(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	host, _, queueRepo, queueItems := setupSession(t, db, 5)
+	sessionID := queueItems[0].SessionID
+	service := moderation.NewService(db)
+
+	assert.NoError(t, service.Move(host.ID, queueItems[4].ID, 2))
+	expected := []uint{queueItems[0].ID, queueItems[4].ID, queueItems[1].ID, queueItems[2].ID, queueItems[3].ID}
+	assert.Equal(t, expected, orderedIDs(t, queueRepo, sessionID))
+
+	// Votes can no longer reorder the items the host placed
+	voter := &models.User{Username: "voter"}
+	assert.NoError(t, db.Create(voter).Error)
+	settings := models.DefaultSessionSettings()
+	settings.MaxActiveItems = 0
+	settings.VoteCooldownSeconds = 0
+	assert.NoError(t, db.Model(&models.Session{}).Where("id = ?", sessionID).Update("settings", settings).Error)
+	_, err = voting.NewService(db).Vote(voter.ID, queueItems[3].ID, models.VoteUp)
+	assert.NoError(t, err)
+	expected = []uint{queueItems[0].ID, queueItems[4].ID, queueItems[3].ID, queueItems[1].ID, queueItems[2].ID}
+	assert.Equal(t, expected, orderedIDs(t, queueRepo, sessionID))
+
+	// Moving a pinned item back pins the items it moves behind, and a position past the end is the end
+	assert.NoError(t, service.Move(host.ID, queueItems[0].ID, 3))
+	expected = []uint{queueItems[4].ID, queueItems[3].ID, queueItems[0].ID, queueItems[1].ID, queueItems[2].ID}
+	assert.Equal(t, expected, orderedIDs(t, queueRepo, sessionID))
+
+	assert.NoError(t, service.Move(host.ID, queueItems[4].ID, 10))
+	expected = []uint{queueItems[3].ID, queueItems[0].ID, queueItems[1].ID, queueItems[2].ID, queueItems[4].ID}
+	assert.Equal(t, expected, orderedIDs(t, queueRepo, sessionID))
+
+	err = service.Move(host.ID, queueItems[0].ID, 0)
+	assert.Error(t, err)
+}
+
+func TestRemove(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	host, guest, queueRepo, queueItems := setupSession(t, db, 2)
+	sessionID := queueItems[0].SessionID
+	service := moderation.NewService(db)
+
+	assert.NoError(t, service.Remove(host.ID, queueItems[0].ID, "wrong vibe"))
+	assert.Equal(t, []uint{queueItems[1].ID}, orderedIDs(t, queueRepo, sessionID))
+
+	// The user who added the item can see why it was removed
+	removed, err := queueRepo.GetRemovedQueueItems(sessionID, guest.ID)
+	assert.NoError(t, err)
+	assert.Len(t, removed, 1)
+	assert.Equal(t, "wrong vibe", removed[0].RemovalReason)
+	assert.Equal(t, models.QueueStatusRemoved, removed[0].Status)
+
+	err = service.Remove(host.ID, queueItems[0].ID, "again")
+	assert.True(t, errors.Is(err, moderation.ErrNotQueued))
+}
+
+func TestLockQueue(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	host, guest, queueRepo, queueItems := setupSession(t, db, 1)
+	sessionID := queueItems[0].SessionID
+	service := moderation.NewService(db)
+
+	err = service.LockQueue(guest.ID, sessionID, true)
+	assert.True(t, errors.Is(err, moderation.ErrNotHost))
+
+	assert.NoError(t, service.LockQueue(host.ID, sessionID, true))
+	err = queueRepo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:new", SessionID: sessionID, UserID: guest.ID})
+	assert.True(t, errors.Is(err, queue.ErrQueueLocked))
+
+	assert.NoError(t, service.LockQueue(host.ID, sessionID, false))
+	err = queueRepo.CreateQueueItem(&models.Queue{TrackURI: "spotify:track:new", SessionID: sessionID, UserID: guest.ID})
+	assert.NoError(t, err)
+}
+
+func TestFreezeVoting(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	host, guest, _, queueItems := setupSession(t, db, 1)
+	sessionID := queueItems[0].SessionID
+	service := moderation.NewService(db)
+	votingService := voting.NewService(db)
+
+	assert.NoError(t, service.FreezeVoting(host.ID, sessionID, true))
+	_, err = votingService.Vote(guest.ID, queueItems[0].ID, models.VoteUp)
+	assert.True(t, errors.Is(err, voting.ErrVotingFrozen))
+
+	assert.NoError(t, service.FreezeVoting(host.ID, sessionID, false))
+	_, err = votingService.Vote(guest.ID, queueItems[0].ID, models.VoteUp)
+	assert.NoError(t, err)
+}
+
+func TestAuditLog(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	host, guest, _, queueItems := setupSession(t, db, 2)
+	sessionID := queueItems[0].SessionID
+	service := moderation.NewService(db)
+
+	assert.NoError(t, service.Pin(host.ID, queueItems[1].ID))
+	assert.NoError(t, service.Move(host.ID, queueItems[0].ID, 1))
+	assert.NoError(t, service.Remove(host.ID, queueItems[1].ID, "duplicate"))
+	assert.NoError(t, service.LockQueue(host.ID, sessionID, true))
+	// Rejected actions are not recorded
+	assert.Error(t, service.Pin(guest.ID, queueItems[0].ID))
+
+	_, err = service.AuditLog(guest.ID, sessionID)
+	assert.True(t, errors.Is(err, moderation.ErrNotHost))
+
+	actions, err := service.AuditLog(host.ID, sessionID)
+	assert.NoError(t, err)
+	assert.Len(t, actions, 4)
+	assert.Equal(t, models.ModerationLock, actions[0].Action)
+	assert.Nil(t, actions[0].QueueID)
+	assert.Equal(t, models.ModerationRemove, actions[1].Action)
+	assert.Equal(t, "duplicate", actions[1].Reason)
+	assert.Equal(t, queueItems[1].ID, *actions[1].QueueID)
+	assert.Equal(t, models.ModerationMove, actions[2].Action)
+	assert.Equal(t, 1, actions[2].Position)
+	assert.Equal(t, models.ModerationPin, actions[3].Action)
+	assert.Equal(t, host.ID, actions[3].ActorID)
+}
@@ -0,0 +1,74 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// GoogleProviderName is the name the Google provider is registered under
+	GoogleProviderName = "google"
+	// GoogleAuthURL is the Google endpoint users are sent to in order to authorize Orbit
+	GoogleAuthURL = "https://accounts.google.com/o/oauth2/v2/auth"
+	// GoogleTokenURL is the Google endpoint authorization codes are exchanged at
+	GoogleTokenURL = "https://oauth2.googleapis.com/token"
+	// GoogleJWKSURL is the Google endpoint publishing the keys ID tokens are signed with
+	GoogleJWKSURL = "https://www.googleapis.com/oauth2/v3/certs"
+)
+
+// GoogleScopes are the OpenID Connect scopes Orbit requests from a Google user, which are
+// only used to identify the user so they can vote.
+var GoogleScopes = []string{"openid", "email", "profile"}
+
+// GoogleIssuers are the issuers Google signs ID tokens as.
+var GoogleIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+
+// NewGoogleProvider creates the Google OpenID Connect provider, verifying ID tokens against the
+// keys published at jwksURL. Its user linker must be set before it is registered.
+func NewGoogleProvider(clientID, clientSecret, redirectURL, jwksURL string) *Provider {
+	verifier := NewIDTokenVerifier(NewKeySet(jwksURL, nil), clientID, GoogleIssuers...)
+
+	return &Provider{
+		Name: GoogleProviderName,
+		Config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       GoogleScopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:   GoogleAuthURL,
+				TokenURL:  GoogleTokenURL,
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+		},
+		// The nonce is echoed back in the ID token, binding the token to the login attempt
+		UseNonce:     true,
+		UsePKCE:      true,
+		FetchProfile: idTokenProfileFetcher(verifier),
+	}
+}
+
+// idTokenProfileFetcher returns a profile fetcher that reads the profile from the verified
+// OpenID Connect ID token returned alongside the access token.
+func idTokenProfileFetcher(verifier *IDTokenVerifier) ProfileFetcher {
+	return func(ctx context.Context, _ *Provider, token *oauth2.Token, state *StateData) (*Profile, error) {
+		rawIDToken, ok := token.Extra("id_token").(string)
+		if !ok || rawIDToken == "" {
+			return nil, fmt.Errorf("token response does not contain an ID token")
+		}
+
+		claims, err := verifier.Verify(ctx, rawIDToken, state.Nonce)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Profile{
+			Subject:       claims.Subject,
+			Email:         claims.Email,
+			EmailVerified: claims.EmailVerified,
+			DisplayName:   claims.Name,
+		}, nil
+	}
+}
@@ -0,0 +1,214 @@
+package oauth2
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// minKeyRefreshInterval is the minimum time between two fetches of a key set, which prevents
+// tokens with unknown key IDs from making Orbit hammer the provider's JWKS endpoint.
+const minKeyRefreshInterval = time.Minute
+
+// IDTokenClaims are the OpenID Connect claims Orbit reads from an ID token.
+type IDTokenClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Nonce         string `json:"nonce"`
+	jwt.StandardClaims
+}
+
+// jsonWebKey is a single RSA key as published in a JSON Web Key Set.
+type jsonWebKey struct {
+	KeyID     string `json:"kid"`
+	KeyType   string `json:"kty"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+// KeySet fetches and caches the RSA public keys published at a JWKS URL. Keys are refetched
+// when a token references a key ID that is not cached, which handles provider key rotation.
+type KeySet struct {
+	url       string
+	client    *http.Client
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// NewKeySet creates a key set backed by the given JWKS URL.
+func NewKeySet(jwksURL string, client *http.Client) *KeySet {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &KeySet{
+		url:    jwksURL,
+		client: client,
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+}
+
+// Key returns the public key with the given key ID, fetching the key set if it is not cached.
+func (k *KeySet) Key(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if key, ok := k.keys[keyID]; ok {
+		return key, nil
+	}
+
+	if time.Since(k.fetchedAt) < minKeyRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", keyID)
+	}
+
+	if err := k.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	if key, ok := k.keys[keyID]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", keyID)
+}
+
+// refresh replaces the cached keys with the keys currently published at the JWKS URL.
+// The caller must hold k.mu.
+func (k *KeySet) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch key set: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch key set: unexpected status %d", resp.StatusCode)
+	}
+
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&keySet); err != nil {
+		return fmt.Errorf("failed to decode key set: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(keySet.Keys))
+	for _, jwk := range keySet.Keys {
+		if jwk.KeyType != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			return fmt.Errorf("failed to parse key %q: %w", jwk.KeyID, err)
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	k.keys = keys
+	k.fetchedAt = time.Now()
+
+	return nil
+}
+
+// publicKey decodes the base64url encoded modulus and exponent of the key.
+func (jwk jsonWebKey) publicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("exponent is too large")
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exponent.Int64()),
+	}, nil
+}
+
+// IDTokenVerifier verifies OpenID Connect ID tokens issued for a single client.
+type IDTokenVerifier struct {
+	keys     *KeySet
+	clientID string
+	issuers  []string
+}
+
+// NewIDTokenVerifier creates a verifier that accepts tokens signed by a key in the key set,
+// issued by one of the given issuers, for the given client ID.
+func NewIDTokenVerifier(keys *KeySet, clientID string, issuers ...string) *IDTokenVerifier {
+	return &IDTokenVerifier{
+		keys:     keys,
+		clientID: clientID,
+		issuers:  issuers,
+	}
+}
+
+// Verify parses the raw ID token, verifies its signature, issuer, audience, expiry and nonce,
+// and returns its claims. It returns an error if any of the checks fail.
+func (v *IDTokenVerifier) Verify(ctx context.Context, rawIDToken, nonce string) (*IDTokenClaims, error) {
+	var claims IDTokenClaims
+
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		// Only RS256 is accepted, which prevents algorithm confusion attacks
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		keyID, _ := token.Header["kid"].(string)
+		return v.keys.Key(ctx, keyID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify ID token: %w", err)
+	}
+
+	if !claims.VerifyAudience(v.clientID, true) {
+		return nil, fmt.Errorf("ID token was not issued for this client")
+	}
+
+	if !v.trustedIssuer(claims.Issuer) {
+		return nil, fmt.Errorf("ID token was issued by an untrusted issuer %q", claims.Issuer)
+	}
+
+	if claims.ExpiresAt == 0 {
+		return nil, fmt.Errorf("ID token does not contain an exp claim")
+	}
+
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("ID token nonce does not match")
+	}
+
+	return &claims, nil
+}
+
+func (v *IDTokenVerifier) trustedIssuer(issuer string) bool {
+	for _, trusted := range v.issuers {
+		if issuer == trusted {
+			return true
+		}
+	}
+	return false
+}
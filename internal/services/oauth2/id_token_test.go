@@ -0,0 +1,164 @@
+package oauth2_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"garrettpfoy/orbit-api/internal/services/oauth2"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testClientID = "orbit-client"
+	testIssuer   = "https://accounts.google.com"
+	testKeyID    = "test-key"
+)
+
+func setupKeySetServer(t *testing.T, key *rsa.PrivateKey) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": testKeyID,
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func signIDToken(t *testing.T, key *rsa.PrivateKey, keyID string, claims oauth2.IDTokenClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+
+	return signed
+}
+
+func validClaims() oauth2.IDTokenClaims {
+	return oauth2.IDTokenClaims{
+		Email:         "guest@example.com",
+		EmailVerified: true,
+		Name:          "Guest",
+		Nonce:         "nonce",
+		StandardClaims: jwt.StandardClaims{
+			Audience:  testClientID,
+			Issuer:    testIssuer,
+			Subject:   "123",
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	server := setupKeySetServer(t, key)
+	verifier := oauth2.NewIDTokenVerifier(oauth2.NewKeySet(server.URL, server.Client()), testClientID, testIssuer)
+
+	claims, err := verifier.Verify(context.Background(), signIDToken(t, key, testKeyID, validClaims()), "nonce")
+	assert.NoError(t, err)
+	assert.Equal(t, "guest@example.com", claims.Email)
+	assert.True(t, claims.EmailVerified)
+	assert.Equal(t, "Guest", claims.Name)
+}
+
+func TestVerifyIDTokenRejectsInvalidTokens(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	server := setupKeySetServer(t, key)
+
+	tests := []struct {
+		name   string
+		token  func() string
+		nonce  string
+		errMsg string
+	}{
+		{
+			name: "Wrong Audience",
+			token: func() string {
+				claims := validClaims()
+				claims.Audience = "another-client"
+				return signIDToken(t, key, testKeyID, claims)
+			},
+			nonce:  "nonce",
+			errMsg: "ID token was not issued for this client",
+		},
+		{
+			name: "Untrusted Issuer",
+			token: func() string {
+				claims := validClaims()
+				claims.Issuer = "https://evil.example.com"
+				return signIDToken(t, key, testKeyID, claims)
+			},
+			nonce:  "nonce",
+			errMsg: "untrusted issuer",
+		},
+		{
+			name: "Expired",
+			token: func() string {
+				claims := validClaims()
+				claims.ExpiresAt = time.Now().Add(-time.Hour).Unix()
+				return signIDToken(t, key, testKeyID, claims)
+			},
+			nonce:  "nonce",
+			errMsg: "token is expired",
+		},
+		{
+			name: "Mismatched Nonce",
+			token: func() string {
+				return signIDToken(t, key, testKeyID, validClaims())
+			},
+			nonce:  "another-nonce",
+			errMsg: "nonce does not match",
+		},
+		{
+			name: "Wrong Signing Key",
+			token: func() string {
+				return signIDToken(t, otherKey, testKeyID, validClaims())
+			},
+			nonce:  "nonce",
+			errMsg: "failed to verify ID token",
+		},
+		{
+			name: "Unknown Key ID",
+			token: func() string {
+				return signIDToken(t, key, "unknown-key", validClaims())
+			},
+			nonce:  "nonce",
+			errMsg: "unknown signing key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := oauth2.NewIDTokenVerifier(oauth2.NewKeySet(server.URL, server.Client()), testClientID, testIssuer)
+
+			_, err := verifier.Verify(context.Background(), tt.token(), tt.nonce)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
@@ -1,26 +1,27 @@
 package oauth2
 
 import (
-	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"math/big"
-	"net/http"
-
-	"golang.org/x/oauth2"
 )
 
-// This package is in charge of verifying a user's identity via the Spotify OAuth2 flow.
-// It is responsible for creating a new user in the database if the user does not exist,
-// and returns a signed JWT token to the client if the user is successfully authenticated.
-
-var Config *oauth2.Config
+// This package is in charge of verifying a user's identity via the OAuth2 flows of the registered
+// providers (Spotify for hosts, Google for guests). Each provider links the authenticated identity
+// to an Orbit user, creating a new user in the database if the user does not exist.
 
 type StateData struct {
+	Provider    string `json:"provider"`
 	State       string `json:"state"`
 	RedirectURL string `json:"redirect_url"`
 	ClientState string `json:"client_state"`
+	Native      bool   `json:"native"`
+	// Nonce is only kept server side, and is compared to the nonce claim of OpenID Connect ID tokens
+	Nonce string `json:"-"`
+	// CodeVerifier is the PKCE code verifier of the login, which is only kept server side and sent
+	// with the code exchange, so an intercepted authorization code cannot be exchanged by anyone else
+	CodeVerifier string `json:"-"`
 }
 
 // GenerateRandomState generates a random state string of the specified length.
@@ -38,13 +39,17 @@ func GenerateRandomState(length int) string {
 }
 
 // EncodeState encodes the given random state and redirect URL into a string and returns it along with the state data.
-// It takes a randomState string and a redirectURL string as input parameters.
+// It takes the provider the user is signing in with, a randomState string, the redirectURL the user is sent to
+// once authenticated, the clientState to hand back to the client, and whether the client is a native app as input parameters.
 // It returns a string representing the encoded state and a pointer to the StateData struct.
 // If there is an error during the marshaling process, it logs the error and returns an empty string and nil.
-func EncodeState(randomState string, clientState string) (string, *StateData) {
+func EncodeState(provider, randomState, redirectURL, clientState string, native bool) (string, *StateData) {
 	state := StateData{
+		Provider:    provider,
 		State:       randomState,
+		RedirectURL: redirectURL,
 		ClientState: clientState,
+		Native:      native,
 	}
 
 	stateJSON, err := json.Marshal(state)
@@ -54,33 +59,3 @@ func EncodeState(randomState string, clientState string) (string, *StateData) {
 
 	return base64.URLEncoding.EncodeToString(stateJSON), &state
 }
-
-// Initialize initializes the OAuth2 configuration.
-func Initialize(clientID, clientSecret, redirectURL, state string, scopes []string, authURL string, tokenURL string) {
-	Config = &oauth2.Config{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		RedirectURL:  redirectURL,
-		Scopes:       scopes,
-		Endpoint: oauth2.Endpoint{
-			AuthURL:   authURL,
-			TokenURL:  tokenURL,
-			AuthStyle: oauth2.AuthStyleInParams,
-		},
-	}
-}
-
-// AuthCodeURL returns the URL to redirect the user to for authorization.
-func AuthCodeURL(state string) string {
-	return Config.AuthCodeURL(state)
-}
-
-// Exchange converts an authorization code into a token.
-func Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
-	return Config.Exchange(ctx, code)
-}
-
-// Client returns an HTTP client using the provided token.
-func Client(ctx context.Context, token *oauth2.Token) *http.Client {
-	return Config.Client(ctx, token)
-}
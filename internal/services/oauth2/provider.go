@@ -0,0 +1,154 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"net/http"
+	"sort"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// Profile is the identity of an authenticated user as reported by a provider.
+type Profile struct {
+	// Subject is the provider's stable identifier for the user
+	Subject string
+	// Email is the user's email address, if the provider shares it
+	Email string
+	// EmailVerified is whether the provider has verified the user owns the email address
+	EmailVerified bool
+	// DisplayName is the name the user goes by with the provider
+	DisplayName string
+}
+
+// ProfileFetcher retrieves the profile of the user a token was issued to. The state of the
+// login is given so fetchers can verify values bound to it, such as an OpenID Connect nonce.
+type ProfileFetcher func(ctx context.Context, provider *Provider, token *oauth2.Token, state *StateData) (*Profile, error)
+
+// UserLinker finds the Orbit user a profile belongs to, creating the user if they have
+// never signed in with the provider before.
+type UserLinker interface {
+	LinkUser(ctx context.Context, profile *Profile, token *oauth2.Token) (*models.User, error)
+}
+
+// Provider is an OAuth2 identity provider users can sign in to Orbit with. Each provider
+// carries its own configuration, so any number of providers may exist side by side.
+type Provider struct {
+	// Name identifies the provider in URLs, e.g. /auth/{name}/login
+	Name string
+	// Config is the OAuth2 configuration of the provider, including its scopes
+	Config *oauth2.Config
+	// UseNonce adds an OpenID Connect nonce to the authorization URL
+	UseNonce bool
+	// UsePKCE protects the authorization code with a PKCE (S256) code challenge, which lets native
+	// and single page apps authenticate without embedding a client secret
+	UsePKCE bool
+	// FetchProfile retrieves the profile of the authenticated user
+	FetchProfile ProfileFetcher
+	// Linker links the authenticated user's profile to an Orbit user
+	Linker UserLinker
+}
+
+// PrepareState generates the server side secrets of a login with the provider, i.e. the nonce
+// and the PKCE code verifier, and stores them on the state.
+func (p *Provider) PrepareState(state *StateData) {
+	if p.UseNonce {
+		state.Nonce = GenerateRandomState(32)
+	}
+
+	if p.UsePKCE {
+		state.CodeVerifier = oauth2.GenerateVerifier()
+	}
+}
+
+// AuthCodeURL returns the URL to redirect the user to for authorization, including the nonce
+// and PKCE code challenge of the state if the provider uses them.
+func (p *Provider) AuthCodeURL(state *StateData, encodedState string) string {
+	var opts []oauth2.AuthCodeOption
+	if p.UseNonce {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", state.Nonce))
+	}
+
+	if p.UsePKCE {
+		opts = append(opts, oauth2.S256ChallengeOption(state.CodeVerifier))
+	}
+
+	return p.Config.AuthCodeURL(encodedState, opts...)
+}
+
+// Exchange converts an authorization code into a token, proving possession of the PKCE code
+// verifier of the state if the provider uses PKCE.
+func (p *Provider) Exchange(ctx context.Context, code string, state *StateData) (*oauth2.Token, error) {
+	var opts []oauth2.AuthCodeOption
+	if p.UsePKCE {
+		if state.CodeVerifier == "" {
+			return nil, fmt.Errorf("state does not contain a PKCE code verifier")
+		}
+		opts = append(opts, oauth2.VerifierOption(state.CodeVerifier))
+	}
+
+	return p.Config.Exchange(ctx, code, opts...)
+}
+
+// Client returns an HTTP client using the provided token.
+func (p *Provider) Client(ctx context.Context, token *oauth2.Token) *http.Client {
+	return p.Config.Client(ctx, token)
+}
+
+// Registry holds the providers users can sign in with, keyed by name.
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]*Provider
+}
+
+// NewRegistry creates an empty provider registry.
+func NewRegistry() *Registry {
+	return &Registry{providers: make(map[string]*Provider)}
+}
+
+// Register adds the provider to the registry. It returns an error if the provider is
+// incomplete, or if a provider with the same name is already registered.
+func (r *Registry) Register(provider *Provider) error {
+	if provider.Name == "" {
+		return fmt.Errorf("provider name is empty")
+	}
+
+	if provider.Config == nil || provider.FetchProfile == nil || provider.Linker == nil {
+		return fmt.Errorf("provider %q must have a config, profile fetcher and user linker", provider.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.providers[provider.Name]; exists {
+		return fmt.Errorf("provider %q is already registered", provider.Name)
+	}
+
+	r.providers[provider.Name] = provider
+	return nil
+}
+
+// Get returns the provider with the given name, if it is registered.
+func (r *Registry) Get(name string) (*Provider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+// Names returns the names of all registered providers in alphabetical order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,152 @@
+package oauth2_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"garrettpfoy/orbit-api/internal/services/oauth2"
+
+	"github.com/stretchr/testify/assert"
+	xoauth2 "golang.org/x/oauth2"
+)
+
+type stubLinker struct{}
+
+func (stubLinker) LinkUser(_ context.Context, _ *oauth2.Profile, _ *xoauth2.Token) (*models.User, error) {
+	return &models.User{}, nil
+}
+
+func stubFetcher(_ context.Context, _ *oauth2.Provider, _ *xoauth2.Token, _ *oauth2.StateData) (*oauth2.Profile, error) {
+	return &oauth2.Profile{}, nil
+}
+
+// setupProvider creates a provider whose token endpoint issues an access token prefixed with its name
+func setupProvider(t *testing.T, name string) *oauth2.Provider {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		if verifier := r.PostForm.Get("code_verifier"); verifier != "" && verifier != "expected-verifier" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("%s-%s", name, r.PostForm.Get("code")),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	return &oauth2.Provider{
+		Name: name,
+		Config: &xoauth2.Config{
+			ClientID:     name + "-client",
+			ClientSecret: name + "-secret",
+			Scopes:       []string{name + "-scope"},
+			Endpoint: xoauth2.Endpoint{
+				AuthURL:   server.URL + "/authorize",
+				TokenURL:  server.URL + "/token",
+				AuthStyle: xoauth2.AuthStyleInParams,
+			},
+		},
+		FetchProfile: stubFetcher,
+		Linker:       stubLinker{},
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry := oauth2.NewRegistry()
+
+	assert.NoError(t, registry.Register(setupProvider(t, "spotify")))
+	assert.NoError(t, registry.Register(setupProvider(t, "google")))
+
+	provider, ok := registry.Get("spotify")
+	assert.True(t, ok)
+	assert.Equal(t, "spotify", provider.Name)
+
+	_, ok = registry.Get("github")
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"google", "spotify"}, registry.Names())
+}
+
+func TestRegistryRejectsInvalidProviders(t *testing.T) {
+	registry := oauth2.NewRegistry()
+	assert.NoError(t, registry.Register(setupProvider(t, "spotify")))
+
+	err := registry.Register(setupProvider(t, "spotify"))
+	assert.EqualError(t, err, `provider "spotify" is already registered`)
+
+	err = registry.Register(setupProvider(t, ""))
+	assert.EqualError(t, err, "provider name is empty")
+
+	withoutLinker := setupProvider(t, "google")
+	withoutLinker.Linker = nil
+	err = registry.Register(withoutLinker)
+	assert.EqualError(t, err, `provider "google" must have a config, profile fetcher and user linker`)
+}
+
+func TestProvidersAreIndependent(t *testing.T) {
+	for _, name := range []string{"spotify", "google"} {
+		name := name
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			provider := setupProvider(t, name)
+
+			state := &oauth2.StateData{}
+			authURL := provider.AuthCodeURL(state, "encoded-state")
+			assert.Contains(t, authURL, name+"-client")
+			assert.Contains(t, authURL, name+"-scope")
+			assert.NotContains(t, authURL, "nonce")
+
+			token, err := provider.Exchange(context.Background(), "code", state)
+			assert.NoError(t, err)
+			assert.Equal(t, name+"-code", token.AccessToken)
+		})
+	}
+}
+
+func TestAuthCodeURLWithNonce(t *testing.T) {
+	provider := setupProvider(t, "google")
+	provider.UseNonce = true
+
+	authURL := provider.AuthCodeURL(&oauth2.StateData{Nonce: "abc123"}, "encoded-state")
+	assert.Contains(t, authURL, "nonce=abc123")
+}
+
+func TestPKCE(t *testing.T) {
+	provider := setupProvider(t, "spotify")
+	provider.UsePKCE = true
+
+	state := &oauth2.StateData{}
+	provider.PrepareState(state)
+	assert.NotEmpty(t, state.CodeVerifier)
+	assert.Empty(t, state.Nonce)
+
+	authURL, err := url.Parse(provider.AuthCodeURL(state, "encoded-state"))
+	assert.NoError(t, err)
+
+	challenge := sha256.Sum256([]byte(state.CodeVerifier))
+	assert.Equal(t, "S256", authURL.Query().Get("code_challenge_method"))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(challenge[:]), authURL.Query().Get("code_challenge"))
+
+	_, err = provider.Exchange(context.Background(), "code", &oauth2.StateData{})
+	assert.EqualError(t, err, "state does not contain a PKCE code verifier")
+
+	_, err = provider.Exchange(context.Background(), "code", &oauth2.StateData{CodeVerifier: "wrong-verifier"})
+	assert.Error(t, err)
+
+	token, err := provider.Exchange(context.Background(), "code", &oauth2.StateData{CodeVerifier: "expected-verifier"})
+	assert.NoError(t, err)
+	assert.Equal(t, "spotify-code", token.AccessToken)
+}
@@ -0,0 +1,67 @@
+package oauth2
+
+import (
+	"context"
+	"fmt"
+
+	"garrettpfoy/orbit-api/internal/services/spotify"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// SpotifyProviderName is the name the Spotify provider is registered under
+	SpotifyProviderName = "spotify"
+	// SpotifyAuthURL is the Spotify endpoint users are sent to in order to authorize Orbit
+	SpotifyAuthURL = "https://accounts.spotify.com/authorize"
+	// SpotifyTokenURL is the Spotify endpoint authorization codes are exchanged at
+	SpotifyTokenURL = "https://accounts.spotify.com/api/token"
+)
+
+// SpotifyScopes are the scopes Orbit requests from a Spotify user, which allow it to identify
+// the user and control their playback while they are hosting a session.
+var SpotifyScopes = []string{
+	"user-read-private",
+	"user-read-email",
+	"user-read-playback-state",
+	"user-modify-playback-state",
+}
+
+// NewSpotifyProvider creates the Spotify provider. Its user linker must be set before it is registered.
+func NewSpotifyProvider(clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Name: SpotifyProviderName,
+		Config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       SpotifyScopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:   SpotifyAuthURL,
+				TokenURL:  SpotifyTokenURL,
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+		},
+		UsePKCE:      true,
+		FetchProfile: fetchSpotifyProfile,
+	}
+}
+
+// fetchSpotifyProfile retrieves the profile of the Spotify user the given token belongs to.
+// It returns an error if the request fails or Spotify does not return a user ID.
+func fetchSpotifyProfile(ctx context.Context, provider *Provider, token *oauth2.Token, _ *StateData) (*Profile, error) {
+	user, err := spotify.NewClient(provider.Client(ctx, token), "").CurrentUser(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch spotify profile: %w", err)
+	}
+
+	if user.ID == "" {
+		return nil, fmt.Errorf("spotify profile does not contain a user ID")
+	}
+
+	return &Profile{
+		Subject:     user.ID,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+	}, nil
+}
@@ -0,0 +1,192 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/oauth_state"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrStateNotFound is returned when a state does not exist, has expired, or has already been used.
+var ErrStateNotFound = errors.New("state not found or expired")
+
+// StateStore holds the state of logins in progress between the login and callback requests.
+// States expire after a TTL, so abandoned logins do not accumulate.
+type StateStore interface {
+	// Save stores the state until it is consumed or it expires
+	Save(ctx context.Context, state StateData) error
+	// Consume returns the state with the given random state string and removes it, so it can only be used once
+	Consume(ctx context.Context, state string) (*StateData, error)
+	// Close stops the background sweeper of the store
+	Close()
+}
+
+// sweeper periodically runs sweep until it is stopped.
+type sweeper struct {
+	stop chan struct{}
+	once sync.Once
+}
+
+func startSweeper(interval time.Duration, sweep func()) *sweeper {
+	s := &sweeper{stop: make(chan struct{})}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				sweep()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+func (s *sweeper) close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+type memoryState struct {
+	data      StateData
+	expiresAt time.Time
+}
+
+// MemoryStateStore is a StateStore that keeps states in memory. It is only suitable when a
+// single replica of the API is running, as the callback must reach the replica that served the login.
+type MemoryStateStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	states  map[string]memoryState
+	sweeper *sweeper
+}
+
+// NewMemoryStateStore creates an in-memory state store whose states expire after ttl, and
+// whose expired states are removed every sweepInterval.
+func NewMemoryStateStore(ttl, sweepInterval time.Duration) *MemoryStateStore {
+	store := &MemoryStateStore{
+		ttl:    ttl,
+		states: make(map[string]memoryState),
+	}
+	store.sweeper = startSweeper(sweepInterval, store.sweep)
+
+	return store
+}
+
+func (s *MemoryStateStore) Save(_ context.Context, state StateData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.states[state.State] = memoryState{data: state, expiresAt: time.Now().Add(s.ttl)}
+	return nil
+}
+
+func (s *MemoryStateStore) Consume(_ context.Context, state string) (*StateData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.states[state]
+	if !ok {
+		return nil, ErrStateNotFound
+	}
+	delete(s.states, state)
+
+	if !time.Now().Before(stored.expiresAt) {
+		return nil, ErrStateNotFound
+	}
+	return &stored.data, nil
+}
+
+func (s *MemoryStateStore) Close() {
+	s.sweeper.close()
+}
+
+// Len returns the number of states currently held, including expired states that have not been swept yet.
+func (s *MemoryStateStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.states)
+}
+
+// sweep removes all expired states.
+func (s *MemoryStateStore) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, stored := range s.states {
+		if !now.Before(stored.expiresAt) {
+			delete(s.states, key)
+		}
+	}
+}
+
+// DatabaseStateStore is a StateStore backed by the oauth_states table, which allows any replica
+// of the API to complete a login started by another replica.
+type DatabaseStateStore struct {
+	repo    oauth_state.OAuthStateRepository
+	ttl     time.Duration
+	sweeper *sweeper
+}
+
+// NewDatabaseStateStore creates a database backed state store whose states expire after ttl,
+// and whose expired states are deleted every sweepInterval.
+func NewDatabaseStateStore(repo oauth_state.OAuthStateRepository, ttl, sweepInterval time.Duration) *DatabaseStateStore {
+	store := &DatabaseStateStore{
+		repo: repo,
+		ttl:  ttl,
+	}
+	store.sweeper = startSweeper(sweepInterval, store.sweep)
+
+	return store
+}
+
+func (s *DatabaseStateStore) Save(_ context.Context, state StateData) error {
+	return s.repo.CreateState(&models.OAuthState{
+		State:        state.State,
+		Provider:     state.Provider,
+		RedirectURL:  state.RedirectURL,
+		ClientState:  state.ClientState,
+		Native:       state.Native,
+		Nonce:        state.Nonce,
+		CodeVerifier: state.CodeVerifier,
+		ExpiresAt:    time.Now().Add(s.ttl),
+	})
+}
+
+func (s *DatabaseStateStore) Consume(_ context.Context, state string) (*StateData, error) {
+	stored, err := s.repo.ConsumeState(state, time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrStateNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &StateData{
+		Provider:     stored.Provider,
+		State:        stored.State,
+		RedirectURL:  stored.RedirectURL,
+		ClientState:  stored.ClientState,
+		Native:       stored.Native,
+		Nonce:        stored.Nonce,
+		CodeVerifier: stored.CodeVerifier,
+	}, nil
+}
+
+func (s *DatabaseStateStore) Close() {
+	s.sweeper.close()
+}
+
+// sweep deletes all expired states. Errors are ignored, as the next sweep will retry.
+func (s *DatabaseStateStore) sweep() {
+	s.repo.DeleteExpiredStates(time.Now())
+}
@@ -0,0 +1,91 @@
+package oauth2_test
+
+import (
+	"context"
+	"errors"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/oauth_state"
+	"garrettpfoy/orbit-api/internal/services/encryption"
+	"garrettpfoy/orbit-api/internal/services/oauth2"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupStateStores(t *testing.T, ttl time.Duration) map[string]oauth2.StateStore {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+
+	models.SetEncryptionService(encryption.NewEncryptionService("abcdefghijklmnopqrstuvwxyz123456"))
+	assert.NoError(t, db.AutoMigrate(&models.OAuthState{}))
+
+	stores := map[string]oauth2.StateStore{
+		"memory":   oauth2.NewMemoryStateStore(ttl, time.Hour),
+		"database": oauth2.NewDatabaseStateStore(oauth_state.NewGormOAuthStateRepository(db), ttl, time.Hour),
+	}
+	for _, store := range stores {
+		t.Cleanup(store.Close)
+	}
+
+	return stores
+}
+
+func TestStateStoreConsume(t *testing.T) {
+	for name, store := range setupStateStores(t, time.Minute) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			err := store.Save(ctx, oauth2.StateData{
+				Provider:     "spotify",
+				State:        "random_state",
+				RedirectURL:  "https://orbit.example.com",
+				Native:       true,
+				CodeVerifier: "code_verifier",
+			})
+			assert.NoError(t, err)
+
+			state, err := store.Consume(ctx, "random_state")
+			assert.NoError(t, err)
+			assert.Equal(t, "spotify", state.Provider)
+			assert.Equal(t, "https://orbit.example.com", state.RedirectURL)
+			assert.True(t, state.Native)
+			assert.Equal(t, "code_verifier", state.CodeVerifier)
+
+			_, err = store.Consume(ctx, "random_state")
+			assert.True(t, errors.Is(err, oauth2.ErrStateNotFound))
+
+			_, err = store.Consume(ctx, "unknown_state")
+			assert.True(t, errors.Is(err, oauth2.ErrStateNotFound))
+		})
+	}
+}
+
+func TestStateStoreExpiry(t *testing.T) {
+	for name, store := range setupStateStores(t, 10*time.Millisecond) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			err := store.Save(ctx, oauth2.StateData{Provider: "spotify", State: "random_state"})
+			assert.NoError(t, err)
+
+			time.Sleep(20 * time.Millisecond)
+
+			_, err = store.Consume(ctx, "random_state")
+			assert.True(t, errors.Is(err, oauth2.ErrStateNotFound))
+		})
+	}
+}
+
+func TestMemoryStateStoreSweeper(t *testing.T) {
+	store := oauth2.NewMemoryStateStore(10*time.Millisecond, 10*time.Millisecond)
+	defer store.Close()
+
+	err := store.Save(context.Background(), oauth2.StateData{Provider: "spotify", State: "abandoned_state"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, store.Len())
+
+	assert.Eventually(t, func() bool { return store.Len() == 0 }, time.Second, 10*time.Millisecond)
+}
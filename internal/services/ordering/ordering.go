@@ -0,0 +1,221 @@
+package ordering
+
+import (
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"math"
+	"sort"
+	"time"
+)
+
+// This package decides the order a session's queue is played in. Hosts choose a strategy per session,
+// and every listing of the queue is ordered by it, after the items the host pinned.
+
+const (
+	// Arrival plays queue items in the order they were added.
+	Arrival = "arrival"
+	// Weight plays the queue items with the most votes first.
+	Weight = "weight"
+	// FairShare takes turns between the users who added queue items, so no single user can monopolize the queue.
+	FairShare = "fair_share"
+	// Decay plays the queue items with the most recent votes first, every vote losing half of its influence each
+	// half-life, so the queue follows the crowd as it is now rather than as it was hours ago.
+	Decay = "decay"
+)
+
+// Default is the strategy sessions use unless the host chooses another.
+const Default = Weight
+
+// Strategy orders the queue items of a session.
+type Strategy interface {
+	// Name is the name hosts choose the strategy by
+	Name() string
+	// Order returns the queue items in the order they should be played, without modifying the given slice
+	Order(queueItems []models.Queue) []models.Queue
+}
+
+var strategies = map[string]Strategy{
+	Arrival:   arrivalStrategy{},
+	Weight:    weightStrategy{},
+	FairShare: fairShareStrategy{},
+	Decay:     decayStrategy{halfLife: models.DefaultVoteHalfLifeMinutes * time.Minute, now: time.Now},
+}
+
+// Get returns the strategy with the given name. An empty name returns the default strategy.
+func Get(name string) (Strategy, error) {
+	if name == "" {
+		name = Default
+	}
+
+	strategy, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown queue order %q", name)
+	}
+	return strategy, nil
+}
+
+// ForSettings returns the strategy chosen in the settings of a session, configured by them. The decay strategy scores
+// votes as of now, the other strategies do not depend on time.
+func ForSettings(settings models.SessionSettings, now time.Time) (Strategy, error) {
+	if settings.QueueOrder == Decay {
+		if settings.VoteHalfLifeMinutes <= 0 {
+			return nil, fmt.Errorf("vote half-life must be positive with the %s queue order", Decay)
+		}
+		halfLife := time.Duration(settings.VoteHalfLifeMinutes) * time.Minute
+		return decayStrategy{halfLife: halfLife, now: func() time.Time { return now }}, nil
+	}
+	return Get(settings.QueueOrder)
+}
+
+// Names returns the names of every strategy, sorted.
+func Names() []string {
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type arrivalStrategy struct{}
+
+func (arrivalStrategy) Name() string { return Arrival }
+
+func (arrivalStrategy) Order(queueItems []models.Queue) []models.Queue {
+	ordered := append([]models.Queue(nil), queueItems...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return arrivedBefore(ordered[i], ordered[j])
+	})
+	return ordered
+}
+
+type weightStrategy struct{}
+
+func (weightStrategy) Name() string { return Weight }
+
+func (weightStrategy) Order(queueItems []models.Queue) []models.Queue {
+	ordered := append([]models.Queue(nil), queueItems...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ranksBefore(ordered[i], ordered[j])
+	})
+	return ordered
+}
+
+type fairShareStrategy struct{}
+
+func (fairShareStrategy) Name() string { return FairShare }
+
+// Order plays the queue in rounds. Every user with queue items left gets one slot per round, filled with their
+// highest ranked remaining item, and within a round the slots are ordered by the rank of their item.
+func (fairShareStrategy) Order(queueItems []models.Queue) []models.Queue {
+	byUser := make(map[uint][]models.Queue)
+	var users []uint
+	ranked := weightStrategy{}.Order(queueItems)
+	for _, queueItem := range ranked {
+		if _, ok := byUser[queueItem.UserID]; !ok {
+			users = append(users, queueItem.UserID)
+		}
+		byUser[queueItem.UserID] = append(byUser[queueItem.UserID], queueItem)
+	}
+
+	ordered := make([]models.Queue, 0, len(queueItems))
+	for round := 0; len(ordered) < len(queueItems); round++ {
+		var slots []models.Queue
+		for _, userID := range users {
+			if round < len(byUser[userID]) {
+				slots = append(slots, byUser[userID][round])
+			}
+		}
+
+		sort.SliceStable(slots, func(i, j int) bool {
+			return ranksBefore(slots[i], slots[j])
+		})
+		ordered = append(ordered, slots...)
+	}
+	return ordered
+}
+
+type decayStrategy struct {
+	halfLife time.Duration
+	now      func() time.Time
+}
+
+func (decayStrategy) Name() string { return Decay }
+
+// Order ranks queue items by the sum of their votes, each vote weighted by 2^(-age/half-life) where its age is the time
+// since it was last cast or changed. The votes of the queue items have to be loaded. Items with the same score are ranked
+// the same way as by the weight strategy.
+func (d decayStrategy) Order(queueItems []models.Queue) []models.Queue {
+	now := d.now()
+	scores := make(map[uint]float64, len(queueItems))
+	for _, queueItem := range queueItems {
+		scores[queueItem.ID] = DecayedScore(queueItem.Votes, d.halfLife, now)
+	}
+
+	ordered := append([]models.Queue(nil), queueItems...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := scores[ordered[i].ID], scores[ordered[j].ID]
+		// Scores this close are equal up to rounding, and are ranked by the tie breakers instead
+		if math.Abs(a-b) > 1e-9 {
+			return a > b
+		}
+		return ranksBefore(ordered[i], ordered[j])
+	})
+	return ordered
+}
+
+// DecayedScore sums the directions of the votes, each weighted by how many half-lives ago it was cast. A vote cast now
+// counts fully, a vote cast one half-life ago counts half.
+func DecayedScore(votes []models.Vote, halfLife time.Duration, now time.Time) float64 {
+	var score float64
+	for _, vote := range votes {
+		age := now.Sub(vote.UpdatedAt)
+		if age < 0 {
+			age = 0
+		}
+		score += float64(vote.Direction) * math.Exp2(-float64(age)/float64(halfLife))
+	}
+	return score
+}
+
+// PinFirst moves the queue items the host pinned ahead of the others, in ascending pin rank, leaving the order of the
+// unpinned items as the strategy chose it. The given slice is not modified.
+func PinFirst(queueItems []models.Queue) []models.Queue {
+	ordered := append([]models.Queue(nil), queueItems...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i].PinRank, ordered[j].PinRank
+		if a == 0 || b == 0 {
+			return a != 0 && b == 0
+		}
+		return a < b
+	})
+	return ordered
+}
+
+// ranksBefore reports whether a should be played before b in the canonical ranking: the highest weight first, then
+// the item that reached its weight first, then the lowest ID.
+func ranksBefore(a, b models.Queue) bool {
+	if a.Weight != b.Weight {
+		return a.Weight > b.Weight
+	}
+	if reachedA, reachedB := weightReachedAt(a), weightReachedAt(b); !reachedA.Equal(reachedB) {
+		return reachedA.Before(reachedB)
+	}
+	return a.ID < b.ID
+}
+
+// weightReachedAt returns when the queue item reached its weight, which is its creation time until its weight changes.
+func weightReachedAt(queueItem models.Queue) time.Time {
+	if queueItem.WeightReachedAt != nil {
+		return *queueItem.WeightReachedAt
+	}
+	return queueItem.CreatedAt
+}
+
+// arrivedBefore reports whether a was added to the queue before b.
+func arrivedBefore(a, b models.Queue) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
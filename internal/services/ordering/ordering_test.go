@@ -0,0 +1,191 @@
+package ordering_test
+
+import (
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/services/ordering"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// newQueueItem creates a queue item added by the user, the given number of minutes after the session started.
+func newQueueItem(id, userID uint, weight int, minute int) models.Queue {
+	return models.Queue{
+		Model:  gorm.Model{ID: id, CreatedAt: time.Date(2024, 1, 1, 20, minute, 0, 0, time.UTC)},
+		UserID: userID,
+		Weight: weight,
+	}
+}
+
+func ids(queueItems []models.Queue) []uint {
+	result := make([]uint, len(queueItems))
+	for i, queueItem := range queueItems {
+		result[i] = queueItem.ID
+	}
+	return result
+}
+
+func TestGet(t *testing.T) {
+	strategy, err := ordering.Get("")
+	assert.NoError(t, err)
+	assert.Equal(t, ordering.Default, strategy.Name())
+
+	for _, name := range ordering.Names() {
+		strategy, err := ordering.Get(name)
+		assert.NoError(t, err)
+		assert.Equal(t, name, strategy.Name())
+	}
+
+	_, err = ordering.Get("random")
+	assert.Error(t, err)
+}
+
+func TestArrival(t *testing.T) {
+	strategy, _ := ordering.Get(ordering.Arrival)
+
+	queueItems := []models.Queue{
+		newQueueItem(3, 1, 5, 2),
+		newQueueItem(1, 2, 0, 0),
+		newQueueItem(2, 1, 9, 1),
+	}
+	assert.Equal(t, []uint{1, 2, 3}, ids(strategy.Order(queueItems)))
+	// The given slice is left untouched
+	assert.Equal(t, []uint{3, 1, 2}, ids(queueItems))
+}
+
+func TestWeight(t *testing.T) {
+	strategy, _ := ordering.Get(ordering.Weight)
+
+	queueItems := []models.Queue{
+		newQueueItem(1, 1, 0, 0),
+		newQueueItem(2, 1, 3, 1),
+		newQueueItem(3, 2, 3, 2),
+		newQueueItem(4, 2, -1, 3),
+	}
+	assert.Equal(t, []uint{2, 3, 1, 4}, ids(strategy.Order(queueItems)))
+}
+
+func TestFairShare(t *testing.T) {
+	strategy, _ := ordering.Get(ordering.FairShare)
+
+	// User 1 floods the queue, users 2 and 3 add a track each
+	queueItems := []models.Queue{
+		newQueueItem(1, 1, 0, 0),
+		newQueueItem(2, 1, 4, 1),
+		newQueueItem(3, 1, 0, 2),
+		newQueueItem(4, 1, 0, 3),
+		newQueueItem(5, 2, 1, 4),
+		newQueueItem(6, 3, 0, 5),
+	}
+
+	// Round one holds the best item of every user ordered by weight, user 1's other items follow one per round
+	assert.Equal(t, []uint{2, 5, 6, 1, 3, 4}, ids(strategy.Order(queueItems)))
+}
+
+func TestFairShareRounds(t *testing.T) {
+	strategy, _ := ordering.Get(ordering.FairShare)
+
+	queueItems := []models.Queue{
+		newQueueItem(1, 1, 0, 0),
+		newQueueItem(2, 1, 0, 1),
+		newQueueItem(3, 2, 0, 2),
+		newQueueItem(4, 2, 2, 3),
+		newQueueItem(5, 3, 0, 4),
+	}
+
+	// Weight breaks ties within a round, arrival breaks ties within equal weights
+	assert.Equal(t, []uint{4, 1, 5, 2, 3}, ids(strategy.Order(queueItems)))
+}
+
+func TestEmptyQueue(t *testing.T) {
+	for _, name := range ordering.Names() {
+		strategy, _ := ordering.Get(name)
+		assert.Empty(t, strategy.Order(nil))
+	}
+}
+
+func TestWeightTieBreaking(t *testing.T) {
+	strategy, _ := ordering.Get(ordering.Weight)
+
+	reachedEarly := time.Date(2024, 1, 1, 21, 0, 0, 0, time.UTC)
+	reachedLate := time.Date(2024, 1, 1, 21, 30, 0, 0, time.UTC)
+
+	first := newQueueItem(1, 1, 2, 0)
+	first.WeightReachedAt = &reachedLate
+	second := newQueueItem(2, 2, 2, 1)
+	second.WeightReachedAt = &reachedEarly
+	// Items that were never voted on rank by when they were created
+	third := newQueueItem(3, 3, 0, 5)
+	fourth := newQueueItem(4, 3, 0, 5)
+
+	queueItems := []models.Queue{fourth, third, first, second}
+	assert.Equal(t, []uint{2, 1, 3, 4}, ids(strategy.Order(queueItems)))
+}
+
+func TestPinFirst(t *testing.T) {
+	strategy, _ := ordering.Get(ordering.Weight)
+
+	queueItems := []models.Queue{
+		newQueueItem(1, 1, 9, 0),
+		newQueueItem(2, 1, 5, 1),
+		newQueueItem(3, 2, 0, 2),
+		newQueueItem(4, 2, 1, 3),
+	}
+	queueItems[2].PinRank = 2
+	queueItems[3].PinRank = 1
+
+	// Pinned items play first in the host's order, the rest in the strategy's order
+	assert.Equal(t, []uint{4, 3, 1, 2}, ids(ordering.PinFirst(strategy.Order(queueItems))))
+	assert.Equal(t, []uint{1, 2, 3, 4}, ids(queueItems))
+}
+
+// votesAt creates votes in the given direction, cast at the given times.
+func votesAt(direction int, times ...time.Time) []models.Vote {
+	votes := make([]models.Vote, len(times))
+	for i, at := range times {
+		votes[i] = models.Vote{Model: gorm.Model{UpdatedAt: at}, Direction: direction}
+	}
+	return votes
+}
+
+func TestDecayedScore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+
+	assert.InDelta(t, 1.0, ordering.DecayedScore(votesAt(models.VoteUp, now), time.Hour, now), 1e-9)
+	assert.InDelta(t, 0.5, ordering.DecayedScore(votesAt(models.VoteUp, now.Add(-time.Hour)), time.Hour, now), 1e-9)
+	assert.InDelta(t, -0.25, ordering.DecayedScore(votesAt(models.VoteDown, now.Add(-2*time.Hour)), time.Hour, now), 1e-9)
+	assert.Zero(t, ordering.DecayedScore(nil, time.Hour, now))
+}
+
+func TestDecay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+	strategy, err := ordering.ForSettings(models.SessionSettings{QueueOrder: ordering.Decay, VoteHalfLifeMinutes: 60}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, ordering.Decay, strategy.Name())
+
+	early := now.Add(-3 * time.Hour)
+	queueItems := []models.Queue{
+		// Four upvotes from early in the night are worth half a fresh upvote
+		newQueueItem(1, 1, 4, 0),
+		newQueueItem(2, 2, 1, 1),
+		newQueueItem(3, 3, 0, 2),
+		newQueueItem(4, 4, 1, 3),
+	}
+	queueItems[0].Votes = votesAt(models.VoteUp, early, early, early, early)
+	queueItems[1].Votes = votesAt(models.VoteUp, now.Add(-10*time.Minute))
+	queueItems[3].Votes = votesAt(models.VoteUp, now.Add(-10*time.Minute))
+
+	// Items with the same score are ranked by the weight strategy's tie breakers
+	assert.Equal(t, []uint{2, 4, 1, 3}, ids(strategy.Order(queueItems)))
+}
+
+func TestForSettings(t *testing.T) {
+	strategy, err := ordering.ForSettings(models.SessionSettings{QueueOrder: ordering.FairShare}, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, ordering.FairShare, strategy.Name())
+
+	_, err = ordering.ForSettings(models.SessionSettings{QueueOrder: ordering.Decay}, time.Now())
+	assert.Error(t, err)
+}
@@ -0,0 +1,357 @@
+package playback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/queue"
+	"garrettpfoy/orbit-api/internal/services/spotify"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// This package drives the host's Spotify player from the Orbit queue. A coordinator per session polls the
+// host's player, and when the current track is about to end it adds the top ranked queue item to the host's Spotify
+// queue and marks it as now playing, so Spotify starts it once the current track has played to its end. Spotify has no
+// push notifications for player state, so polling is the only way to notice a track ending. Polls are spaced by the
+// time left in the current track, so a session does not spend its share of the Spotify rate limit on a player that is
+// known to be busy. The coordinator never interrupts a track the host started themselves, it queues the next item
+// after it instead. The coordinator also skips the now playing track once the session voted to skip it. The supervisor
+// runs a coordinator for every session that can be played, and stops it when the session ends.
+
+const (
+	// DefaultInterval is the shortest time between two polls of the host's player by default, used while the
+	// coordinator waits for Spotify to report a change it made.
+	DefaultInterval = time.Second
+	// DefaultMaxInterval is the longest time between two polls of the host's player by default. It bounds how long
+	// the coordinator takes to notice the host pausing or seeking, a skip vote or a track added to an empty queue.
+	DefaultMaxInterval = 10 * time.Second
+	// DefaultLead is how long before the end of a track the next one is added to the host's Spotify queue by default.
+	// It has to be longer than the interval, or the end of a track could fall between two polls.
+	DefaultLead = 5 * time.Second
+	// settleTime is how long Spotify is given to report a track the coordinator just started, during which
+	// the player reporting a stopped track is not mistaken for the player having stopped before reaching ours.
+	settleTime = 5 * time.Second
+)
+
+// Action is what a step of the coordinator did.
+type Action string
+
+const (
+	// ActionNone means the player is playing the now playing item and it is not about to end.
+	ActionNone Action = "none"
+	// ActionStarted means the next queue item was started on the host's device.
+	ActionStarted Action = "started"
+	// ActionQueued means the next queue item was added to the host's Spotify queue, to start once the current track ends.
+	ActionQueued Action = "queued"
+	// ActionWaiting means the player is playing a track that is not the now playing item, e.g. one the host started,
+	// and the now playing item waits in the host's Spotify queue.
+	ActionWaiting Action = "waiting"
+	// ActionSkipped means the session voted to skip the now playing item, and the next queue item was started.
+	ActionSkipped Action = "skipped"
+	// ActionPaused means the host paused the player, which the coordinator leaves alone.
+	ActionPaused Action = "paused"
+	// ActionSettling means a track was just started and Spotify has not reported it yet.
+	ActionSettling Action = "settling"
+	// ActionQueueEmpty means a track had to be started but nothing is queued.
+	ActionQueueEmpty Action = "queue_empty"
+	// ActionSessionNotOpen means a track had to be started but the session is paused or has ended.
+	ActionSessionNotOpen Action = "session_not_open"
+	// ActionNoDevice means a track had to be started but the host has no device to play it on.
+	ActionNoDevice Action = "no_device"
+)
+
+// SkipPolicy decides whether the session voted to skip its now playing queue item.
+type SkipPolicy interface {
+	// ShouldSkip reports whether the now playing queue item should be skipped
+	ShouldSkip(queueItem *models.Queue) (bool, error)
+}
+
+// Coordinator plays the queue of a single session on the host's Spotify player.
+type Coordinator struct {
+	sessionID   uint
+	queue       queue.QueueRepository
+	player      *spotify.Client
+	interval    time.Duration
+	maxInterval time.Duration
+	lead        time.Duration
+	skips       SkipPolicy
+	now         func() time.Time
+}
+
+// NewCoordinator creates a coordinator for the session that controls the host's player with the given client,
+// which should come from the token manager so the host's token is refreshed as it expires. The player is polled at
+// most every interval and at least every DefaultMaxInterval.
+func NewCoordinator(sessionID uint, queue queue.QueueRepository, player *spotify.Client, interval, lead time.Duration) *Coordinator {
+	maxInterval := DefaultMaxInterval
+	if maxInterval < interval {
+		maxInterval = interval
+	}
+	return &Coordinator{
+		sessionID:   sessionID,
+		queue:       queue,
+		player:      player,
+		interval:    interval,
+		maxInterval: maxInterval,
+		lead:        lead,
+		now:         time.Now,
+	}
+}
+
+// WithSkipPolicy makes the coordinator skip the now playing item when the policy says the session voted to skip it
+func (c *Coordinator) WithSkipPolicy(skips SkipPolicy) *Coordinator {
+	c.skips = skips
+	return c
+}
+
+// WithMaxInterval makes the coordinator poll the player at least every maxInterval, which must not be shorter than
+// its interval
+func (c *Coordinator) WithMaxInterval(maxInterval time.Duration) *Coordinator {
+	c.maxInterval = maxInterval
+	return c
+}
+
+// Run steps the coordinator until the context is cancelled, waiting between steps for as long as the player is known
+// not to need the coordinator. Failed steps are logged and retried after the longest wait, so a Spotify outage or an
+// expired token only pauses the session's queue.
+func (c *Coordinator) Run(ctx context.Context) {
+	var lastAction Action
+	for {
+		action, wait, err := c.step(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Playback of session %d failed: %v", c.sessionID, err)
+		} else if action != lastAction && action != ActionNone {
+			log.Printf("Playback of session %d: %s", c.sessionID, action)
+		}
+		lastAction = action
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Step polls the host's player once. It starts the next queue item if the player is not playing anything, and adds it
+// to the host's Spotify queue if the current track is ending or is not one of the session's.
+func (c *Coordinator) Step(ctx context.Context) (Action, error) {
+	action, _, err := c.step(ctx)
+	return action, err
+}
+
+// step polls the host's player once, and returns what it did and how long to wait before polling again.
+func (c *Coordinator) step(ctx context.Context) (Action, time.Duration, error) {
+	state, err := c.player.PlaybackState(ctx)
+	if err != nil {
+		return "", c.maxInterval, fmt.Errorf("error reading the player: %w", err)
+	}
+
+	current, err := c.queue.GetNowPlaying(c.sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		current = nil
+	} else if err != nil {
+		return "", c.maxInterval, fmt.Errorf("error loading the now playing item: %w", err)
+	}
+
+	// Nothing is loaded on any device, e.g. the session just started, the host closed Spotify or the queue ran dry
+	if state == nil || state.Item == nil {
+		return c.wait(c.startNext(ctx, ""))
+	}
+
+	remaining := time.Duration(state.Item.DurationMs-state.ProgressMs) * time.Millisecond
+	playingCurrent := current != nil && state.Item.URI == current.TrackURI
+	// A track that stopped before its end was paused by the host, at its end it simply finished
+	pausedByHost := !state.IsPlaying && state.ProgressMs > 0 && remaining > c.lead
+
+	if !playingCurrent {
+		if state.IsPlaying {
+			// The track is not ours, e.g. one the host picked or Spotify's autoplay, so it is played to its end. The
+			// now playing item waits in the host's Spotify queue, or the next queue item is added to it
+			if current != nil {
+				return ActionWaiting, c.clamp(remaining), nil
+			}
+			action, err := c.handOff(ctx, state.Device.ID)
+			return action, c.clamp(remaining), err
+		}
+
+		if current != nil && current.StartedAt != nil && c.now().Sub(*current.StartedAt) < settleTime {
+			return ActionSettling, c.interval, nil
+		}
+
+		// Nothing of the session is playing and the player is idle, so starting the queue interrupts nothing
+		if current == nil {
+			return c.wait(c.startNext(ctx, state.Device.ID))
+		}
+
+		// The now playing item waits behind a track the host paused, or the player stopped before reaching it
+		if pausedByHost {
+			return ActionPaused, c.maxInterval, nil
+		}
+		return c.wait(c.play(ctx, state.Device.ID, current))
+	}
+
+	if c.skips != nil {
+		skip, err := c.skips.ShouldSkip(current)
+		if err != nil {
+			return "", c.maxInterval, fmt.Errorf("error counting skip votes: %w", err)
+		}
+		if skip {
+			return c.wait(c.skip(ctx, current, state.Device.ID))
+		}
+	}
+
+	if pausedByHost {
+		return ActionPaused, c.maxInterval, nil
+	}
+	if !state.IsPlaying {
+		return c.wait(c.startNext(ctx, state.Device.ID))
+	}
+
+	if remaining <= c.lead {
+		action, err := c.handOff(ctx, state.Device.ID)
+		return action, c.clamp(remaining), err
+	}
+	return ActionNone, c.clamp(remaining - c.lead), nil
+}
+
+// wait returns how long to wait after an action that did not depend on the time left in the current track: briefly
+// after changing the player, so the change is confirmed, and for the longest wait when there is nothing to do.
+func (c *Coordinator) wait(action Action, err error) (Action, time.Duration, error) {
+	switch {
+	case err != nil:
+		return action, c.maxInterval, err
+	case action == ActionStarted || action == ActionSkipped:
+		return action, c.interval, nil
+	default:
+		return action, c.maxInterval, nil
+	}
+}
+
+// clamp bounds a wait to between the interval and the longest wait.
+func (c *Coordinator) clamp(wait time.Duration) time.Duration {
+	if wait < c.interval {
+		return c.interval
+	}
+	if wait > c.maxInterval {
+		return c.maxInterval
+	}
+	return wait
+}
+
+// startNext pops the next queue item and plays it on the given device, or on a device of the host if none is given.
+// The item goes back in the queue if it could not be played.
+func (c *Coordinator) startNext(ctx context.Context, deviceID string) (Action, error) {
+	if deviceID == "" {
+		device, ok, err := c.pickDevice(ctx)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return ActionNoDevice, nil
+		}
+		deviceID = device.ID
+	}
+
+	return c.popNext(ActionStarted, func(next *models.Queue) error {
+		return c.player.Play(ctx, deviceID, next.TrackURI)
+	})
+}
+
+// handOff pops the next queue item and adds it to the host's Spotify queue on the given device, so it starts once the
+// current track has ended. The item goes back in the queue if it could not be added.
+func (c *Coordinator) handOff(ctx context.Context, deviceID string) (Action, error) {
+	return c.popNext(ActionQueued, func(next *models.Queue) error {
+		return c.player.AddToQueue(ctx, next.TrackURI, deviceID)
+	})
+}
+
+// popNext pops the next queue item and sends it to the player, returning done once it was sent. The item goes back in
+// the queue if it could not be sent.
+func (c *Coordinator) popNext(done Action, send func(next *models.Queue) error) (Action, error) {
+	next, err := c.queue.PopNextQueueItem(c.sessionID, c.now())
+	if errors.Is(err, queue.ErrQueueEmpty) {
+		return ActionQueueEmpty, nil
+	}
+	if errors.Is(err, queue.ErrSessionNotOpen) {
+		return ActionSessionNotOpen, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error popping the next queue item: %w", err)
+	}
+
+	if err := send(next); err != nil {
+		if requeueErr := c.queue.RequeueQueueItem(next.ID); requeueErr != nil {
+			log.Printf("Failed to requeue queue item %d of session %d: %v", next.ID, c.sessionID, requeueErr)
+		}
+		if errors.Is(err, spotify.ErrNoActiveDevice) {
+			return ActionNoDevice, nil
+		}
+		return "", fmt.Errorf("error playing %s: %w", next.TrackURI, err)
+	}
+	return done, nil
+}
+
+// play starts the now playing item on the given device. It is used when the item was added to the host's Spotify queue
+// but the player stopped before reaching it.
+func (c *Coordinator) play(ctx context.Context, deviceID string, current *models.Queue) (Action, error) {
+	if err := c.player.Play(ctx, deviceID, current.TrackURI); err != nil {
+		if errors.Is(err, spotify.ErrNoActiveDevice) {
+			return ActionNoDevice, nil
+		}
+		return "", fmt.Errorf("error playing %s: %w", current.TrackURI, err)
+	}
+	return ActionStarted, nil
+}
+
+// skip records the now playing item as skipped and starts the next queue item in its place. If nothing can be started the
+// player is paused, or it would keep playing the track the session voted against.
+func (c *Coordinator) skip(ctx context.Context, current *models.Queue, deviceID string) (Action, error) {
+	if err := c.queue.FinishQueueItem(current.ID, models.QueueStatusSkipped, c.now()); err != nil {
+		return "", fmt.Errorf("error skipping queue item %d: %w", current.ID, err)
+	}
+
+	action, err := c.startNext(ctx, deviceID)
+	if err != nil {
+		return "", err
+	}
+	switch action {
+	case ActionStarted:
+		return ActionSkipped, nil
+	case ActionQueueEmpty, ActionSessionNotOpen:
+		if err := c.player.Pause(ctx, deviceID); err != nil {
+			return "", fmt.Errorf("error pausing the skipped track: %w", err)
+		}
+	}
+	return action, nil
+}
+
+// pickDevice chooses the device to start playback on: the active device, or else the first one that can be controlled.
+func (c *Coordinator) pickDevice(ctx context.Context) (spotify.Device, bool, error) {
+	devices, err := c.player.Devices(ctx)
+	if err != nil {
+		return spotify.Device{}, false, fmt.Errorf("error listing devices: %w", err)
+	}
+
+	var fallback *spotify.Device
+	for i, device := range devices {
+		if device.IsRestricted {
+			continue
+		}
+		if device.IsActive {
+			return device, true, nil
+		}
+		if fallback == nil {
+			fallback = &devices[i]
+		}
+	}
+	if fallback == nil {
+		return spotify.Device{}, false, nil
+	}
+	return *fallback, true, nil
+}
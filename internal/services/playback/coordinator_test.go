@@ -0,0 +1,360 @@
+package playback_test
+
+import (
+	"context"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/access_token"
+	"garrettpfoy/orbit-api/internal/repositories/queue"
+	"garrettpfoy/orbit-api/internal/services/encryption"
+	"garrettpfoy/orbit-api/internal/services/playback"
+	"garrettpfoy/orbit-api/internal/services/spotify"
+	"garrettpfoy/orbit-api/internal/services/token_manager"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection to an in-memory database opens a new, empty database
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	models.SetEncryptionService(encryption.NewEncryptionService("abcdefghijklmnopqrstuvwxyz123456"))
+
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.Queue{}, &models.Track{}, &models.AccessToken{})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// setupSession creates a session whose queue holds the given tracks, in order, and a fake Spotify server with a
+// three minute track for each of them.
+func setupSession(t *testing.T, trackIDs ...string) (*gorm.DB, *queue.GormQueueRepository, *spotify.FakeServer, uint) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	fake := spotify.NewFakeServer()
+	t.Cleanup(fake.Close)
+
+	session := &models.Session{Slug: "party", HostID: 1}
+	assert.NoError(t, db.Create(session).Error)
+
+	queueRepo := queue.NewGormQueueRepository(db)
+	for i, id := range trackIDs {
+		fake.AddTrack(spotify.Track{ID: id, Name: fmt.Sprintf("Track %d", i), DurationMs: 180000})
+		assert.NoError(t, queueRepo.CreateQueueItem(&models.Queue{TrackURI: spotify.TrackURI(id), SessionID: session.ID, UserID: 1}))
+	}
+
+	return db, queueRepo, fake, session.ID
+}
+
+func step(t *testing.T, coordinator *playback.Coordinator, expected playback.Action) {
+	action, err := coordinator.Step(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, expected, action)
+}
+
+func TestStartsQueueOnIdlePlayer(t *testing.T) {
+	_, queueRepo, fake, sessionID := setupSession(t, "first", "second")
+	fake.AddDevice(spotify.Device{ID: "phone", IsRestricted: true})
+	fake.AddDevice(spotify.Device{ID: "speaker"})
+
+	coordinator := playback.NewCoordinator(sessionID, queueRepo, fake.Client(), time.Second, 2*time.Second)
+	step(t, coordinator, playback.ActionStarted)
+
+	state := fake.Playback()
+	assert.True(t, state.IsPlaying)
+	assert.Equal(t, "speaker", state.Device.ID)
+	assert.Equal(t, "spotify:track:first", state.Item.URI)
+
+	nowPlaying, err := queueRepo.GetNowPlaying(sessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, "spotify:track:first", nowPlaying.TrackURI)
+
+	// Nothing happens while the track plays
+	fake.Advance(time.Minute)
+	step(t, coordinator, playback.ActionNone)
+}
+
+func TestQueuesNextTrackNearEnd(t *testing.T) {
+	_, queueRepo, fake, sessionID := setupSession(t, "first", "second")
+	fake.AddDevice(spotify.Device{ID: "speaker", IsActive: true})
+
+	coordinator := playback.NewCoordinator(sessionID, queueRepo, fake.Client(), time.Second, 2*time.Second)
+	step(t, coordinator, playback.ActionStarted)
+
+	// The next track is added to the host's Spotify queue, the current one plays to its end
+	fake.Advance(179 * time.Second)
+	step(t, coordinator, playback.ActionQueued)
+	assert.Equal(t, "spotify:track:first", fake.Playback().Item.URI)
+	assert.True(t, fake.Playback().IsPlaying)
+	assert.Equal(t, []string{"spotify:track:second"}, fake.Queue())
+
+	history, err := queueRepo.GetHistory(sessionID, 0)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+	assert.Equal(t, "spotify:track:first", history[0].TrackURI)
+	assert.Equal(t, models.QueueStatusPlayed, history[0].Status)
+
+	// Spotify moves on to the queued track by itself
+	fake.Advance(2 * time.Second)
+	assert.Equal(t, "spotify:track:second", fake.Playback().Item.URI)
+	assert.Equal(t, 1000, fake.Playback().ProgressMs)
+	step(t, coordinator, playback.ActionNone)
+
+	// The queue is empty once the second track ends, so Spotify stops and the last track is recorded as played
+	fake.Advance(3 * time.Minute)
+	step(t, coordinator, playback.ActionQueueEmpty)
+
+	history, err = queueRepo.GetHistory(sessionID, 0)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+}
+
+func TestLeavesHostMusicAlone(t *testing.T) {
+	_, queueRepo, fake, sessionID := setupSession(t, "first")
+	fake.AddDevice(spotify.Device{ID: "speaker", IsActive: true})
+	own := fake.AddTrack(spotify.Track{ID: "own", Name: "Host's Track", DurationMs: 60000})
+
+	// The host is playing a track of their own when the session starts
+	fake.SetPlayback(&spotify.PlaybackState{Device: spotify.Device{ID: "speaker", IsActive: true}, Item: &own, ProgressMs: 10000, IsPlaying: true})
+
+	coordinator := playback.NewCoordinator(sessionID, queueRepo, fake.Client(), time.Second, 2*time.Second)
+	step(t, coordinator, playback.ActionQueued)
+	assert.Equal(t, "spotify:track:own", fake.Playback().Item.URI)
+	assert.Equal(t, []string{"spotify:track:first"}, fake.Queue())
+
+	// The queued item waits for the host's track to end
+	fake.Advance(10 * time.Second)
+	step(t, coordinator, playback.ActionWaiting)
+	assert.Equal(t, "spotify:track:own", fake.Playback().Item.URI)
+
+	fake.Advance(time.Minute)
+	assert.Equal(t, "spotify:track:first", fake.Playback().Item.URI)
+	step(t, coordinator, playback.ActionNone)
+}
+
+func TestStartsNextTrackAfterMissedEnd(t *testing.T) {
+	_, queueRepo, fake, sessionID := setupSession(t, "first", "second")
+	fake.AddDevice(spotify.Device{ID: "speaker", IsActive: true})
+
+	coordinator := playback.NewCoordinator(sessionID, queueRepo, fake.Client(), time.Second, 2*time.Second)
+	step(t, coordinator, playback.ActionStarted)
+
+	// The track ended between two polls and the player stopped
+	fake.Advance(4 * time.Minute)
+	assert.False(t, fake.Playback().IsPlaying)
+
+	step(t, coordinator, playback.ActionStarted)
+	assert.Equal(t, "spotify:track:second", fake.Playback().Item.URI)
+	assert.Equal(t, "speaker", fake.Playback().Device.ID)
+}
+
+func TestLeavesPausedPlayerAlone(t *testing.T) {
+	_, queueRepo, fake, sessionID := setupSession(t, "first", "second")
+	fake.AddDevice(spotify.Device{ID: "speaker", IsActive: true})
+
+	coordinator := playback.NewCoordinator(sessionID, queueRepo, fake.Client(), time.Second, 2*time.Second)
+	step(t, coordinator, playback.ActionStarted)
+
+	fake.Advance(time.Minute)
+	assert.NoError(t, fake.Client().Pause(context.Background(), ""))
+
+	step(t, coordinator, playback.ActionPaused)
+	assert.Equal(t, "spotify:track:first", fake.Playback().Item.URI)
+	assert.False(t, fake.Playback().IsPlaying)
+
+	queueItems, err := queueRepo.GetQueueItemsBySessionID(sessionID, nil)
+	assert.NoError(t, err)
+	assert.Len(t, queueItems, 1)
+}
+
+func TestWaitsForDevice(t *testing.T) {
+	_, queueRepo, fake, sessionID := setupSession(t, "first")
+
+	coordinator := playback.NewCoordinator(sessionID, queueRepo, fake.Client(), time.Second, 2*time.Second)
+	step(t, coordinator, playback.ActionNoDevice)
+
+	// The item stays queued until a device shows up
+	queueItems, err := queueRepo.GetQueueItemsBySessionID(sessionID, nil)
+	assert.NoError(t, err)
+	assert.Len(t, queueItems, 1)
+
+	fake.AddDevice(spotify.Device{ID: "speaker"})
+	step(t, coordinator, playback.ActionStarted)
+	assert.Equal(t, "spotify:track:first", fake.Playback().Item.URI)
+}
+
+func TestWaitsForPausedSession(t *testing.T) {
+	db, queueRepo, fake, sessionID := setupSession(t, "first")
+	fake.AddDevice(spotify.Device{ID: "speaker"})
+
+	assert.NoError(t, db.Model(&models.Session{}).Where("id = ?", sessionID).Update("status", models.SessionStatusPaused).Error)
+
+	coordinator := playback.NewCoordinator(sessionID, queueRepo, fake.Client(), time.Second, 2*time.Second)
+	step(t, coordinator, playback.ActionSessionNotOpen)
+
+	// The item stays queued until the host resumes the session
+	queueItems, err := queueRepo.GetQueueItemsBySessionID(sessionID, nil)
+	assert.NoError(t, err)
+	assert.Len(t, queueItems, 1)
+
+	assert.NoError(t, db.Model(&models.Session{}).Where("id = ?", sessionID).Update("status", models.SessionStatusOpen).Error)
+	step(t, coordinator, playback.ActionStarted)
+	assert.Equal(t, "spotify:track:first", fake.Playback().Item.URI)
+}
+
+func TestRequeuesWhenDeviceDisappears(t *testing.T) {
+	_, queueRepo, fake, sessionID := setupSession(t, "first", "second")
+	fake.AddDevice(spotify.Device{ID: "speaker", IsActive: true})
+
+	coordinator := playback.NewCoordinator(sessionID, queueRepo, fake.Client(), time.Second, 2*time.Second)
+	step(t, coordinator, playback.ActionStarted)
+
+	// The speaker is still reported by the player, but refuses commands
+	fake.Advance(179 * time.Second)
+	state := fake.Playback()
+	state.Device.ID = "gone"
+	fake.SetPlayback(state)
+
+	step(t, coordinator, playback.ActionNoDevice)
+
+	queueItems, err := queueRepo.GetQueueItemsBySessionID(sessionID, nil)
+	assert.NoError(t, err)
+	assert.Len(t, queueItems, 1)
+	assert.Equal(t, "spotify:track:second", queueItems[0].TrackURI)
+}
+
+func TestRefreshesHostToken(t *testing.T) {
+	db, queueRepo, fake, sessionID := setupSession(t, "first")
+	fake.AddDevice(spotify.Device{ID: "speaker", IsActive: true})
+
+	// The host's stored token has expired, the token manager has to refresh it before the player can be read
+	tokens := access_token.NewGormAccessTokenRepository(db)
+	assert.NoError(t, tokens.CreateAccessToken(&models.AccessToken{
+		UserID:       1,
+		AccessToken:  "expired_access_token",
+		RefreshToken: "host_refresh_token",
+		ExpiryTime:   time.Now().Add(-time.Hour),
+		SessionID:    &sessionID,
+	}))
+	manager := token_manager.NewManager(tokens, &oauth2.Config{
+		ClientID: "orbit",
+		Endpoint: oauth2.Endpoint{TokenURL: fake.TokenURL(), AuthStyle: oauth2.AuthStyleInParams},
+	}, token_manager.DefaultRefreshMargin)
+
+	player := spotify.NewClient(manager.ClientForSession(context.Background(), sessionID), fake.URL)
+	coordinator := playback.NewCoordinator(sessionID, queueRepo, player, time.Second, 2*time.Second)
+	step(t, coordinator, playback.ActionStarted)
+
+	stored, err := tokens.GetAccessTokenBySessionID(sessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, spotify.FakeAccessToken, stored.AccessToken)
+	assert.True(t, stored.ExpiryTime.After(time.Now()))
+}
+
+func TestRun(t *testing.T) {
+	_, queueRepo, fake, sessionID := setupSession(t, "first")
+	fake.AddDevice(spotify.Device{ID: "speaker", IsActive: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		playback.NewCoordinator(sessionID, queueRepo, fake.Client(), 10*time.Millisecond, 20*time.Millisecond).Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		state := fake.Playback()
+		return state != nil && state.IsPlaying
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestRunBacksOffWhilePlaying(t *testing.T) {
+	_, queueRepo, fake, sessionID := setupSession(t, "first")
+	fake.AddDevice(spotify.Device{ID: "speaker", IsActive: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		playback.NewCoordinator(sessionID, queueRepo, fake.Client(), 10*time.Millisecond, 20*time.Millisecond).
+			WithMaxInterval(100 * time.Millisecond).
+			Run(ctx)
+		close(done)
+	}()
+
+	// With minutes left in the track the player is polled every 100ms, not every 10ms
+	time.Sleep(500 * time.Millisecond)
+	cancel()
+	<-done
+
+	polls := 0
+	for _, request := range fake.Requests() {
+		if request == "GET /me/player" {
+			polls++
+		}
+	}
+	assert.Equal(t, "spotify:track:first", fake.Playback().Item.URI)
+	assert.GreaterOrEqual(t, polls, 3)
+	assert.LessOrEqual(t, polls, 10)
+}
+
+// skipPolicy skips the queue items whose track URIs it holds
+type skipPolicy map[string]bool
+
+func (p skipPolicy) ShouldSkip(queueItem *models.Queue) (bool, error) {
+	return p[queueItem.TrackURI], nil
+}
+
+func TestSkipsVotedTrack(t *testing.T) {
+	_, queueRepo, fake, sessionID := setupSession(t, "first", "second")
+	fake.AddDevice(spotify.Device{ID: "speaker", IsActive: true})
+
+	skips := skipPolicy{}
+	coordinator := playback.NewCoordinator(sessionID, queueRepo, fake.Client(), time.Second, 2*time.Second).WithSkipPolicy(skips)
+	step(t, coordinator, playback.ActionStarted)
+	fake.Advance(30 * time.Second)
+	step(t, coordinator, playback.ActionNone)
+
+	skips["spotify:track:first"] = true
+	step(t, coordinator, playback.ActionSkipped)
+	assert.Equal(t, "spotify:track:second", fake.Playback().Item.URI)
+
+	history, err := queueRepo.GetHistory(sessionID, 0)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+	assert.Equal(t, "spotify:track:first", history[0].TrackURI)
+	assert.Equal(t, models.QueueStatusSkipped, history[0].Status)
+
+	// With nothing left to play, skipping pauses the player
+	fake.Advance(10 * time.Second)
+	skips["spotify:track:second"] = true
+	step(t, coordinator, playback.ActionQueueEmpty)
+	assert.False(t, fake.Playback().IsPlaying)
+
+	history, err = queueRepo.GetHistory(sessionID, 0)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, models.QueueStatusSkipped, history[0].Status)
+
+	// The paused track is no longer ours, so the coordinator keeps waiting for the queue
+	step(t, coordinator, playback.ActionQueueEmpty)
+}
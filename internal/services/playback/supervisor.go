@@ -0,0 +1,177 @@
+package playback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/queue"
+	"garrettpfoy/orbit-api/internal/services/spotify"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SessionSource lists the sessions whose queue should be played.
+type SessionSource interface {
+	// GetPlayableSessions retrieves the sessions that have not ended and have their host's access token linked
+	GetPlayableSessions() ([]models.Session, error)
+}
+
+// PlayerFactory returns the client that controls the player of the host of a session, e.g. one whose HTTP client
+// comes from the token manager so the host's token is refreshed as it expires. The client is used until ctx is done.
+type PlayerFactory func(ctx context.Context, sessionID uint) *spotify.Client
+
+// Supervisor runs a coordinator for every playable session. It checks the sessions every scan interval, starting a
+// coordinator for each session that became playable and stopping the coordinator of each session that ended or lost
+// its host token.
+type Supervisor struct {
+	sessions SessionSource
+	queue    queue.QueueRepository
+	players  PlayerFactory
+	skips    SkipPolicy
+	interval time.Duration
+	lead     time.Duration
+	scan     time.Duration
+
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc
+}
+
+// NewSupervisor creates a supervisor whose coordinators poll the players at most every interval and queue the next
+// track lead before the end of the current one, checking for sessions to start and stop every scan.
+func NewSupervisor(sessions SessionSource, queue queue.QueueRepository, players PlayerFactory, interval, lead, scan time.Duration) *Supervisor {
+	return &Supervisor{
+		sessions: sessions,
+		queue:    queue,
+		players:  players,
+		interval: interval,
+		lead:     lead,
+		scan:     scan,
+		running:  make(map[uint]context.CancelFunc),
+	}
+}
+
+// WithSkipPolicy makes the coordinators skip the now playing item when the policy says the session voted to skip it
+func (s *Supervisor) WithSkipPolicy(skips SkipPolicy) *Supervisor {
+	s.skips = skips
+	return s
+}
+
+// Run syncs the coordinators with the playable sessions every scan until the context is cancelled, which stops every
+// coordinator.
+func (s *Supervisor) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.scan)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Sync(ctx); err != nil {
+			log.Printf("Failed to sync playback coordinators: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			s.stopAll()
+			return
+		}
+	}
+}
+
+// Sync starts a coordinator for every playable session that has none, and stops the coordinators of sessions that
+// are no longer playable.
+func (s *Supervisor) Sync(ctx context.Context) error {
+	playable, err := s.sessions.GetPlayableSessions()
+	if err != nil {
+		return fmt.Errorf("failed to find playable sessions: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[uint]struct{}, len(playable))
+	for _, session := range playable {
+		wanted[session.ID] = struct{}{}
+		if _, ok := s.running[session.ID]; ok {
+			continue
+		}
+
+		coordinatorCtx, cancel := context.WithCancel(ctx)
+		coordinator := NewCoordinator(session.ID, s.queue, s.players(coordinatorCtx, session.ID), s.interval, s.lead)
+		if s.skips != nil {
+			coordinator.WithSkipPolicy(s.skips)
+		}
+		s.running[session.ID] = cancel
+		go coordinator.Run(coordinatorCtx)
+		log.Printf("Started playback of session %d", session.ID)
+	}
+
+	for sessionID, cancel := range s.running {
+		if _, ok := wanted[sessionID]; !ok {
+			cancel()
+			delete(s.running, sessionID)
+			log.Printf("Stopped playback of session %d", sessionID)
+		}
+	}
+	return nil
+}
+
+// StopPlayback stops the coordinator of the session, and pauses the host's player if it is playing the session's now
+// playing item. A track the host plays themselves is left alone. It is called when the session ends, before its host's
+// token is unlinked, and the coordinator is not started again as the session is no longer playable.
+func (s *Supervisor) StopPlayback(sessionID uint) error {
+	s.mu.Lock()
+	if cancel, ok := s.running[sessionID]; ok {
+		cancel()
+		delete(s.running, sessionID)
+		log.Printf("Stopped playback of session %d", sessionID)
+	}
+	s.mu.Unlock()
+
+	current, err := s.queue.GetNowPlaying(sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error loading the now playing item: %w", err)
+	}
+
+	ctx := context.Background()
+	player := s.players(ctx, sessionID)
+	state, err := player.PlaybackState(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading the player: %w", err)
+	}
+	if state == nil || state.Item == nil || !state.IsPlaying || state.Item.URI != current.TrackURI {
+		return nil
+	}
+	if err := player.Pause(ctx, state.Device.ID); err != nil && !errors.Is(err, spotify.ErrNoActiveDevice) {
+		return fmt.Errorf("error pausing the player: %w", err)
+	}
+	return nil
+}
+
+// Running returns the IDs of the sessions that have a coordinator running.
+func (s *Supervisor) Running() []uint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessionIDs := make([]uint, 0, len(s.running))
+	for sessionID := range s.running {
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	return sessionIDs
+}
+
+// stopAll stops every coordinator.
+func (s *Supervisor) stopAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sessionID, cancel := range s.running {
+		cancel()
+		delete(s.running, sessionID)
+	}
+}
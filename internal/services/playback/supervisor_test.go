@@ -0,0 +1,108 @@
+package playback_test
+
+import (
+	"context"
+	"errors"
+	"garrettpfoy/orbit-api/internal/handlers/host/auth"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/access_token"
+	"garrettpfoy/orbit-api/internal/repositories/queue"
+	"garrettpfoy/orbit-api/internal/repositories/session"
+	"garrettpfoy/orbit-api/internal/repositories/user"
+	"garrettpfoy/orbit-api/internal/services/lifecycle"
+	orbitOAuth2 "garrettpfoy/orbit-api/internal/services/oauth2"
+	"garrettpfoy/orbit-api/internal/services/playback"
+	"garrettpfoy/orbit-api/internal/services/spotify"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+func TestSupervisor(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	fake := spotify.NewFakeServer()
+	t.Cleanup(fake.Close)
+	fake.AddDevice(spotify.Device{ID: "speaker", IsActive: true})
+	fake.AddTrack(spotify.Track{ID: "first", Name: "Track 0", DurationMs: 180000})
+
+	// The host signs in with Spotify and starts a session, which links their token to it
+	users := user.NewGormUserRepository(db)
+	linker := auth.NewSpotifyUserLinker(users, access_token.NewGormAccessTokenRepository(db))
+	host, err := linker.LinkUser(context.Background(), &orbitOAuth2.Profile{Subject: "spotify_host", DisplayName: "Host"}, &oauth2.Token{
+		AccessToken:  "host_access_token",
+		RefreshToken: "host_refresh_token",
+		Expiry:       time.Now().Add(time.Hour),
+	})
+	assert.NoError(t, err)
+
+	sessions := session.NewGormSessionRepository(db)
+	hosted := &models.Session{Slug: "party", HostID: host.ID}
+	assert.NoError(t, sessions.CreateSession(hosted))
+
+	queueRepo := queue.NewGormQueueRepository(db)
+	assert.NoError(t, queueRepo.CreateQueueItem(&models.Queue{TrackURI: spotify.TrackURI("first"), SessionID: hosted.ID, UserID: host.ID}))
+
+	// A session whose host signed in with Google has no token, so it can not be played
+	email := "guest@example.com"
+	guest := &models.User{Username: "guest", Email: &email}
+	assert.NoError(t, users.CreateUser(guest))
+	assert.NoError(t, sessions.CreateSession(&models.Session{Slug: "no-token", HostID: guest.ID}))
+
+	players := func(ctx context.Context, sessionID uint) *spotify.Client {
+		return fake.Client()
+	}
+	supervisor := playback.NewSupervisor(sessions, queueRepo, players, 10*time.Millisecond, 20*time.Millisecond, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	assert.NoError(t, supervisor.Sync(ctx))
+	assert.Equal(t, []uint{hosted.ID}, supervisor.Running())
+	assert.Eventually(t, func() bool {
+		state := fake.Playback()
+		return state != nil && state.Item != nil && state.Item.URI == "spotify:track:first"
+	}, time.Second, 10*time.Millisecond)
+
+	// Syncing again does not start a second coordinator
+	assert.NoError(t, supervisor.Sync(ctx))
+	assert.Len(t, supervisor.Running(), 1)
+
+	// Ending the session stops its coordinator and pauses the host's player before the host's token is unlinked
+	tokens := access_token.NewGormAccessTokenRepository(db)
+	_, err = lifecycle.NewService(sessions, tokens).WithPlayback(supervisor).End(host.ID, hosted.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, supervisor.Running())
+	assert.False(t, fake.Playback().IsPlaying)
+	_, err = tokens.GetAccessTokenBySessionID(hosted.ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	// The ended session is not played again
+	assert.NoError(t, supervisor.Sync(ctx))
+	assert.Empty(t, supervisor.Running())
+}
+
+func TestStopPlaybackLeavesHostMusicAlone(t *testing.T) {
+	_, queueRepo, fake, sessionID := setupSession(t, "first")
+	fake.AddDevice(spotify.Device{ID: "speaker", IsActive: true})
+	own := fake.AddTrack(spotify.Track{ID: "own", Name: "Host's Track", DurationMs: 60000})
+
+	players := func(ctx context.Context, sessionID uint) *spotify.Client {
+		return fake.Client()
+	}
+	supervisor := playback.NewSupervisor(nil, queueRepo, players, time.Second, 2*time.Second, time.Hour)
+
+	// Nothing of the session ever played
+	assert.NoError(t, supervisor.StopPlayback(sessionID))
+
+	// The session's track was queued behind the host's own track, which keeps playing
+	_, err := queueRepo.PopNextQueueItem(sessionID, time.Now())
+	assert.NoError(t, err)
+	fake.SetPlayback(&spotify.PlaybackState{Device: spotify.Device{ID: "speaker", IsActive: true}, Item: &own, ProgressMs: 10000, IsPlaying: true})
+	assert.NoError(t, supervisor.StopPlayback(sessionID))
+	assert.True(t, fake.Playback().IsPlaying)
+}
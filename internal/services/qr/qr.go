@@ -0,0 +1,192 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/url"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// This package renders the QR codes hosts print so guests can join their session by scanning it. Codes are rendered
+// as PNG for printing as is, or as SVG for scaling into a layout, optionally with a logo over their center. A logo
+// hides the modules beneath it, so codes with a logo are always rendered with the highest error correction.
+
+const (
+	// DefaultSize is the width and height of a rendered code in pixels unless another is asked for.
+	DefaultSize = 256
+	// MinSize is the smallest width and height a code is rendered at, below which phones struggle to scan it.
+	MinSize = 64
+	// MaxSize is the largest width and height a code is rendered at.
+	MaxSize = 2048
+	// DefaultLevel is the error correction level used unless another is asked for.
+	DefaultLevel = "M"
+	// logoFraction is the share of the width of a code its logo covers, small enough for the highest error correction
+	// level to recover the modules beneath it.
+	logoFraction = 0.2
+)
+
+// levels maps the standard names of the error correction levels to their recovery levels, from 7% to 30% of the code
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// Options configures how a code is rendered.
+type Options struct {
+	// Size is the width and height of the code in pixels, DefaultSize if zero
+	Size int
+	// Level is the error correction level, one of L, M, Q and H, DefaultLevel if empty
+	Level string
+	// Logo is drawn over the center of the code if it is not nil
+	Logo image.Image
+}
+
+// JoinURL builds the public URL guests join a session at, the slug of the session appended to the base URL.
+func JoinURL(baseURL, slug string) (string, error) {
+	if slug == "" {
+		return "", fmt.Errorf("slug is empty")
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return "", fmt.Errorf("join base URL %q is not an absolute URL", baseURL)
+	}
+	return base.JoinPath(slug).String(), nil
+}
+
+// PNG renders the content as a PNG image of a QR code.
+func PNG(content string, options Options) ([]byte, error) {
+	code, size, err := encode(content, options)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), code.Image(size), image.Point{}, draw.Src)
+	if options.Logo != nil {
+		overlay(img, options.Logo)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("error encoding PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders the content as an SVG image of a QR code. Each row of dark modules is drawn as runs of one path, and the
+// view box is measured in modules, so the code stays sharp at any size it is scaled to.
+func SVG(content string, options Options) ([]byte, error) {
+	code, size, err := encode(content, options)
+	if err != nil {
+		return nil, err
+	}
+
+	bitmap := code.Bitmap()
+	modules := len(bitmap)
+
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, modules, modules)
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="#fff"/>`, modules, modules)
+	fmt.Fprintf(&svg, `<path d="%s" fill="#000"/>`, path.String())
+	if options.Logo != nil {
+		var logo bytes.Buffer
+		if err := png.Encode(&logo, options.Logo); err != nil {
+			return nil, fmt.Errorf("error encoding logo: %w", err)
+		}
+		side := float64(modules) * logoFraction
+		offset := (float64(modules) - side) / 2
+		fmt.Fprintf(&svg, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="#fff"/>`, offset, offset, side, side)
+		fmt.Fprintf(&svg, `<image x="%.2f" y="%.2f" width="%.2f" height="%.2f" href="data:image/png;base64,%s"/>`,
+			offset, offset, side, side, base64.StdEncoding.EncodeToString(logo.Bytes()))
+	}
+	svg.WriteString(`</svg>`)
+	return svg.Bytes(), nil
+}
+
+// ParseLevel checks an error correction level, returning DefaultLevel for an empty one.
+func ParseLevel(level string) (string, error) {
+	if level == "" {
+		return DefaultLevel, nil
+	}
+	level = strings.ToUpper(level)
+	if _, ok := levels[level]; !ok {
+		return "", fmt.Errorf("error correction level must be one of L, M, Q and H")
+	}
+	return level, nil
+}
+
+// encode checks the options and encodes the content, returning the code and the size to render it at.
+func encode(content string, options Options) (*qrcode.QRCode, int, error) {
+	size := options.Size
+	if size == 0 {
+		size = DefaultSize
+	}
+	if size < MinSize || size > MaxSize {
+		return nil, 0, fmt.Errorf("size must be between %d and %d pixels", MinSize, MaxSize)
+	}
+
+	level, err := ParseLevel(options.Level)
+	if err != nil {
+		return nil, 0, err
+	}
+	if options.Logo != nil {
+		level = "H"
+	}
+
+	code, err := qrcode.New(content, levels[level])
+	if err != nil {
+		return nil, 0, fmt.Errorf("error encoding QR code: %w", err)
+	}
+	return code, size, nil
+}
+
+// overlay draws the logo scaled into a white square over the center of the image. The logo is scaled by nearest
+// neighbor, which keeps the crisp edges logos usually have.
+func overlay(img *image.RGBA, logo image.Image) {
+	size := img.Bounds().Dx()
+	side := int(float64(size) * logoFraction)
+	if side == 0 {
+		return
+	}
+	offset := (size - side) / 2
+	area := image.Rect(offset, offset, offset+side, offset+side)
+	draw.Draw(img, area, &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+
+	bounds := logo.Bounds()
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			src := logo.At(bounds.Min.X+x*bounds.Dx()/side, bounds.Min.Y+y*bounds.Dy()/side)
+			img.Set(offset+x, offset+y, blend(color.RGBAModel.Convert(src).(color.RGBA)))
+		}
+	}
+}
+
+// blend composites a possibly translucent pixel of the logo over the white square behind it.
+func blend(c color.RGBA) color.RGBA {
+	// Converted colors are premultiplied by their alpha, so white shows through by the alpha that is missing
+	white := 255 - c.A
+	return color.RGBA{R: c.R + white, G: c.G + white, B: c.B + white, A: 255}
+}
@@ -0,0 +1,85 @@
+package qr_test
+
+import (
+	"bytes"
+	"garrettpfoy/orbit-api/internal/services/qr"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinURL(t *testing.T) {
+	joinURL, err := qr.JoinURL("https://orbit.example.com/join", "kabe-tumi")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://orbit.example.com/join/kabe-tumi", joinURL)
+
+	joinURL, err = qr.JoinURL("https://orbit.example.com/", "kabe-tumi")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://orbit.example.com/kabe-tumi", joinURL)
+
+	_, err = qr.JoinURL("orbit.example.com", "kabe-tumi")
+	assert.Error(t, err)
+	_, err = qr.JoinURL("https://orbit.example.com", "")
+	assert.Error(t, err)
+}
+
+func TestPNG(t *testing.T) {
+	data, err := qr.PNG("https://orbit.example.com/join/kabe-tumi", qr.Options{Size: 300, Level: "q"})
+	assert.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 300, 300), img.Bounds())
+	// The quiet zone around the code is white
+	assert.Equal(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, color.RGBAModel.Convert(img.At(0, 0)))
+
+	_, err = qr.PNG("https://orbit.example.com/join/kabe-tumi", qr.Options{Size: qr.MaxSize + 1})
+	assert.Error(t, err)
+	_, err = qr.PNG("https://orbit.example.com/join/kabe-tumi", qr.Options{Level: "X"})
+	assert.Error(t, err)
+}
+
+func TestPNGLogo(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			logo.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+
+	data, err := qr.PNG("https://orbit.example.com/join/kabe-tumi", qr.Options{Logo: logo})
+	assert.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	center := qr.DefaultSize / 2
+	assert.Equal(t, color.RGBA{R: 255, A: 255}, color.RGBAModel.Convert(img.At(center, center)))
+}
+
+func TestSVG(t *testing.T) {
+	data, err := qr.SVG("https://orbit.example.com/join/kabe-tumi", qr.Options{Size: 512})
+	assert.NoError(t, err)
+
+	svg := string(data)
+	assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="512" height="512" viewBox="0 0 `))
+	assert.True(t, strings.HasSuffix(svg, `</svg>`))
+	assert.Contains(t, svg, `<path d="M`)
+	assert.NotContains(t, svg, `<image`)
+
+	logo := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	data, err = qr.SVG("https://orbit.example.com/join/kabe-tumi", qr.Options{Logo: logo})
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `<image x="`)
+	assert.Contains(t, string(data), `href="data:image/png;base64,`)
+}
+
+func TestSVGViewBox(t *testing.T) {
+	// A short content fits a version 1 code of 21 modules, plus a quiet zone of 4 modules on each side
+	data, err := qr.SVG("orbit", qr.Options{Level: "L"})
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `viewBox="0 0 29 29"`)
+}
@@ -0,0 +1,49 @@
+package queueing
+
+import (
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/queue"
+	"garrettpfoy/orbit-api/internal/services/voting"
+)
+
+// This package adds tracks to the queue of a session on behalf of its users. The queue repository applies the rules
+// of the session to a new item, and refuses a track that is already queued. When the session merges duplicates, such
+// a request is turned into an upvote on the queued item instead, cast through the voting service so it is held to the
+// same policy as any other vote. The add and the upvote are separate transactions, so no transaction ever holds the
+// lock on the session while it waits for the lock on the user.
+
+// Service adds tracks to the queues of sessions.
+type Service struct {
+	queue queue.QueueRepository
+	votes *voting.Service
+}
+
+// NewService creates a queueing service that adds items to the given queue repository and casts the upvotes of merged
+// duplicates with the given voting service.
+func NewService(queue queue.QueueRepository, votes *voting.Service) *Service {
+	return &Service{queue: queue, votes: votes}
+}
+
+// Add adds a queue item to its session, and reports whether it was merged into an item that was already queued, in
+// which case queueItem is replaced by that item. The errors of the queue repository and the voting service are
+// returned as they are.
+func (s *Service) Add(queueItem *models.Queue) (bool, error) {
+	err := s.queue.CreateQueueItem(queueItem)
+	var duplicateErr *queue.DuplicateError
+	if !errors.As(err, &duplicateErr) || !duplicateErr.Mergeable {
+		return false, err
+	}
+
+	if _, err := s.votes.Vote(queueItem.UserID, duplicateErr.ExistingID, models.VoteUp); err != nil {
+		return false, err
+	}
+
+	merged, err := s.queue.GetQueueItem(duplicateErr.ExistingID)
+	if err != nil {
+		return false, fmt.Errorf("error loading merged queue item: %w", err)
+	}
+	*queueItem = *merged
+	return true, nil
+}
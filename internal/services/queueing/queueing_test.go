@@ -0,0 +1,112 @@
+package queueing_test
+
+import (
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/queue"
+	"garrettpfoy/orbit-api/internal/services/moderation"
+	"garrettpfoy/orbit-api/internal/services/queueing"
+	"garrettpfoy/orbit-api/internal/services/voting"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection to an in-memory database opens a new, empty database
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.Queue{}, &models.Track{}, &models.Vote{}, &models.VoteEvent{}, &models.ModerationAction{})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// setupSession creates three users and a session hosted by the first that merges duplicates.
+func setupSession(t *testing.T, db *gorm.DB) (*queueing.Service, *queue.GormQueueRepository, *models.Session) {
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, db.Create(&models.User{Model: gorm.Model{ID: uint(i)}, Username: fmt.Sprintf("user%d", i)}).Error)
+	}
+
+	settings := models.DefaultSessionSettings()
+	settings.DuplicatePolicy = models.DuplicatePolicyMerge
+	session := &models.Session{Slug: "party", HostID: 1, Settings: settings}
+	assert.NoError(t, db.Create(session).Error)
+
+	queueRepo := queue.NewGormQueueRepository(db)
+	return queueing.NewService(queueRepo, voting.NewService(db)), queueRepo, session
+}
+
+func TestAddMergesDuplicate(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	service, queueRepo, session := setupSession(t, db)
+
+	original := &models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 1}
+	merged, err := service.Add(original)
+	assert.NoError(t, err)
+	assert.False(t, merged)
+
+	// Another user queueing the same track upvotes the queued item instead
+	duplicate := &models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 2}
+	merged, err = service.Add(duplicate)
+	assert.NoError(t, err)
+	assert.True(t, merged)
+	assert.Equal(t, original.ID, duplicate.ID)
+	assert.Equal(t, uint(1), duplicate.UserID)
+	assert.Equal(t, 1, duplicate.Weight)
+
+	// Neither the user who added it nor a user who already voted can merge into it again
+	var duplicateErr *queue.DuplicateError
+	_, err = service.Add(&models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 1})
+	assert.True(t, errors.As(err, &duplicateErr))
+	assert.Equal(t, original.ID, duplicateErr.ExistingID)
+	_, err = service.Add(&models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 2})
+	assert.True(t, errors.Is(err, queue.ErrDuplicateTrack))
+
+	queueItems, err := queueRepo.GetQueueItemsBySessionID(session.ID, nil)
+	assert.NoError(t, err)
+	assert.Len(t, queueItems, 1)
+	assert.Equal(t, 1, queueItems[0].Weight)
+}
+
+func TestAddMergeVotingFrozen(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	service, queueRepo, session := setupSession(t, db)
+
+	original := &models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 1}
+	_, err = service.Add(original)
+	assert.NoError(t, err)
+
+	// A merge is a vote, so it is refused while the host has voting frozen
+	err = moderation.NewService(db).FreezeVoting(session.HostID, session.ID, true)
+	assert.NoError(t, err)
+
+	_, err = service.Add(&models.Queue{TrackURI: "spotify:track:123", SessionID: session.ID, UserID: 2})
+	assert.True(t, errors.Is(err, voting.ErrVotingFrozen))
+
+	queueItem, err := queueRepo.GetQueueItem(original.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, queueItem.Weight)
+
+	var votes int64
+	assert.NoError(t, db.Model(&models.Vote{}).Count(&votes).Error)
+	assert.Equal(t, int64(0), votes)
+}
@@ -0,0 +1,118 @@
+package redirect
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// This package validates the URLs users are sent back to after logging in, so the login flow
+// cannot be abused to redirect users (and their JWT) to an arbitrary site.
+
+// ErrRedirectNotAllowed is returned when a redirect URL is not covered by the allowlist.
+var ErrRedirectNotAllowed = errors.New("redirect URL is not allowed")
+
+// forbiddenSchemes can never be allowed, as they execute or read content instead of navigating.
+var forbiddenSchemes = map[string]bool{
+	"javascript": true,
+	"data":       true,
+	"vbscript":   true,
+	"file":       true,
+	"blob":       true,
+}
+
+// Allowlist holds the origins and custom schemes users may be redirected to.
+type Allowlist struct {
+	origins map[string]bool
+	schemes map[string]bool
+}
+
+// NewAllowlist parses the given entries, each of which is either a web origin such as
+// "https://orbit.example.com" or "http://localhost:3000", or a custom scheme used by a mobile
+// app such as "orbit://". It returns an error if an entry is neither.
+func NewAllowlist(entries []string) (*Allowlist, error) {
+	allowlist := &Allowlist{
+		origins: make(map[string]bool),
+		schemes: make(map[string]bool),
+	}
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parsed, err := url.Parse(entry)
+		if err != nil || parsed.Scheme == "" {
+			return nil, fmt.Errorf("allowlist entry %q is not a valid origin or scheme", entry)
+		}
+
+		scheme := strings.ToLower(parsed.Scheme)
+		if forbiddenSchemes[scheme] {
+			return nil, fmt.Errorf("allowlist entry %q uses a forbidden scheme", entry)
+		}
+
+		if parsed.User != nil || (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" || parsed.Fragment != "" {
+			return nil, fmt.Errorf("allowlist entry %q must not contain credentials, a path, query or fragment", entry)
+		}
+
+		if scheme == "http" || scheme == "https" {
+			if parsed.Host == "" {
+				return nil, fmt.Errorf("allowlist entry %q does not contain a host", entry)
+			}
+			allowlist.origins[origin(parsed)] = true
+			continue
+		}
+
+		// Any other scheme is a custom app scheme, which is allowed in full
+		if parsed.Host != "" {
+			return nil, fmt.Errorf("allowlist entry %q must be given as a bare scheme, e.g. %s://", entry, scheme)
+		}
+		allowlist.schemes[scheme] = true
+	}
+
+	return allowlist, nil
+}
+
+// Validate returns the normalized form of the given redirect URL if it is allowed, otherwise
+// it returns ErrRedirectNotAllowed.
+func (a *Allowlist) Validate(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme == "" || parsed.User != nil {
+		return "", ErrRedirectNotAllowed
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	if forbiddenSchemes[scheme] {
+		return "", ErrRedirectNotAllowed
+	}
+
+	if scheme == "http" || scheme == "https" {
+		if parsed.Host == "" || !a.origins[origin(parsed)] {
+			return "", ErrRedirectNotAllowed
+		}
+		return parsed.String(), nil
+	}
+
+	if !a.schemes[scheme] {
+		return "", ErrRedirectNotAllowed
+	}
+	return parsed.String(), nil
+}
+
+// origin returns the lower cased scheme://host[:port] of the URL, omitting default ports.
+func origin(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+
+	if (scheme == "https" && port == "443") || (scheme == "http" && port == "80") {
+		port = ""
+	}
+
+	if port != "" {
+		return fmt.Sprintf("%s://%s:%s", scheme, host, port)
+	}
+	return fmt.Sprintf("%s://%s", scheme, host)
+}
@@ -0,0 +1,89 @@
+package redirect_test
+
+import (
+	"garrettpfoy/orbit-api/internal/services/redirect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAllowlist(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []string
+		expectedErr string
+	}{
+		{
+			name:    "Valid Entries",
+			entries: []string{"https://orbit.example.com", "http://localhost:3000", "orbit://", " ", ""},
+		},
+		{
+			name:        "Forbidden Scheme",
+			entries:     []string{"javascript://"},
+			expectedErr: `allowlist entry "javascript://" uses a forbidden scheme`,
+		},
+		{
+			name:        "Entry With Path",
+			entries:     []string{"https://orbit.example.com/callback"},
+			expectedErr: `allowlist entry "https://orbit.example.com/callback" must not contain credentials, a path, query or fragment`,
+		},
+		{
+			name:        "Custom Scheme With Host",
+			entries:     []string{"orbit://callback"},
+			expectedErr: `allowlist entry "orbit://callback" must be given as a bare scheme, e.g. orbit://`,
+		},
+		{
+			name:        "Not A URL",
+			entries:     []string{"orbit.example.com"},
+			expectedErr: `allowlist entry "orbit.example.com" is not a valid origin or scheme`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := redirect.NewAllowlist(tt.entries)
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	allowlist, err := redirect.NewAllowlist([]string{"https://orbit.example.com", "http://localhost:3000", "orbit://"})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		url     string
+		allowed bool
+	}{
+		{name: "Allowed Origin", url: "https://orbit.example.com/sessions?joined=true", allowed: true},
+		{name: "Allowed Origin With Default Port", url: "https://ORBIT.example.com:443/", allowed: true},
+		{name: "Allowed Local Origin", url: "http://localhost:3000/login", allowed: true},
+		{name: "Allowed Custom Scheme", url: "orbit://auth/complete", allowed: true},
+		{name: "Different Scheme", url: "http://orbit.example.com", allowed: false},
+		{name: "Different Port", url: "http://localhost:4000", allowed: false},
+		{name: "Subdomain", url: "https://evil.orbit.example.com", allowed: false},
+		{name: "Suffix Attack", url: "https://orbit.example.com.evil.com", allowed: false},
+		{name: "Credentials", url: "https://user@orbit.example.com", allowed: false},
+		{name: "Protocol Relative", url: "//orbit.example.com", allowed: false},
+		{name: "Relative", url: "/sessions", allowed: false},
+		{name: "Javascript", url: "javascript:alert(1)", allowed: false},
+		{name: "Unknown Custom Scheme", url: "other://auth", allowed: false},
+		{name: "Empty", url: "", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := allowlist.Validate(tt.url)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, redirect.ErrRedirectNotAllowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/services/validation"
+)
+
+// This package applies the changes hosts make to the settings of their session. Changes are JSON merge patches
+// (RFC 7386) of the settings document: a patch only lists the settings it changes, and a setting set to null is reset to
+// its default. The settings document is flat, so a patch never has to merge nested objects.
+
+// ErrInvalidPatch is returned when a patch is not a JSON object, names a setting that does not exist or gives a setting
+// a value of the wrong type.
+var ErrInvalidPatch = errors.New("invalid settings patch")
+
+// Patch applies a JSON merge patch to the settings of a session and validates the result. The version of the
+// settings can not be changed by a patch, a patch may only repeat the current version. The patched settings are
+// written with the current settings version.
+func Patch(current models.SessionSettings, patch []byte) (models.SessionSettings, error) {
+	var changes map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &changes); err != nil || changes == nil {
+		return models.SessionSettings{}, fmt.Errorf("%w: the patch must be a JSON object", ErrInvalidPatch)
+	}
+
+	document, err := toDocument(current)
+	if err != nil {
+		return models.SessionSettings{}, err
+	}
+	defaults, err := toDocument(models.DefaultSessionSettings())
+	if err != nil {
+		return models.SessionSettings{}, err
+	}
+
+	for name, value := range changes {
+		if _, ok := defaults[name]; !ok {
+			return models.SessionSettings{}, fmt.Errorf("%w: unknown setting %q", ErrInvalidPatch, name)
+		}
+		if name == "version" {
+			var version int
+			if err := json.Unmarshal(value, &version); err != nil || version != current.Version {
+				return models.SessionSettings{}, fmt.Errorf("%w: the settings version can not be changed", ErrInvalidPatch)
+			}
+			continue
+		}
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			document[name] = defaults[name]
+			continue
+		}
+		document[name] = value
+	}
+
+	merged, err := json.Marshal(document)
+	if err != nil {
+		return models.SessionSettings{}, err
+	}
+	var patched models.SessionSettings
+	if err := json.Unmarshal(merged, &patched); err != nil {
+		return models.SessionSettings{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	patched.Version = models.SessionSettingsVersion
+
+	if err := validation.ValidateSessionSettings(patched); err != nil {
+		return models.SessionSettings{}, err
+	}
+	return patched, nil
+}
+
+// toDocument turns settings into their JSON document, keyed by the names of the settings.
+func toDocument(settings models.SessionSettings) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
@@ -0,0 +1,62 @@
+package settings_test
+
+import (
+	"errors"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/services/settings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatch(t *testing.T) {
+	current := models.DefaultSessionSettings()
+	current.VoteBudget = 10
+	current.QueueOrder = "fair_share"
+
+	patched, err := settings.Patch(current, []byte(`{"vote_budget": 0, "explicit_filter": true, "queue_order": null}`))
+	assert.NoError(t, err)
+
+	// Zero values are kept, null resets a setting to its default and the other settings are left alone
+	expected := current
+	expected.VoteBudget = 0
+	expected.ExplicitFilter = true
+	expected.QueueOrder = models.DefaultQueueOrder
+	assert.Equal(t, expected, patched)
+}
+
+func TestPatchUpgradesVersion(t *testing.T) {
+	current := models.DefaultSessionSettings()
+	current.Version = 0
+
+	patched, err := settings.Patch(current, []byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, models.SessionSettingsVersion, patched.Version)
+}
+
+func TestPatchInvalid(t *testing.T) {
+	current := models.DefaultSessionSettings()
+
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{name: "Not An Object", patch: `[1, 2]`},
+		{name: "Null Document", patch: `null`},
+		{name: "Malformed", patch: `{"vote_budget":`},
+		{name: "Unknown Setting", patch: `{"volume": 11}`},
+		{name: "Wrong Type", patch: `{"vote_budget": "many"}`},
+		{name: "Changed Version", patch: `{"version": 2}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := settings.Patch(current, []byte(tt.patch))
+			assert.True(t, errors.Is(err, settings.ErrInvalidPatch), err)
+		})
+	}
+
+	// A well formed patch is still validated
+	_, err := settings.Patch(current, []byte(`{"skip_threshold": 2}`))
+	assert.EqualError(t, err, "skip threshold must be between 0 and 1")
+}
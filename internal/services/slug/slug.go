@@ -0,0 +1,209 @@
+package slug
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"io"
+	"strings"
+)
+
+// This package names sessions. Every session gets a slug for its link, either generated or chosen by the host, and a
+// numeric join code for guests who have to type it. Generated slugs alternate consonants and vowels so they can be read
+// out loud, and leave out the characters that are easily mistaken for each other: 0, O, 1 and l.
+
+const (
+	// consonants and vowels are the letters generated slugs are made of, without l and o
+	consonants = "bcdfghjkmnpqrstvwxz"
+	vowels     = "aeiu"
+	// syllables is the number of consonant-vowel pairs in a generated slug, split in two halves by a hyphen
+	syllables = 4
+	digits    = "0123456789"
+)
+
+const (
+	// DefaultAttempts is how many codes are generated before giving up on finding one that is not taken.
+	DefaultAttempts = 10
+	// MinVanityLength is the minimum length of a slug chosen by a host.
+	MinVanityLength = 3
+	// MaxVanityLength is the maximum length of a slug chosen by a host.
+	MaxVanityLength = 32
+)
+
+// ErrSlugTaken is returned when a host chooses a slug another session already uses.
+var ErrSlugTaken = errors.New("slug is already taken")
+
+// ErrInvalidSlug is returned when a host chooses a slug that can not be used in a link.
+var ErrInvalidSlug = errors.New("slug is invalid")
+
+// ErrExhausted is returned when every generated code was taken, which means the code space is running out.
+var ErrExhausted = errors.New("could not generate a code that is not taken")
+
+// reserved are slugs that would be confused with the routes of the app
+var reserved = map[string]bool{
+	"admin":    true,
+	"api":      true,
+	"auth":     true,
+	"host":     true,
+	"join":     true,
+	"new":      true,
+	"session":  true,
+	"sessions": true,
+}
+
+// SessionLookup checks whether a slug or join code is in use, to check generated codes against the ones in use. A code
+// is in use if any session has it, including ended and deleted sessions, since the unique constraints cover them too.
+type SessionLookup interface {
+	// SlugTaken reports whether any session, including ended and deleted ones, has the slug
+	SlugTaken(slug string) (bool, error)
+	// JoinCodeTaken reports whether any session, including ended and deleted ones, has the join code
+	JoinCodeTaken(joinCode string) (bool, error)
+}
+
+// Service generates slugs and join codes that are not in use by any session.
+type Service struct {
+	sessions SessionLookup
+	random   io.Reader
+	attempts int
+}
+
+// NewService creates a slug service that checks codes against the given sessions.
+func NewService(sessions SessionLookup) *Service {
+	return &Service{sessions: sessions, random: rand.Reader, attempts: DefaultAttempts}
+}
+
+// WithRandom makes the service generate codes from the given source of randomness instead of crypto/rand
+func (s *Service) WithRandom(random io.Reader) *Service {
+	s.random = random
+	return s
+}
+
+// Slug generates a slug that no session uses, e.g. "kabe-tumi".
+func (s *Service) Slug() (string, error) {
+	return s.generate(s.randomSlug, s.sessions.SlugTaken)
+}
+
+// VanitySlug checks that a slug a host chose can be used and is not taken, returning it normalized.
+func (s *Service) VanitySlug(requested string) (string, error) {
+	slug, err := NormalizeVanity(requested)
+	if err != nil {
+		return "", err
+	}
+
+	taken, err := s.sessions.SlugTaken(slug)
+	if err != nil {
+		return "", fmt.Errorf("error looking up session: %w", err)
+	}
+	if taken {
+		return "", ErrSlugTaken
+	}
+	return slug, nil
+}
+
+// JoinCode generates a join code that no session uses, made of models.JoinCodeLength digits.
+func (s *Service) JoinCode() (string, error) {
+	return s.generate(func() (string, error) {
+		return s.randomString(digits, models.JoinCodeLength)
+	}, s.sessions.JoinCodeTaken)
+}
+
+// Assign gives a new session its slug, the vanity slug if one is given or a generated one otherwise, and its join code.
+func (s *Service) Assign(session *models.Session, vanity string) error {
+	var err error
+	if vanity != "" {
+		session.Slug, err = s.VanitySlug(vanity)
+	} else {
+		session.Slug, err = s.Slug()
+	}
+	if err != nil {
+		return err
+	}
+
+	joinCode, err := s.JoinCode()
+	if err != nil {
+		return err
+	}
+	session.JoinCode = &joinCode
+	return nil
+}
+
+// NormalizeVanity lower cases a slug chosen by a host and turns spaces and underscores into hyphens, then checks it is
+// made of letters, digits and single hyphens, does not start or end with a hyphen and is not reserved.
+func NormalizeVanity(requested string) (string, error) {
+	slug := strings.ToLower(strings.TrimSpace(requested))
+	slug = strings.NewReplacer(" ", "-", "_", "-").Replace(slug)
+
+	if len(slug) < MinVanityLength || len(slug) > MaxVanityLength {
+		return "", fmt.Errorf("%w: it must be between %d and %d characters", ErrInvalidSlug, MinVanityLength, MaxVanityLength)
+	}
+	for _, c := range slug {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return "", fmt.Errorf("%w: it can only contain letters, digits and hyphens", ErrInvalidSlug)
+		}
+	}
+	if strings.HasPrefix(slug, "-") || strings.HasSuffix(slug, "-") || strings.Contains(slug, "--") {
+		return "", fmt.Errorf("%w: hyphens can only separate words", ErrInvalidSlug)
+	}
+	if reserved[slug] {
+		return "", fmt.Errorf("%w: %q is reserved", ErrInvalidSlug, slug)
+	}
+	return slug, nil
+}
+
+// generate draws codes until one is not used by any session, giving up after the service's number of attempts.
+func (s *Service) generate(draw func() (string, error), taken func(code string) (bool, error)) (string, error) {
+	for attempt := 0; attempt < s.attempts; attempt++ {
+		code, err := draw()
+		if err != nil {
+			return "", fmt.Errorf("error generating code: %w", err)
+		}
+
+		inUse, err := taken(code)
+		if err != nil {
+			return "", fmt.Errorf("error looking up session: %w", err)
+		}
+		if !inUse {
+			return code, nil
+		}
+	}
+	return "", ErrExhausted
+}
+
+// randomSlug draws a slug of alternating consonants and vowels, split in the middle by a hyphen.
+func (s *Service) randomSlug() (string, error) {
+	var slug strings.Builder
+	for i := 0; i < syllables; i++ {
+		if i == syllables/2 {
+			slug.WriteByte('-')
+		}
+		consonant, err := s.randomString(consonants, 1)
+		if err != nil {
+			return "", err
+		}
+		vowel, err := s.randomString(vowels, 1)
+		if err != nil {
+			return "", err
+		}
+		slug.WriteString(consonant + vowel)
+	}
+	return slug.String(), nil
+}
+
+// randomString draws n characters uniformly from the alphabet. Bytes past the largest multiple of the alphabet's length
+// are drawn again, since mapping them with a modulo would favor the first characters of the alphabet.
+func (s *Service) randomString(alphabet string, n int) (string, error) {
+	limit := 256 - 256%len(alphabet)
+	result := make([]byte, 0, n)
+	buf := make([]byte, 1)
+	for len(result) < n {
+		if _, err := io.ReadFull(s.random, buf); err != nil {
+			return "", err
+		}
+		if int(buf[0]) >= limit {
+			continue
+		}
+		result = append(result, alphabet[int(buf[0])%len(alphabet)])
+	}
+	return string(result), nil
+}
@@ -0,0 +1,196 @@
+package slug_test
+
+import (
+	"bytes"
+	"errors"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/session"
+	"garrettpfoy/orbit-api/internal/services/slug"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AutoMigrate(&models.Session{}, &models.User{}, &models.AccessToken{})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// repeat returns n bytes of the given value, which the service turns into the same character every time.
+func repeat(value byte, n int) []byte {
+	return bytes.Repeat([]byte{value}, n)
+}
+
+func TestSlug(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	service := slug.NewService(session.NewGormSessionRepository(db))
+	for i := 0; i < 100; i++ {
+		generated, err := service.Slug()
+		assert.NoError(t, err)
+		assert.Len(t, generated, 9)
+		assert.Equal(t, "-", generated[4:5])
+		assert.False(t, strings.ContainsAny(generated, "0O1lo"), generated)
+	}
+}
+
+func TestSlugCollision(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	sessions := session.NewGormSessionRepository(db)
+	assert.NoError(t, sessions.CreateSession(&models.Session{Slug: "baba-baba", HostID: 1}))
+
+	// The first draw is taken, so the service draws again
+	random := bytes.NewReader(append(repeat(0, 8), repeat(1, 8)...))
+	generated, err := slug.NewService(sessions).WithRandom(random).Slug()
+	assert.NoError(t, err)
+	assert.Equal(t, "cece-cece", generated)
+
+	// Bytes that would bias the draw are skipped
+	random = bytes.NewReader(append([]byte{255}, repeat(1, 8)...))
+	generated, err = slug.NewService(sessions).WithRandom(random).Slug()
+	assert.NoError(t, err)
+	assert.Equal(t, "cece-cece", generated)
+
+	// The service gives up when every draw is taken
+	random = bytes.NewReader(repeat(0, 8*slug.DefaultAttempts))
+	_, err = slug.NewService(sessions).WithRandom(random).Slug()
+	assert.True(t, errors.Is(err, slug.ErrExhausted))
+}
+
+func TestVanitySlug(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	sessions := session.NewGormSessionRepository(db)
+	assert.NoError(t, sessions.CreateSession(&models.Session{Slug: "friday-night", HostID: 1}))
+	service := slug.NewService(sessions)
+
+	vanity, err := service.VanitySlug("  Garrett's Party ")
+	assert.True(t, errors.Is(err, slug.ErrInvalidSlug))
+	assert.Empty(t, vanity)
+
+	vanity, err = service.VanitySlug("Garretts Party_2024")
+	assert.NoError(t, err)
+	assert.Equal(t, "garretts-party-2024", vanity)
+
+	_, err = service.VanitySlug("Friday Night")
+	assert.True(t, errors.Is(err, slug.ErrSlugTaken))
+
+	// The slug of an ended session stays taken
+	ended := &models.Session{Slug: "last-orders", HostID: 2}
+	assert.NoError(t, sessions.CreateSession(ended))
+	_, err = sessions.TransitionSession(ended.ID, models.SessionStatusEnded, time.Now())
+	assert.NoError(t, err)
+	_, err = service.VanitySlug("last-orders")
+	assert.True(t, errors.Is(err, slug.ErrSlugTaken))
+}
+
+func TestDeletedSessionCodesStayTaken(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	// The unique constraints still cover deleted sessions, so their codes can not be handed out again
+	sessions := session.NewGormSessionRepository(db)
+	joinCode := "000000"
+	deleted := &models.Session{Slug: "baba-baba", JoinCode: &joinCode, HostID: 1}
+	assert.NoError(t, sessions.CreateSession(deleted))
+	assert.NoError(t, sessions.DeleteSession(deleted.ID))
+
+	_, err = slug.NewService(sessions).VanitySlug("baba-baba")
+	assert.True(t, errors.Is(err, slug.ErrSlugTaken))
+
+	random := bytes.NewReader(append(repeat(0, 8), repeat(1, 8)...))
+	generated, err := slug.NewService(sessions).WithRandom(random).Slug()
+	assert.NoError(t, err)
+	assert.Equal(t, "cece-cece", generated)
+
+	random = bytes.NewReader(append(repeat(0, 6), []byte{1, 2, 3, 4, 5, 6}...))
+	code, err := slug.NewService(sessions).WithRandom(random).JoinCode()
+	assert.NoError(t, err)
+	assert.Equal(t, "123456", code)
+}
+
+func TestNormalizeVanity(t *testing.T) {
+	tests := []struct {
+		requested string
+		expected  string
+		valid     bool
+	}{
+		{requested: "rooftop", expected: "rooftop", valid: true},
+		{requested: "Rooftop Bar", expected: "rooftop-bar", valid: true},
+		{requested: "ab", valid: false},
+		{requested: strings.Repeat("a", slug.MaxVanityLength+1), valid: false},
+		{requested: "-rooftop", valid: false},
+		{requested: "roof--top", valid: false},
+		{requested: "rooftop!", valid: false},
+		{requested: "API", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.requested, func(t *testing.T) {
+			normalized, err := slug.NormalizeVanity(tt.requested)
+			if tt.valid {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, normalized)
+			} else {
+				assert.True(t, errors.Is(err, slug.ErrInvalidSlug))
+			}
+		})
+	}
+}
+
+func TestJoinCode(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	sessions := session.NewGormSessionRepository(db)
+	taken := "000000"
+	assert.NoError(t, sessions.CreateSession(&models.Session{Slug: "taken", JoinCode: &taken, HostID: 1}))
+
+	random := bytes.NewReader(append(repeat(0, 6), []byte{1, 2, 3, 4, 5, 6}...))
+	code, err := slug.NewService(sessions).WithRandom(random).JoinCode()
+	assert.NoError(t, err)
+	assert.Equal(t, "123456", code)
+
+	code, err = slug.NewService(sessions).JoinCode()
+	assert.NoError(t, err)
+	assert.Len(t, code, models.JoinCodeLength)
+	assert.Equal(t, "", strings.Trim(code, "0123456789"))
+}
+
+func TestAssign(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	sessions := session.NewGormSessionRepository(db)
+	service := slug.NewService(sessions)
+
+	generated := &models.Session{HostID: 1}
+	assert.NoError(t, service.Assign(generated, ""))
+	assert.NotEmpty(t, generated.Slug)
+	assert.NotNil(t, generated.JoinCode)
+	assert.NoError(t, sessions.CreateSession(generated))
+
+	vanity := &models.Session{HostID: 2}
+	assert.NoError(t, service.Assign(vanity, "Rooftop"))
+	assert.Equal(t, "rooftop", vanity.Slug)
+	assert.NoError(t, sessions.CreateSession(vanity))
+
+	assert.True(t, errors.Is(service.Assign(&models.Session{HostID: 3}, "rooftop"), slug.ErrSlugTaken))
+}
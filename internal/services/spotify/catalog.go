@@ -0,0 +1,21 @@
+package spotify
+
+import (
+	"context"
+
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// TokenURL is the Spotify endpoint tokens are requested from.
+const TokenURL = "https://accounts.spotify.com/api/token"
+
+// NewCatalogClient creates a client authorized as Orbit itself rather than a user, using the client credentials
+// flow. It can look up and search the catalog, but cannot read or control anyone's playback.
+func NewCatalogClient(ctx context.Context, clientID, clientSecret string) *Client {
+	config := &clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     TokenURL,
+	}
+	return NewClient(config.Client(ctx), "")
+}
@@ -0,0 +1,253 @@
+package spotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultBaseURL is the base URL of the Spotify Web API.
+const DefaultBaseURL = "https://api.spotify.com/v1"
+
+// trackURIPrefix is the prefix of every Spotify track URI.
+const trackURIPrefix = "spotify:track:"
+
+// Client is a client for the parts of the Spotify Web API that Orbit uses. It does not manage tokens itself,
+// the HTTP client it is given is expected to authorize its requests, e.g. one from the token manager.
+// Requests are sent through a RetryTransport, so rate limits and transient failures are retried.
+type Client struct {
+	http    *http.Client
+	baseURL string
+}
+
+// NewClient creates a Spotify client that sends its requests with the given HTTP client.
+// If baseURL is empty the client talks to the real Spotify Web API. Unless the HTTP client already uses a
+// RetryTransport, its transport is wrapped in one with the default policy that reports to DefaultStats.
+func NewClient(httpClient *http.Client, baseURL string) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if _, ok := httpClient.Transport.(*RetryTransport); !ok {
+		wrapped := *httpClient
+		wrapped.Transport = NewRetryTransport(httpClient.Transport, DefaultRetryPolicy, DefaultStats)
+		httpClient = &wrapped
+	}
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	return &Client{
+		http:    httpClient,
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// TrackIDFromURI returns the ID of the track the given Spotify track URI refers to.
+func TrackIDFromURI(uri string) (string, error) {
+	id, ok := strings.CutPrefix(uri, trackURIPrefix)
+	if !ok || id == "" || strings.Contains(id, ":") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidURI, uri)
+	}
+	return id, nil
+}
+
+// TrackURI returns the Spotify URI of the track with the given ID.
+func TrackURI(id string) string {
+	return trackURIPrefix + id
+}
+
+// CurrentUser returns the profile of the user the client is authorized as.
+func (c *Client) CurrentUser(ctx context.Context) (*User, error) {
+	var user User
+	if _, err := c.do(ctx, http.MethodGet, "/me", nil, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Track returns the track with the given Spotify URI.
+func (c *Client) Track(ctx context.Context, uri string) (*Track, error) {
+	id, err := TrackIDFromURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	var track Track
+	if _, err := c.do(ctx, http.MethodGet, "/tracks/"+url.PathEscape(id), nil, nil, &track); err != nil {
+		return nil, err
+	}
+	return &track, nil
+}
+
+// Search returns at most limit tracks matching the given query. A limit of zero uses Spotify's default.
+func (c *Client) Search(ctx context.Context, query string, limit int) ([]Track, error) {
+	params := url.Values{"q": {query}, "type": {"track"}}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	var result struct {
+		Tracks struct {
+			Items []Track `json:"items"`
+		} `json:"tracks"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/search", params, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Tracks.Items, nil
+}
+
+// PlaybackState returns the state of the user's player, or nil if nothing is playing on any device.
+func (c *Client) PlaybackState(ctx context.Context) (*PlaybackState, error) {
+	var state PlaybackState
+	status, err := c.do(ctx, http.MethodGet, "/me/player", nil, nil, &state)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNoContent {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+// Devices returns the devices the user can play music on.
+func (c *Client) Devices(ctx context.Context) ([]Device, error) {
+	var result struct {
+		Devices []Device `json:"devices"`
+	}
+	if _, err := c.do(ctx, http.MethodGet, "/me/player/devices", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Devices, nil
+}
+
+// AddToQueue adds the track with the given URI to the end of the user's playback queue.
+// If deviceID is empty the active device is used.
+func (c *Client) AddToQueue(ctx context.Context, uri, deviceID string) error {
+	if _, err := TrackIDFromURI(uri); err != nil {
+		return err
+	}
+
+	params := deviceParams(deviceID)
+	params.Set("uri", uri)
+	_, err := c.do(ctx, http.MethodPost, "/me/player/queue", params, nil, nil)
+	return err
+}
+
+// Play starts playing the tracks with the given URIs, or resumes playback if none are given.
+// If deviceID is empty the active device is used.
+func (c *Client) Play(ctx context.Context, deviceID string, uris ...string) error {
+	var body any
+	if len(uris) > 0 {
+		for _, uri := range uris {
+			if _, err := TrackIDFromURI(uri); err != nil {
+				return err
+			}
+		}
+		body = map[string][]string{"uris": uris}
+	}
+
+	_, err := c.do(ctx, http.MethodPut, "/me/player/play", deviceParams(deviceID), body, nil)
+	return err
+}
+
+// Pause pauses playback. If deviceID is empty the active device is used.
+func (c *Client) Pause(ctx context.Context, deviceID string) error {
+	_, err := c.do(ctx, http.MethodPut, "/me/player/pause", deviceParams(deviceID), nil, nil)
+	return err
+}
+
+// Next skips to the next track in the user's queue. If deviceID is empty the active device is used.
+func (c *Client) Next(ctx context.Context, deviceID string) error {
+	_, err := c.do(ctx, http.MethodPost, "/me/player/next", deviceParams(deviceID), nil, nil)
+	return err
+}
+
+// deviceParams returns the query parameters that target the given device, if any.
+func deviceParams(deviceID string) url.Values {
+	params := url.Values{}
+	if deviceID != "" {
+		params.Set("device_id", deviceID)
+	}
+	return params
+}
+
+// do sends a request to the given path of the API and decodes the response into out, if it is not nil.
+// It returns the status code of the response, and an *Error if the response was not successful.
+func (c *Client) do(ctx context.Context, method, path string, params url.Values, body, out any) (int, error) {
+	endpoint := c.baseURL + path
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode spotify request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("spotify %s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter, _ := RetryAfter(resp)
+		return resp.StatusCode, &RateLimitedError{RetryAfter: retryAfter, Err: decodeError(resp, method+" "+path)}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, decodeError(resp, method+" "+path)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return resp.StatusCode, nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to decode spotify %s %s response: %w", method, path, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// decodeError builds an *Error from an unsuccessful response. Spotify usually describes the error in the body,
+// but the status text is used when it does not.
+func decodeError(resp *http.Response, endpoint string) *Error {
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+			Reason  string `json:"reason"`
+		} `json:"error"`
+	}
+	// Not every error response has a JSON body, the status code is enough to go on
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+
+	message := body.Error.Message
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+
+	return &Error{
+		StatusCode: resp.StatusCode,
+		Message:    message,
+		Reason:     body.Error.Reason,
+		Endpoint:   endpoint,
+	}
+}
@@ -0,0 +1,177 @@
+package spotify_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"garrettpfoy/orbit-api/internal/services/spotify"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupFakeServer(t *testing.T) (*spotify.FakeServer, *spotify.Client) {
+	fake := spotify.NewFakeServer()
+	t.Cleanup(fake.Close)
+
+	fake.AddTrack(spotify.Track{ID: "track1", Name: "Harvest Moon", DurationMs: 300000, Artists: []spotify.Artist{{Name: "Neil Young"}}})
+	fake.AddTrack(spotify.Track{ID: "track2", Name: "Heart of Gold", DurationMs: 180000, Artists: []spotify.Artist{{Name: "Neil Young"}}})
+	fake.AddTrack(spotify.Track{ID: "track3", Name: "Moondance", DurationMs: 270000, Artists: []spotify.Artist{{Name: "Van Morrison"}}})
+
+	return fake, fake.Client()
+}
+
+func TestTrackIDFromURI(t *testing.T) {
+	id, err := spotify.TrackIDFromURI("spotify:track:abc123")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", id)
+
+	for _, uri := range []string{"", "abc123", "spotify:track:", "spotify:album:abc123", "spotify:track:abc:123"} {
+		_, err := spotify.TrackIDFromURI(uri)
+		assert.ErrorIs(t, err, spotify.ErrInvalidURI, uri)
+	}
+}
+
+func TestCurrentUser(t *testing.T) {
+	fake, client := setupFakeServer(t)
+	fake.SetUser(spotify.User{ID: "host", DisplayName: "Host", Email: "host@example.com"})
+
+	user, err := client.CurrentUser(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "host", user.ID)
+	assert.Equal(t, "Host", user.DisplayName)
+	assert.Equal(t, "host@example.com", user.Email)
+}
+
+func TestUnauthorized(t *testing.T) {
+	fake, _ := setupFakeServer(t)
+	client := spotify.NewClient(http.DefaultClient, fake.URL)
+
+	_, err := client.CurrentUser(context.Background())
+	assert.ErrorIs(t, err, spotify.ErrUnauthorized)
+
+	var apiErr *spotify.Error
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Equal(t, "GET /me", apiErr.Endpoint)
+}
+
+func TestTrack(t *testing.T) {
+	_, client := setupFakeServer(t)
+
+	track, err := client.Track(context.Background(), "spotify:track:track1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Harvest Moon", track.Name)
+	assert.Equal(t, "spotify:track:track1", track.URI)
+	assert.Equal(t, 300000, track.DurationMs)
+
+	_, err = client.Track(context.Background(), "spotify:track:missing")
+	assert.ErrorIs(t, err, spotify.ErrNotFound)
+
+	_, err = client.Track(context.Background(), "not-a-uri")
+	assert.ErrorIs(t, err, spotify.ErrInvalidURI)
+}
+
+func TestSearch(t *testing.T) {
+	_, client := setupFakeServer(t)
+
+	tracks, err := client.Search(context.Background(), "moon", 0)
+	assert.NoError(t, err)
+	assert.Len(t, tracks, 2)
+	assert.Equal(t, "Harvest Moon", tracks[0].Name)
+	assert.Equal(t, "Moondance", tracks[1].Name)
+
+	tracks, err = client.Search(context.Background(), "neil young", 1)
+	assert.NoError(t, err)
+	assert.Len(t, tracks, 1)
+
+	tracks, err = client.Search(context.Background(), "nothing matches", 5)
+	assert.NoError(t, err)
+	assert.Empty(t, tracks)
+}
+
+func TestPlaybackWithoutDevice(t *testing.T) {
+	_, client := setupFakeServer(t)
+	ctx := context.Background()
+
+	state, err := client.PlaybackState(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+
+	err = client.AddToQueue(ctx, "spotify:track:track1", "")
+	assert.ErrorIs(t, err, spotify.ErrNoActiveDevice)
+	assert.NotErrorIs(t, err, spotify.ErrNotFound)
+
+	err = client.Play(ctx, "", "spotify:track:track1")
+	assert.ErrorIs(t, err, spotify.ErrNoActiveDevice)
+}
+
+func TestPlayback(t *testing.T) {
+	fake, client := setupFakeServer(t)
+	ctx := context.Background()
+	fake.AddDevice(spotify.Device{ID: "speaker", Name: "Living Room", Type: "Speaker"})
+
+	devices, err := client.Devices(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, devices, 1)
+	assert.False(t, devices[0].IsActive)
+
+	// Playing on a device activates it
+	assert.NoError(t, client.Play(ctx, "speaker", "spotify:track:track1"))
+	devices, err = client.Devices(ctx)
+	assert.NoError(t, err)
+	assert.True(t, devices[0].IsActive)
+
+	assert.NoError(t, client.AddToQueue(ctx, "spotify:track:track2", ""))
+	assert.Equal(t, []string{"spotify:track:track2"}, fake.Queue())
+
+	state, err := client.PlaybackState(ctx)
+	assert.NoError(t, err)
+	assert.True(t, state.IsPlaying)
+	assert.Equal(t, "speaker", state.Device.ID)
+	assert.Equal(t, "spotify:track:track1", state.Item.URI)
+
+	assert.NoError(t, client.Pause(ctx, ""))
+	state, err = client.PlaybackState(ctx)
+	assert.NoError(t, err)
+	assert.False(t, state.IsPlaying)
+
+	// Resuming keeps the current track
+	assert.NoError(t, client.Play(ctx, ""))
+	state, err = client.PlaybackState(ctx)
+	assert.NoError(t, err)
+	assert.True(t, state.IsPlaying)
+	assert.Equal(t, "spotify:track:track1", state.Item.URI)
+
+	assert.NoError(t, client.Next(ctx, ""))
+	state, err = client.PlaybackState(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "spotify:track:track2", state.Item.URI)
+	assert.Empty(t, fake.Queue())
+
+	assert.Contains(t, fake.Requests(), "POST /me/player/next")
+}
+
+func TestFakeServerAdvance(t *testing.T) {
+	fake, client := setupFakeServer(t)
+	ctx := context.Background()
+	fake.AddDevice(spotify.Device{ID: "speaker", IsActive: true})
+
+	assert.NoError(t, client.Play(ctx, "", "spotify:track:track2"))
+	assert.NoError(t, client.AddToQueue(ctx, "spotify:track:track3", ""))
+
+	fake.Advance(time.Minute)
+	assert.Equal(t, "spotify:track:track2", fake.Playback().Item.URI)
+	assert.Equal(t, 60000, fake.Playback().ProgressMs)
+
+	// Running past the end of the track moves on to the queued one
+	fake.Advance(3 * time.Minute)
+	assert.Equal(t, "spotify:track:track3", fake.Playback().Item.URI)
+	assert.Equal(t, 60000, fake.Playback().ProgressMs)
+
+	fake.Advance(10 * time.Minute)
+	assert.Nil(t, fake.Playback().Item)
+	assert.False(t, fake.Playback().IsPlaying)
+}
@@ -0,0 +1,79 @@
+package spotify
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrInvalidURI is returned when a URI is not a Spotify track URI.
+	ErrInvalidURI = errors.New("invalid spotify track URI")
+	// ErrUnauthorized is returned when Spotify rejects the token of the request.
+	ErrUnauthorized = errors.New("spotify rejected the access token")
+	// ErrNotFound is returned when the requested resource does not exist.
+	ErrNotFound = errors.New("spotify resource not found")
+	// ErrNoActiveDevice is returned when a playback command is sent while the user has no active device.
+	ErrNoActiveDevice = errors.New("no active spotify device")
+	// ErrPremiumRequired is returned when a playback command is sent for a user without Spotify Premium.
+	ErrPremiumRequired = errors.New("spotify premium is required")
+	// ErrRateLimited is returned when Spotify keeps rate limiting a request after it has been retried.
+	ErrRateLimited = errors.New("spotify rate limit exceeded")
+)
+
+// Error is an error response from the Spotify Web API.
+type Error struct {
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+	// Message is the message Spotify gave for the error
+	Message string
+	// Reason is the machine readable reason Spotify gave for player errors, e.g. NO_ACTIVE_DEVICE
+	Reason string
+	// Endpoint is the method and path of the request that failed
+	Endpoint string
+}
+
+func (e *Error) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("spotify %s failed with status %d (%s): %s", e.Endpoint, e.StatusCode, e.Reason, e.Message)
+	}
+	return fmt.Sprintf("spotify %s failed with status %d: %s", e.Endpoint, e.StatusCode, e.Message)
+}
+
+// Is allows the error to be matched against the sentinel errors of the package with errors.Is.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound && e.Reason != "NO_ACTIVE_DEVICE"
+	case ErrNoActiveDevice:
+		return e.Reason == "NO_ACTIVE_DEVICE"
+	case ErrPremiumRequired:
+		return e.Reason == "PREMIUM_REQUIRED"
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// RateLimitedError is returned when Spotify rate limited a request and it could not be retried, either
+// because the retries ran out or Spotify asked the client to wait longer than it is willing to.
+type RateLimitedError struct {
+	// RetryAfter is how long Spotify asked the client to wait, zero if it did not say
+	RetryAfter time.Duration
+	// Err is the error response Spotify sent
+	Err *Error
+}
+
+func (e *RateLimitedError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("spotify %s was rate limited, retry after %s", e.Err.Endpoint, e.RetryAfter)
+	}
+	return fmt.Sprintf("spotify %s was rate limited", e.Err.Endpoint)
+}
+
+func (e *RateLimitedError) Unwrap() error {
+	return e.Err
+}
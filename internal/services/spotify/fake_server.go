@@ -0,0 +1,489 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/oauth2"
+)
+
+// FakeAccessToken is the access token the fake server accepts.
+const FakeAccessToken = "fake-spotify-token"
+
+// FakeRetryPolicy is the retry policy of clients created by FakeServer.Client. It retries as often as the
+// default policy but barely waits between attempts, so tests stay fast.
+var FakeRetryPolicy = RetryPolicy{
+	MaxRetries:    DefaultRetryPolicy.MaxRetries,
+	BaseDelay:     time.Millisecond,
+	MaxDelay:      5 * time.Millisecond,
+	MaxRetryAfter: DefaultRetryPolicy.MaxRetryAfter,
+}
+
+// FakeServer is an in-process stand-in for the Spotify Web API, so features built on the client can be tested offline.
+// It keeps a catalog of tracks, a set of devices and a single player, and implements the endpoints the client uses.
+type FakeServer struct {
+	*httptest.Server
+
+	// Stats collects the call counters of the clients created by Client
+	Stats *Stats
+
+	mu       sync.Mutex
+	user     User
+	tracks   map[string]Track
+	order    []string
+	devices  []Device
+	playback *PlaybackState
+	queue    []string
+	requests []string
+	faults   []fakeFault
+}
+
+// fakeFault is an error response the fake server sends instead of serving a request.
+type fakeFault struct {
+	status     int
+	retryAfter string
+}
+
+// NewFakeServer starts a fake Spotify server. It must be closed once the test is done with it.
+func NewFakeServer() *FakeServer {
+	fake := &FakeServer{
+		user:   User{ID: "fake-user", DisplayName: "Fake User", Email: "fake@example.com", Product: "premium", URI: "spotify:user:fake-user"},
+		tracks: make(map[string]Track),
+		Stats:  NewStats(),
+	}
+
+	router := chi.NewRouter()
+	router.Use(fake.record)
+	router.Post("/api/token", fake.handleToken)
+	router.Group(func(router chi.Router) {
+		router.Use(fake.fail, fake.authorize)
+		router.Get("/me", fake.handleMe)
+		router.Get("/tracks/{id}", fake.handleTrack)
+		router.Get("/search", fake.handleSearch)
+		router.Get("/me/player", fake.handlePlayback)
+		router.Get("/me/player/devices", fake.handleDevices)
+		router.Post("/me/player/queue", fake.handleQueue)
+		router.Put("/me/player/play", fake.handlePlay)
+		router.Put("/me/player/pause", fake.handlePause)
+		router.Post("/me/player/next", fake.handleNext)
+	})
+
+	fake.Server = httptest.NewServer(router)
+	return fake
+}
+
+// Client returns a Spotify client that talks to the fake server with a valid token, retrying with
+// FakeRetryPolicy and reporting to the server's Stats.
+func (f *FakeServer) Client() *Client {
+	httpClient := oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: FakeAccessToken}))
+	httpClient.Transport = NewRetryTransport(httpClient.Transport, FakeRetryPolicy, f.Stats)
+	return NewClient(httpClient, f.URL)
+}
+
+// FailNext makes the server answer the next count requests with the given status instead of serving them.
+// If retryAfter is not negative it is sent as the Retry-After header, in whole seconds.
+func (f *FakeServer) FailNext(count, status int, retryAfter time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fault := fakeFault{status: status}
+	if retryAfter >= 0 {
+		fault.retryAfter = strconv.Itoa(int(retryAfter / time.Second))
+	}
+	for i := 0; i < count; i++ {
+		f.faults = append(f.faults, fault)
+	}
+}
+
+// TokenURL returns the URL of the fake token endpoint, which exchanges any refresh token for FakeAccessToken.
+func (f *FakeServer) TokenURL() string {
+	return f.URL + "/api/token"
+}
+
+// SetUser sets the profile returned for the current user.
+func (f *FakeServer) SetUser(user User) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.user = user
+}
+
+// AddTrack adds a track to the catalog. Its URI is derived from its ID if it is not set.
+func (f *FakeServer) AddTrack(track Track) Track {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if track.URI == "" {
+		track.URI = TrackURI(track.ID)
+	}
+	if _, ok := f.tracks[track.ID]; !ok {
+		f.order = append(f.order, track.ID)
+	}
+	f.tracks[track.ID] = track
+	return track
+}
+
+// AddDevice adds a device the user can play music on.
+func (f *FakeServer) AddDevice(device Device) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.devices = append(f.devices, device)
+}
+
+// SetPlayback replaces the state of the player. A nil state means nothing is playing.
+func (f *FakeServer) SetPlayback(state *PlaybackState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.playback = state
+}
+
+// Playback returns a copy of the state of the player, or nil if nothing is playing.
+func (f *FakeServer) Playback() *PlaybackState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.playback == nil {
+		return nil
+	}
+	state := *f.playback
+	return &state
+}
+
+// Queue returns the URIs of the tracks waiting in the player's queue.
+func (f *FakeServer) Queue() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.queue...)
+}
+
+// Requests returns the method and path of every request the server has received, in order.
+func (f *FakeServer) Requests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+// Advance moves playback forward by the given duration. When the current track ends the next one
+// in the queue starts playing, and playback stops when the queue is empty.
+func (f *FakeServer) Advance(duration time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.playback == nil || !f.playback.IsPlaying || f.playback.Item == nil {
+		return
+	}
+
+	f.playback.ProgressMs += int(duration.Milliseconds())
+	for f.playback.Item != nil && f.playback.ProgressMs >= f.playback.Item.DurationMs {
+		overflow := f.playback.ProgressMs - f.playback.Item.DurationMs
+		f.skip()
+		if f.playback.Item == nil {
+			return
+		}
+		f.playback.ProgressMs = overflow
+	}
+}
+
+// skip starts the next track in the queue, or stops playback if there is none. The lock must be held.
+func (f *FakeServer) skip() {
+	if len(f.queue) == 0 {
+		f.playback.Item = nil
+		f.playback.IsPlaying = false
+		f.playback.ProgressMs = 0
+		return
+	}
+
+	track := f.tracks[strings.TrimPrefix(f.queue[0], trackURIPrefix)]
+	f.queue = f.queue[1:]
+	f.playback.Item = &track
+	f.playback.ProgressMs = 0
+	f.playback.IsPlaying = true
+	f.playback.Timestamp = time.Now().UnixMilli()
+}
+
+// activeDevice returns the device a playback command targets: the requested device, or the active one.
+// The lock must be held.
+func (f *FakeServer) activeDevice(r *http.Request) (Device, bool) {
+	deviceID := r.URL.Query().Get("device_id")
+	for _, device := range f.devices {
+		if (deviceID != "" && device.ID == deviceID) || (deviceID == "" && device.IsActive) {
+			return device, true
+		}
+	}
+	return Device{}, false
+}
+
+// activate marks the given device as the only active one and makes sure the player exists. The lock must be held.
+func (f *FakeServer) activate(device Device) {
+	for i := range f.devices {
+		f.devices[i].IsActive = f.devices[i].ID == device.ID
+	}
+	device.IsActive = true
+
+	if f.playback == nil {
+		f.playback = &PlaybackState{RepeatState: "off"}
+	}
+	f.playback.Device = device
+}
+
+func (f *FakeServer) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+		f.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *FakeServer) fail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		if len(f.faults) == 0 {
+			f.mu.Unlock()
+			next.ServeHTTP(w, r)
+			return
+		}
+		fault := f.faults[0]
+		f.faults = f.faults[1:]
+		f.mu.Unlock()
+
+		if fault.retryAfter != "" {
+			w.Header().Set("Retry-After", fault.retryAfter)
+		}
+		writeFakeError(w, fault.status, http.StatusText(fault.status), "")
+	})
+}
+
+func (f *FakeServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+FakeAccessToken {
+			writeFakeError(w, http.StatusUnauthorized, "Invalid access token", "")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *FakeServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	writeFakeJSON(w, map[string]any{
+		"access_token": FakeAccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+func (f *FakeServer) handleMe(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	writeFakeJSON(w, f.user)
+}
+
+func (f *FakeServer) handleTrack(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	track, ok := f.tracks[chi.URLParam(r, "id")]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "Non existing id", "")
+		return
+	}
+	writeFakeJSON(w, track)
+}
+
+func (f *FakeServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	query := strings.ToLower(r.URL.Query().Get("q"))
+	if query == "" {
+		writeFakeError(w, http.StatusBadRequest, "No search query", "")
+		return
+	}
+
+	limit := 20
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 50 {
+			writeFakeError(w, http.StatusBadRequest, "Invalid limit", "")
+			return
+		}
+		limit = parsed
+	}
+
+	items := []Track{}
+	for _, id := range f.order {
+		if len(items) == limit {
+			break
+		}
+		if track := f.tracks[id]; matchesQuery(track, query) {
+			items = append(items, track)
+		}
+	}
+
+	writeFakeJSON(w, map[string]any{"tracks": map[string]any{"items": items}})
+}
+
+func (f *FakeServer) handlePlayback(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.playback == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeFakeJSON(w, f.playback)
+}
+
+func (f *FakeServer) handleDevices(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	writeFakeJSON(w, map[string]any{"devices": append([]Device{}, f.devices...)})
+}
+
+func (f *FakeServer) handleQueue(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.activeDevice(r); !ok {
+		writeFakeError(w, http.StatusNotFound, "Player command failed: No active device found", "NO_ACTIVE_DEVICE")
+		return
+	}
+
+	uri := r.URL.Query().Get("uri")
+	if _, ok := f.tracks[strings.TrimPrefix(uri, trackURIPrefix)]; !ok {
+		writeFakeError(w, http.StatusBadRequest, "Invalid track uri", "")
+		return
+	}
+
+	f.queue = append(f.queue, uri)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *FakeServer) handlePlay(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	device, ok := f.activeDevice(r)
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "Player command failed: No active device found", "NO_ACTIVE_DEVICE")
+		return
+	}
+
+	var body struct {
+		URIs []string `json:"uris"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeFakeError(w, http.StatusBadRequest, "Malformed json", "")
+			return
+		}
+	}
+
+	f.activate(device)
+
+	if len(body.URIs) == 0 {
+		if f.playback.Item == nil {
+			writeFakeError(w, http.StatusForbidden, "Player command failed: Restriction violated", "UNKNOWN")
+			return
+		}
+		f.playback.IsPlaying = true
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	tracks := make([]Track, 0, len(body.URIs))
+	for _, uri := range body.URIs {
+		track, ok := f.tracks[strings.TrimPrefix(uri, trackURIPrefix)]
+		if !ok {
+			writeFakeError(w, http.StatusBadRequest, "Invalid track uri", "")
+			return
+		}
+		tracks = append(tracks, track)
+	}
+
+	// The remaining tracks are played before anything that was already queued
+	remaining := make([]string, 0, len(tracks)-1+len(f.queue))
+	for _, track := range tracks[1:] {
+		remaining = append(remaining, track.URI)
+	}
+	f.queue = append(remaining, f.queue...)
+
+	f.playback.Item = &tracks[0]
+	f.playback.ProgressMs = 0
+	f.playback.IsPlaying = true
+	f.playback.Timestamp = time.Now().UnixMilli()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *FakeServer) handlePause(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.activeDevice(r); !ok || f.playback == nil {
+		writeFakeError(w, http.StatusNotFound, "Player command failed: No active device found", "NO_ACTIVE_DEVICE")
+		return
+	}
+	if !f.playback.IsPlaying {
+		writeFakeError(w, http.StatusForbidden, "Player command failed: Restriction violated", "UNKNOWN")
+		return
+	}
+
+	f.playback.IsPlaying = false
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *FakeServer) handleNext(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.activeDevice(r); !ok || f.playback == nil {
+		writeFakeError(w, http.StatusNotFound, "Player command failed: No active device found", "NO_ACTIVE_DEVICE")
+		return
+	}
+
+	f.skip()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// matchesQuery reports whether the name of the track or one of its artists contains the query.
+func matchesQuery(track Track, query string) bool {
+	if strings.Contains(strings.ToLower(track.Name), query) {
+		return true
+	}
+	for _, artist := range track.Artists {
+		if strings.Contains(strings.ToLower(artist.Name), query) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeFakeJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeFakeError writes an error in the format the Spotify Web API uses.
+func writeFakeError(w http.ResponseWriter, status int, message, reason string) {
+	body := map[string]any{"status": status, "message": message}
+	if reason != "" {
+		body["reason"] = reason
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"error": body})
+}
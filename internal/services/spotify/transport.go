@@ -0,0 +1,286 @@
+package spotify
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryPolicy decides how often and how long the client waits before retrying a request.
+type RetryPolicy struct {
+	// MaxRetries is the number of times a request is retried after the first attempt
+	MaxRetries int
+	// BaseDelay is the delay before the first retry, it doubles with every further attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts
+	MaxDelay time.Duration
+	// MaxRetryAfter is the longest Retry-After the client waits out, longer ones are returned to the caller
+	MaxRetryAfter time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy used by clients created with NewClient.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:    3,
+	BaseDelay:     250 * time.Millisecond,
+	MaxDelay:      5 * time.Second,
+	MaxRetryAfter: 10 * time.Second,
+}
+
+// DefaultStats collects the call counters of every client that was not given its own.
+var DefaultStats = NewStats()
+
+// EndpointStats are the call counters of a single endpoint.
+type EndpointStats struct {
+	// Calls is the number of requests sent to the endpoint, including retries
+	Calls int64
+	// Retries is the number of those requests that were retries
+	Retries int64
+	// RateLimited is the number of responses that were 429 Too Many Requests
+	RateLimited int64
+	// Failures is the number of requests that still failed after all retries
+	Failures int64
+}
+
+// Stats counts the calls made to each Spotify endpoint. It is safe for concurrent use.
+type Stats struct {
+	mu        sync.Mutex
+	endpoints map[string]*EndpointStats
+}
+
+// NewStats creates an empty set of counters.
+func NewStats() *Stats {
+	return &Stats{endpoints: make(map[string]*EndpointStats)}
+}
+
+// Endpoint returns the counters of the given endpoint, e.g. "GET /tracks/{id}".
+func (s *Stats) Endpoint(endpoint string) EndpointStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stats, ok := s.endpoints[endpoint]; ok {
+		return *stats
+	}
+	return EndpointStats{}
+}
+
+// Snapshot returns the counters of every endpoint that has been called.
+func (s *Stats) Snapshot() map[string]EndpointStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := make(map[string]EndpointStats, len(s.endpoints))
+	for endpoint, stats := range s.endpoints {
+		snapshot[endpoint] = *stats
+	}
+	return snapshot
+}
+
+// record applies the given change to the counters of an endpoint.
+func (s *Stats) record(endpoint string, change func(*EndpointStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats, ok := s.endpoints[endpoint]
+	if !ok {
+		stats = &EndpointStats{}
+		s.endpoints[endpoint] = stats
+	}
+	change(stats)
+}
+
+// RetryTransport is an http.RoundTripper that retries requests Spotify rate limited or failed to serve.
+// Rate limited requests are always retried, since Spotify did not act on them, waiting for as long as the
+// Retry-After header asks. Server errors and network failures are only retried for idempotent methods,
+// with jittered exponential backoff.
+type RetryTransport struct {
+	// Base is the transport requests are sent with, http.DefaultTransport if nil
+	Base http.RoundTripper
+	// Policy decides how often and how long to wait before retrying
+	Policy RetryPolicy
+	// Stats collects the call counters of each endpoint
+	Stats *Stats
+
+	// sleep waits for the given duration, or until the context is done
+	sleep func(ctx context.Context, duration time.Duration) error
+}
+
+// NewRetryTransport creates a retry transport around the given base transport.
+func NewRetryTransport(base http.RoundTripper, policy RetryPolicy, stats *Stats) *RetryTransport {
+	if stats == nil {
+		stats = DefaultStats
+	}
+
+	return &RetryTransport{
+		Base:   base,
+		Policy: policy,
+		Stats:  stats,
+		sleep:  sleep,
+	}
+}
+
+// RoundTrip sends the request, retrying it as the policy allows.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	endpoint := EndpointName(req.Method, req.URL.Path)
+
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 {
+			var err error
+			if attemptReq, err = rewind(req); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := base.RoundTrip(attemptReq)
+		t.Stats.record(endpoint, func(stats *EndpointStats) {
+			stats.Calls++
+			if attempt > 0 {
+				stats.Retries++
+			}
+			if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+				stats.RateLimited++
+			}
+		})
+
+		delay, retry := t.retryDelay(req, resp, err, attempt)
+		if !retry {
+			if err != nil || resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+				t.Stats.record(endpoint, func(stats *EndpointStats) { stats.Failures++ })
+			}
+			return resp, err
+		}
+
+		if resp != nil {
+			// The body has to be drained for the connection to be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := t.sleep(req.Context(), delay); err != nil {
+			t.Stats.record(endpoint, func(stats *EndpointStats) { stats.Failures++ })
+			return nil, err
+		}
+	}
+}
+
+// retryDelay decides whether an attempt should be retried and how long to wait before doing so.
+func (t *RetryTransport) retryDelay(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= t.Policy.MaxRetries || req.Context().Err() != nil {
+		return 0, false
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return 0, false
+	}
+
+	if err != nil {
+		return t.backoff(attempt), idempotent(req.Method)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		retryAfter, ok := RetryAfter(resp)
+		if !ok {
+			return t.backoff(attempt), true
+		}
+		return retryAfter, retryAfter <= t.Policy.MaxRetryAfter
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return t.backoff(attempt), idempotent(req.Method)
+	}
+	return 0, false
+}
+
+// backoff returns a random delay between zero and the exponential backoff of the given attempt.
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	delay := t.Policy.BaseDelay << attempt
+	if delay <= 0 || delay > t.Policy.MaxDelay {
+		delay = t.Policy.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// RetryAfter returns how long the response asks the client to wait before trying again.
+func RetryAfter(resp *http.Response) (time.Duration, bool) {
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// EndpointName returns the name the counters of a request are kept under. IDs in the path are replaced
+// by a placeholder so every request to the same endpoint is counted together.
+func EndpointName(method, path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > 0 && segments[0] == "v1" {
+		segments = segments[1:]
+	}
+
+	for i := 1; i < len(segments); i++ {
+		switch segments[i-1] {
+		case "tracks", "albums", "artists", "playlists", "users", "episodes", "shows":
+			segments[i] = "{id}"
+		}
+	}
+	return method + " /" + strings.Join(segments, "/")
+}
+
+// idempotent reports whether a request with the given method can safely be sent more than once.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// rewind returns a copy of the request with a fresh body, so it can be sent again.
+func rewind(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		clone.Body = body
+	}
+	return clone, nil
+}
+
+// sleep waits for the given duration, or returns early with the context's error if it is done first.
+func sleep(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
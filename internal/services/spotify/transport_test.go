@@ -0,0 +1,149 @@
+package spotify_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"garrettpfoy/orbit-api/internal/services/spotify"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestRetryRateLimited(t *testing.T) {
+	fake, client := setupFakeServer(t)
+	fake.FailNext(2, http.StatusTooManyRequests, 0)
+
+	user, err := client.CurrentUser(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "fake-user", user.ID)
+
+	stats := fake.Stats.Endpoint("GET /me")
+	assert.Equal(t, int64(3), stats.Calls)
+	assert.Equal(t, int64(2), stats.Retries)
+	assert.Equal(t, int64(2), stats.RateLimited)
+	assert.Equal(t, int64(0), stats.Failures)
+}
+
+func TestRetryRateLimitedExhausted(t *testing.T) {
+	fake, client := setupFakeServer(t)
+	fake.FailNext(spotify.FakeRetryPolicy.MaxRetries+1, http.StatusTooManyRequests, 0)
+
+	_, err := client.CurrentUser(context.Background())
+	assert.ErrorIs(t, err, spotify.ErrRateLimited)
+
+	var rateLimited *spotify.RateLimitedError
+	assert.True(t, errors.As(err, &rateLimited))
+	assert.Equal(t, "GET /me", rateLimited.Err.Endpoint)
+
+	stats := fake.Stats.Endpoint("GET /me")
+	assert.Equal(t, int64(spotify.FakeRetryPolicy.MaxRetries+1), stats.Calls)
+	assert.Equal(t, int64(1), stats.Failures)
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	fake, client := setupFakeServer(t)
+	fake.FailNext(1, http.StatusTooManyRequests, time.Minute)
+
+	_, err := client.Track(context.Background(), "spotify:track:track1")
+
+	var rateLimited *spotify.RateLimitedError
+	assert.True(t, errors.As(err, &rateLimited))
+	assert.Equal(t, time.Minute, rateLimited.RetryAfter)
+	assert.Equal(t, int64(1), fake.Stats.Endpoint("GET /tracks/{id}").Calls)
+}
+
+func TestRetryRateLimitedNonIdempotent(t *testing.T) {
+	fake, client := setupFakeServer(t)
+	fake.AddDevice(spotify.Device{ID: "speaker", IsActive: true})
+	fake.FailNext(1, http.StatusTooManyRequests, 0)
+
+	// Rate limited requests were never acted on, so even a POST is safe to retry
+	assert.NoError(t, client.AddToQueue(context.Background(), "spotify:track:track1", ""))
+	assert.Equal(t, []string{"spotify:track:track1"}, fake.Queue())
+}
+
+func TestRetryServerErrors(t *testing.T) {
+	fake, client := setupFakeServer(t)
+	ctx := context.Background()
+	fake.AddDevice(spotify.Device{ID: "speaker", IsActive: true})
+
+	// Idempotent requests are retried, including their body
+	fake.FailNext(2, http.StatusBadGateway, -1)
+	assert.NoError(t, client.Play(ctx, "", "spotify:track:track1"))
+	assert.Equal(t, "spotify:track:track1", fake.Playback().Item.URI)
+	assert.Equal(t, int64(2), fake.Stats.Endpoint("PUT /me/player/play").Retries)
+
+	// Skipping twice would skip a track too many, so it is not retried
+	fake.FailNext(1, http.StatusServiceUnavailable, -1)
+	err := client.Next(ctx, "")
+
+	var apiErr *spotify.Error
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+
+	stats := fake.Stats.Endpoint("POST /me/player/next")
+	assert.Equal(t, int64(1), stats.Calls)
+	assert.Equal(t, int64(0), stats.Retries)
+	assert.Equal(t, int64(1), stats.Failures)
+}
+
+func TestRetryStopsWithContext(t *testing.T) {
+	fake, _ := setupFakeServer(t)
+	fake.FailNext(1, http.StatusTooManyRequests, 5*time.Second)
+
+	stats := spotify.NewStats()
+	httpClient := oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: spotify.FakeAccessToken}))
+	httpClient.Transport = spotify.NewRetryTransport(httpClient.Transport, spotify.DefaultRetryPolicy, stats)
+	client := spotify.NewClient(httpClient, fake.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	_, err := client.CurrentUser(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(started), time.Second)
+	assert.Equal(t, int64(1), stats.Endpoint("GET /me").Failures)
+}
+
+func TestRetryAfter(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	_, ok := spotify.RetryAfter(resp)
+	assert.False(t, ok)
+
+	resp.Header.Set("Retry-After", "3")
+	delay, ok := spotify.RetryAfter(resp)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, delay)
+
+	resp.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	delay, ok = spotify.RetryAfter(resp)
+	assert.True(t, ok)
+	assert.InDelta(t, time.Hour, delay, float64(2*time.Second))
+
+	resp.Header.Set("Retry-After", "soon")
+	_, ok = spotify.RetryAfter(resp)
+	assert.False(t, ok)
+}
+
+func TestEndpointName(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{http.MethodGet, "/v1/me", "GET /me"},
+		{http.MethodGet, "/v1/tracks/abc123", "GET /tracks/{id}"},
+		{http.MethodGet, "/tracks/abc123", "GET /tracks/{id}"},
+		{http.MethodPost, "/v1/me/player/queue", "POST /me/player/queue"},
+		{http.MethodGet, "/v1/users/someone/playlists", "GET /users/{id}/playlists"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, spotify.EndpointName(test.method, test.path))
+	}
+}
@@ -0,0 +1,65 @@
+package spotify
+
+// User is the profile of a Spotify user.
+type User struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	Country     string `json:"country"`
+	Product     string `json:"product"`
+	URI         string `json:"uri"`
+}
+
+// Image is an image of an album, in one of the sizes Spotify provides.
+type Image struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Artist is an artist credited on a track.
+type Artist struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	URI  string `json:"uri"`
+}
+
+// Album is the album a track appears on.
+type Album struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	URI    string  `json:"uri"`
+	Images []Image `json:"images"`
+}
+
+// Track is a track in the Spotify catalog.
+type Track struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	URI        string   `json:"uri"`
+	DurationMs int      `json:"duration_ms"`
+	Explicit   bool     `json:"explicit"`
+	Artists    []Artist `json:"artists"`
+	Album      Album    `json:"album"`
+}
+
+// Device is a device a user can play music on.
+type Device struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	IsActive      bool   `json:"is_active"`
+	IsRestricted  bool   `json:"is_restricted"`
+	VolumePercent *int   `json:"volume_percent"`
+}
+
+// PlaybackState is the state of a user's player.
+type PlaybackState struct {
+	Device       Device `json:"device"`
+	IsPlaying    bool   `json:"is_playing"`
+	ProgressMs   int    `json:"progress_ms"`
+	Item         *Track `json:"item"`
+	ShuffleState bool   `json:"shuffle_state"`
+	RepeatState  string `json:"repeat_state"`
+	Timestamp    int64  `json:"timestamp"`
+}
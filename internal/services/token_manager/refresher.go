@@ -0,0 +1,71 @@
+package token_manager
+
+import (
+	"context"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/repositories/access_token"
+	"log"
+	"time"
+)
+
+// Refresher proactively refreshes the tokens of session hosts before they expire, so a party
+// keeps playing even when no request needed the token around the time it expired.
+type Refresher struct {
+	manager   *Manager
+	tokens    access_token.AccessTokenRepository
+	interval  time.Duration
+	lookahead time.Duration
+}
+
+// NewRefresher creates a refresher that, every interval, refreshes the session tokens expiring
+// within lookahead. The lookahead should be greater than the interval, so no token expires between runs.
+func NewRefresher(manager *Manager, tokens access_token.AccessTokenRepository, interval, lookahead time.Duration) *Refresher {
+	return &Refresher{
+		manager:   manager,
+		tokens:    tokens,
+		interval:  interval,
+		lookahead: lookahead,
+	}
+}
+
+// Run refreshes expiring tokens every interval until the context is cancelled.
+func (r *Refresher) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if refreshed, err := r.RefreshExpiring(ctx); err != nil {
+			log.Printf("Failed to refresh expiring access tokens (%d refreshed): %v", refreshed, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RefreshExpiring refreshes every session token expiring within the lookahead, and returns how
+// many were refreshed. A failure to refresh one token does not stop the others from being refreshed.
+func (r *Refresher) RefreshExpiring(ctx context.Context) (int, error) {
+	expiring, err := r.tokens.GetSessionAccessTokensExpiringBefore(time.Now().Add(r.lookahead))
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expiring access tokens: %w", err)
+	}
+
+	var refreshed int
+	var failures []error
+	for _, accessToken := range expiring {
+		if _, err := r.manager.refreshIfExpiring(ctx, accessToken.ID, r.lookahead); err != nil {
+			failures = append(failures, fmt.Errorf("access token %d: %w", accessToken.ID, err))
+			continue
+		}
+		refreshed++
+	}
+
+	if len(failures) > 0 {
+		return refreshed, fmt.Errorf("failed to refresh %d access tokens: %v", len(failures), failures)
+	}
+	return refreshed, nil
+}
@@ -0,0 +1,200 @@
+package token_manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/access_token"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// This package keeps the stored Spotify tokens of users valid. Spotify access tokens expire after
+// an hour, so tokens are refreshed with their refresh token shortly before they expire, both on
+// demand and proactively for the hosts of sessions.
+
+// DefaultRefreshMargin is how long before its expiry a token is considered due for a refresh.
+const DefaultRefreshMargin = 5 * time.Minute
+
+// ErrTokenNotFound is returned when the user or session does not have a stored token.
+var ErrTokenNotFound = errors.New("no access token is stored")
+
+// Manager returns valid tokens for users and sessions, refreshing and persisting them when they
+// are close to expiring.
+type Manager struct {
+	tokens access_token.AccessTokenRepository
+	config *oauth2.Config
+	margin time.Duration
+
+	mu    sync.Mutex
+	locks map[uint]*sync.Mutex
+}
+
+// NewManager creates a token manager that refreshes tokens using the given OAuth2 configuration
+// once they expire within margin.
+func NewManager(tokens access_token.AccessTokenRepository, config *oauth2.Config, margin time.Duration) *Manager {
+	return &Manager{
+		tokens: tokens,
+		config: config,
+		margin: margin,
+		locks:  make(map[uint]*sync.Mutex),
+	}
+}
+
+// TokenForUser returns a valid token for the user, refreshing it if it is close to expiring.
+func (m *Manager) TokenForUser(ctx context.Context, userID uint) (*oauth2.Token, error) {
+	return m.validToken(ctx, func() (*models.AccessToken, error) {
+		return m.tokens.GetAccessTokenByUserID(userID)
+	})
+}
+
+// TokenForSession returns a valid token for the host of the session, refreshing it if it is close to expiring.
+func (m *Manager) TokenForSession(ctx context.Context, sessionID uint) (*oauth2.Token, error) {
+	return m.validToken(ctx, func() (*models.AccessToken, error) {
+		return m.tokens.GetAccessTokenBySessionID(sessionID)
+	})
+}
+
+// ClientForUser returns an HTTP client that authorizes requests with the user's token, which
+// is refreshed as needed for as long as the client is used.
+func (m *Manager) ClientForUser(ctx context.Context, userID uint) *http.Client {
+	return oauth2.NewClient(ctx, oauth2.ReuseTokenSource(nil, &tokenSource{ctx: ctx, token: func(ctx context.Context) (*oauth2.Token, error) {
+		return m.TokenForUser(ctx, userID)
+	}}))
+}
+
+// ClientForSession returns an HTTP client that authorizes requests with the token of the host
+// of the session, which is refreshed as needed for as long as the client is used.
+func (m *Manager) ClientForSession(ctx context.Context, sessionID uint) *http.Client {
+	return oauth2.NewClient(ctx, oauth2.ReuseTokenSource(nil, &tokenSource{ctx: ctx, token: func(ctx context.Context) (*oauth2.Token, error) {
+		return m.TokenForSession(ctx, sessionID)
+	}}))
+}
+
+// Refresh refreshes the stored token regardless of its expiry, e.g. after Spotify rejected it.
+func (m *Manager) Refresh(ctx context.Context, tokenID uint) (*oauth2.Token, error) {
+	lock := m.lock(tokenID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	accessToken, err := m.tokens.GetAccessToken(tokenID)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return m.refresh(ctx, accessToken)
+}
+
+// validToken looks up the stored token and returns it, refreshing it first if it expires within the margin.
+func (m *Manager) validToken(ctx context.Context, lookup func() (*models.AccessToken, error)) (*oauth2.Token, error) {
+	accessToken, err := lookup()
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	if m.expiresAfter(accessToken, m.margin) {
+		return toOAuth2Token(accessToken), nil
+	}
+
+	return m.refreshIfExpiring(ctx, accessToken.ID, m.margin)
+}
+
+// refreshIfExpiring refreshes the stored token with the given ID if it expires within the given
+// duration, and returns the valid token.
+func (m *Manager) refreshIfExpiring(ctx context.Context, tokenID uint, within time.Duration) (*oauth2.Token, error) {
+	lock := m.lock(tokenID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Another request may have refreshed the token while waiting for the lock
+	accessToken, err := m.tokens.GetAccessToken(tokenID)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	if m.expiresAfter(accessToken, within) {
+		return toOAuth2Token(accessToken), nil
+	}
+
+	return m.refresh(ctx, accessToken)
+}
+
+// refresh exchanges the refresh token of the stored token for a new access token, and persists it.
+// The caller must hold the lock of the token.
+func (m *Manager) refresh(ctx context.Context, accessToken *models.AccessToken) (*oauth2.Token, error) {
+	expired := &oauth2.Token{
+		AccessToken:  accessToken.AccessToken,
+		RefreshToken: accessToken.RefreshToken,
+		Expiry:       time.Now().Add(-time.Second),
+	}
+
+	refreshed, err := m.config.TokenSource(ctx, expired).Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh access token: %w", err)
+	}
+
+	accessToken.AccessToken = refreshed.AccessToken
+	// Spotify only issues a new refresh token occasionally, in which case the stored one remains valid
+	if refreshed.RefreshToken != "" && refreshed.RefreshToken != expired.RefreshToken {
+		accessToken.RefreshToken = refreshed.RefreshToken
+	}
+	accessToken.ExpiryTime = refreshed.Expiry
+
+	token := toOAuth2Token(accessToken)
+
+	// Saving encrypts the model in place, so the token is built beforehand
+	if err := m.tokens.UpdateAccessToken(accessToken); err != nil {
+		return nil, fmt.Errorf("failed to persist refreshed access token: %w", err)
+	}
+
+	return token, nil
+}
+
+// expiresAfter reports whether the token remains valid for at least the given duration.
+func (m *Manager) expiresAfter(accessToken *models.AccessToken, duration time.Duration) bool {
+	return accessToken.ExpiryTime.After(time.Now().Add(duration))
+}
+
+// lock returns the mutex that serializes refreshes of the token with the given ID.
+func (m *Manager) lock(tokenID uint) *sync.Mutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lock, ok := m.locks[tokenID]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.locks[tokenID] = lock
+	}
+	return lock
+}
+
+func toOAuth2Token(accessToken *models.AccessToken) *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken:  accessToken.AccessToken,
+		TokenType:    "Bearer",
+		RefreshToken: accessToken.RefreshToken,
+		Expiry:       accessToken.ExpiryTime,
+	}
+}
+
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrTokenNotFound
+	}
+	return err
+}
+
+// tokenSource adapts a token lookup of the manager to an oauth2.TokenSource.
+type tokenSource struct {
+	ctx   context.Context
+	token func(ctx context.Context) (*oauth2.Token, error)
+}
+
+func (s *tokenSource) Token() (*oauth2.Token, error) {
+	return s.token(s.ctx)
+}
@@ -0,0 +1,293 @@
+package token_manager_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/handlers/host/auth"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/access_token"
+	"garrettpfoy/orbit-api/internal/repositories/session"
+	"garrettpfoy/orbit-api/internal/repositories/user"
+	"garrettpfoy/orbit-api/internal/services/encryption"
+	orbitOAuth2 "garrettpfoy/orbit-api/internal/services/oauth2"
+	"garrettpfoy/orbit-api/internal/services/token_manager"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// tokenServer is a fake OAuth2 token endpoint that counts refreshes and issues numbered access tokens
+type tokenServer struct {
+	*httptest.Server
+	refreshes    atomic.Int32
+	refreshToken string
+}
+
+func setupTokenServer(t *testing.T) *tokenServer {
+	server := &tokenServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "refresh_token", r.PostForm.Get("grant_type"))
+
+		if r.PostForm.Get("refresh_token") == "revoked_refresh_token" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		refresh := server.refreshes.Add(1)
+		response := map[string]interface{}{
+			"access_token": fmt.Sprintf("refreshed_access_token_%d", refresh),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		}
+		if server.refreshToken != "" {
+			response["refresh_token"] = server.refreshToken
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (s *tokenServer) config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     "client_id",
+		ClientSecret: "client_secret",
+		Endpoint: oauth2.Endpoint{
+			TokenURL:  s.URL,
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+func setupTestDB() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Concurrent tests must share the single in-memory database
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	models.SetEncryptionService(encryption.NewEncryptionService("abcdefghijklmnopqrstuvwxyz123456"))
+
+	err = db.AutoMigrate(&models.AccessToken{})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func createToken(t *testing.T, repo *access_token.GormAccessTokenRepository, userID uint, sessionID *uint, refreshToken string, expiry time.Time) uint {
+	token := &models.AccessToken{
+		UserID:       userID,
+		SessionID:    sessionID,
+		AccessToken:  fmt.Sprintf("access_token_%d", userID),
+		RefreshToken: refreshToken,
+		ExpiryTime:   expiry,
+	}
+	assert.NoError(t, repo.CreateAccessToken(token))
+
+	return token.ID
+}
+
+func newUint(u uint) *uint {
+	return &u
+}
+
+func TestTokenForUserDoesNotRefreshValidToken(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	server := setupTokenServer(t)
+	repo := access_token.NewGormAccessTokenRepository(db)
+	manager := token_manager.NewManager(repo, server.config(), token_manager.DefaultRefreshMargin)
+
+	createToken(t, repo, 1, nil, "refresh_token", time.Now().Add(time.Hour))
+
+	token, err := manager.TokenForUser(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "access_token_1", token.AccessToken)
+	assert.Equal(t, int32(0), server.refreshes.Load())
+}
+
+func TestTokenForSessionRefreshesExpiringToken(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	server := setupTokenServer(t)
+	repo := access_token.NewGormAccessTokenRepository(db)
+	manager := token_manager.NewManager(repo, server.config(), token_manager.DefaultRefreshMargin)
+
+	tokenID := createToken(t, repo, 1, newUint(7), "refresh_token", time.Now().Add(time.Minute))
+
+	token, err := manager.TokenForSession(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Equal(t, "refreshed_access_token_1", token.AccessToken)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), token.Expiry, time.Minute)
+
+	// The refreshed token is persisted, keeping the refresh token as Spotify did not issue a new one
+	stored, err := repo.GetAccessToken(tokenID)
+	assert.NoError(t, err)
+	assert.Equal(t, "refreshed_access_token_1", stored.AccessToken)
+	assert.Equal(t, "refresh_token", stored.RefreshToken)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), stored.ExpiryTime, time.Minute)
+}
+
+func TestRefreshStoresRotatedRefreshToken(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	server := setupTokenServer(t)
+	server.refreshToken = "rotated_refresh_token"
+	repo := access_token.NewGormAccessTokenRepository(db)
+	manager := token_manager.NewManager(repo, server.config(), token_manager.DefaultRefreshMargin)
+
+	tokenID := createToken(t, repo, 1, nil, "refresh_token", time.Now().Add(time.Hour))
+
+	_, err = manager.Refresh(context.Background(), tokenID)
+	assert.NoError(t, err)
+
+	stored, err := repo.GetAccessToken(tokenID)
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated_refresh_token", stored.RefreshToken)
+}
+
+func TestConcurrentRequestsRefreshOnce(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	server := setupTokenServer(t)
+	repo := access_token.NewGormAccessTokenRepository(db)
+	manager := token_manager.NewManager(repo, server.config(), token_manager.DefaultRefreshMargin)
+
+	createToken(t, repo, 1, nil, "refresh_token", time.Now().Add(-time.Minute))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := manager.TokenForUser(context.Background(), 1)
+			assert.NoError(t, err)
+			assert.Equal(t, "refreshed_access_token_1", token.AccessToken)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), server.refreshes.Load())
+}
+
+func TestTokenNotFound(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	server := setupTokenServer(t)
+	repo := access_token.NewGormAccessTokenRepository(db)
+	manager := token_manager.NewManager(repo, server.config(), token_manager.DefaultRefreshMargin)
+
+	_, err = manager.TokenForUser(context.Background(), 1)
+	assert.ErrorIs(t, err, token_manager.ErrTokenNotFound)
+}
+
+func TestClientForUserAuthorizesRequests(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	server := setupTokenServer(t)
+	repo := access_token.NewGormAccessTokenRepository(db)
+	manager := token_manager.NewManager(repo, server.config(), token_manager.DefaultRefreshMargin)
+
+	createToken(t, repo, 1, nil, "refresh_token", time.Now().Add(time.Hour))
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer access_token_1", r.Header.Get("Authorization"))
+	}))
+	defer api.Close()
+
+	resp, err := manager.ClientForUser(context.Background(), 1).Get(api.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestRefresherRefreshesExpiringSessionTokens(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	server := setupTokenServer(t)
+	repo := access_token.NewGormAccessTokenRepository(db)
+	manager := token_manager.NewManager(repo, server.config(), token_manager.DefaultRefreshMargin)
+	refresher := token_manager.NewRefresher(manager, repo, time.Minute, 10*time.Minute)
+
+	expiringID := createToken(t, repo, 1, newUint(1), "refresh_token", time.Now().Add(5*time.Minute))
+	validID := createToken(t, repo, 2, newUint(2), "refresh_token_2", time.Now().Add(time.Hour))
+	createToken(t, repo, 3, newUint(3), "revoked_refresh_token", time.Now().Add(5*time.Minute))
+
+	refreshed, err := refresher.RefreshExpiring(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, 1, refreshed)
+
+	expiring, err := repo.GetAccessToken(expiringID)
+	assert.NoError(t, err)
+	assert.Equal(t, "refreshed_access_token_1", expiring.AccessToken)
+
+	valid, err := repo.GetAccessToken(validID)
+	assert.NoError(t, err)
+	assert.Equal(t, "access_token_2", valid.AccessToken)
+}
+
+func TestClientForSessionOfHostedSession(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.User{}, &models.Session{}))
+
+	server := setupTokenServer(t)
+	tokens := access_token.NewGormAccessTokenRepository(db)
+	manager := token_manager.NewManager(tokens, server.config(), token_manager.DefaultRefreshMargin)
+	refresher := token_manager.NewRefresher(manager, tokens, time.Minute, 10*time.Minute)
+
+	// The host signs in with Spotify, which stores their token, then starts a session
+	linker := auth.NewSpotifyUserLinker(user.NewGormUserRepository(db), tokens)
+	host, err := linker.LinkUser(context.Background(), &orbitOAuth2.Profile{Subject: "spotify_host", DisplayName: "Host"}, &oauth2.Token{
+		AccessToken:  "host_access_token",
+		RefreshToken: "host_refresh_token",
+		Expiry:       time.Now().Add(5 * time.Minute),
+	})
+	assert.NoError(t, err)
+
+	hosted := &models.Session{HostID: host.ID}
+	assert.NoError(t, session.NewGormSessionRepository(db).CreateSession(hosted))
+
+	// The token of the host is now the token of the session, so the refresher keeps it fresh
+	refreshed, err := refresher.RefreshExpiring(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, refreshed)
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer refreshed_access_token_1", r.Header.Get("Authorization"))
+	}))
+	defer api.Close()
+
+	resp, err := manager.ClientForSession(context.Background(), hosted.ID).Get(api.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+}
@@ -0,0 +1,67 @@
+package track_resolver
+
+import (
+	"container/list"
+	"garrettpfoy/orbit-api/internal/models"
+	"sync"
+)
+
+// lru is a fixed size cache of tracks that evicts the least recently used track when it is full.
+// It is safe for concurrent use.
+type lru struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+func newLRU(capacity int) *lru {
+	return &lru{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns a copy of the cached track with the given URI, marking it as recently used.
+func (c *lru) get(uri string) (models.Track, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[uri]
+	if !ok {
+		return models.Track{}, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(models.Track), true
+}
+
+// put caches the track, evicting the least recently used track if the cache is full.
+func (c *lru) put(track models.Track) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[track.URI]; ok {
+		element.Value = track
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[track.URI] = c.order.PushFront(track)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(models.Track).URI)
+	}
+}
+
+// len returns the number of cached tracks.
+func (c *lru) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
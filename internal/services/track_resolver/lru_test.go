@@ -0,0 +1,41 @@
+package track_resolver
+
+import (
+	"garrettpfoy/orbit-api/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newLRU(2)
+
+	cache.put(models.Track{URI: "spotify:track:1"})
+	cache.put(models.Track{URI: "spotify:track:2"})
+
+	// Using the first track makes the second the least recently used
+	_, ok := cache.get("spotify:track:1")
+	assert.True(t, ok)
+
+	cache.put(models.Track{URI: "spotify:track:3"})
+	assert.Equal(t, 2, cache.len())
+
+	_, ok = cache.get("spotify:track:2")
+	assert.False(t, ok)
+	_, ok = cache.get("spotify:track:1")
+	assert.True(t, ok)
+	_, ok = cache.get("spotify:track:3")
+	assert.True(t, ok)
+}
+
+func TestLRUReplacesExisting(t *testing.T) {
+	cache := newLRU(2)
+
+	cache.put(models.Track{URI: "spotify:track:1", Name: "Old"})
+	cache.put(models.Track{URI: "spotify:track:1", Name: "New"})
+	assert.Equal(t, 1, cache.len())
+
+	cached, ok := cache.get("spotify:track:1")
+	assert.True(t, ok)
+	assert.Equal(t, "New", cached.Name)
+}
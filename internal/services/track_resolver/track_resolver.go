@@ -0,0 +1,171 @@
+package track_resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/track"
+	"garrettpfoy/orbit-api/internal/services/spotify"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// This package resolves the Spotify metadata of tracks so clients can render the queue without calling
+// Spotify themselves. Metadata is looked up in an in-process LRU, then in the tracks table, and only
+// fetched from Spotify when neither has a copy younger than the TTL.
+
+// DefaultCacheSize is the number of tracks kept in memory by default.
+const DefaultCacheSize = 1000
+
+// DefaultTTL is how long fetched metadata is used before it is fetched again by default.
+const DefaultTTL = 24 * time.Hour
+
+// Resolver resolves the metadata of tracks by their Spotify URI.
+type Resolver struct {
+	tracks  track.TrackRepository
+	catalog *spotify.Client
+	ttl     time.Duration
+	cache   *lru
+	now     func() time.Time
+
+	mu       sync.Mutex
+	inflight map[string]*call
+}
+
+// call is a fetch from Spotify that concurrent resolutions of the same track wait on.
+type call struct {
+	done  chan struct{}
+	track *models.Track
+	err   error
+}
+
+// NewResolver creates a resolver that fetches metadata with the given catalog client, which does not need
+// to act on behalf of a user, and caches it in the tracks table and in memory for cacheSize tracks.
+func NewResolver(tracks track.TrackRepository, catalog *spotify.Client, cacheSize int, ttl time.Duration) *Resolver {
+	return &Resolver{
+		tracks:   tracks,
+		catalog:  catalog,
+		ttl:      ttl,
+		cache:    newLRU(cacheSize),
+		now:      time.Now,
+		inflight: make(map[string]*call),
+	}
+}
+
+// Resolve returns the metadata of the track with the given URI. Stale metadata is refreshed from Spotify,
+// but if Spotify cannot be reached the stale copy is returned rather than failing.
+func (r *Resolver) Resolve(ctx context.Context, uri string) (*models.Track, error) {
+	if _, err := spotify.TrackIDFromURI(uri); err != nil {
+		return nil, err
+	}
+
+	if cached, ok := r.cache.get(uri); ok && r.fresh(cached) {
+		return &cached, nil
+	}
+
+	stored, err := r.tracks.GetTrack(uri)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load track %s: %w", uri, err)
+	}
+	if err == nil && r.fresh(*stored) {
+		r.cache.put(*stored)
+		return stored, nil
+	}
+
+	fetched, fetchErr := r.fetch(ctx, uri)
+	if fetchErr != nil {
+		if err == nil && !errors.Is(fetchErr, spotify.ErrNotFound) {
+			fmt.Printf("Using stale metadata for %s, failed to refresh it: %v\n", uri, fetchErr)
+			r.cache.put(*stored)
+			return stored, nil
+		}
+		return nil, fetchErr
+	}
+	return fetched, nil
+}
+
+// fetch fetches the metadata of a track from Spotify and stores it. Concurrent fetches of the same track
+// share a single request.
+func (r *Resolver) fetch(ctx context.Context, uri string) (*models.Track, error) {
+	r.mu.Lock()
+	if pending, ok := r.inflight[uri]; ok {
+		r.mu.Unlock()
+		select {
+		case <-pending.done:
+			if pending.err != nil {
+				return nil, pending.err
+			}
+			result := *pending.track
+			return &result, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	pending := &call{done: make(chan struct{})}
+	r.inflight[uri] = pending
+	r.mu.Unlock()
+
+	pending.track, pending.err = r.fetchAndStore(ctx, uri)
+
+	r.mu.Lock()
+	delete(r.inflight, uri)
+	r.mu.Unlock()
+	close(pending.done)
+
+	if pending.err != nil {
+		return nil, pending.err
+	}
+	result := *pending.track
+	return &result, nil
+}
+
+func (r *Resolver) fetchAndStore(ctx context.Context, uri string) (*models.Track, error) {
+	spotifyTrack, err := r.catalog.Track(ctx, uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch track %s: %w", uri, err)
+	}
+
+	resolved := FromSpotify(spotifyTrack, r.now())
+	// Spotify may answer with the URI of a relinked track, the cache is keyed by the URI that was asked for
+	resolved.URI = uri
+	if err := r.tracks.SaveTrack(&resolved); err != nil {
+		return nil, fmt.Errorf("failed to store track %s: %w", uri, err)
+	}
+
+	r.cache.put(resolved)
+	return &resolved, nil
+}
+
+// fresh reports whether the metadata was fetched recently enough to be used.
+func (r *Resolver) fresh(cached models.Track) bool {
+	return r.now().Sub(cached.FetchedAt) < r.ttl
+}
+
+// FromSpotify converts a track from the Spotify Web API to its cached form.
+func FromSpotify(spotifyTrack *spotify.Track, fetchedAt time.Time) models.Track {
+	artists := make([]string, 0, len(spotifyTrack.Artists))
+	for _, artist := range spotifyTrack.Artists {
+		artists = append(artists, artist.Name)
+	}
+
+	var artworkURL string
+	if len(spotifyTrack.Album.Images) > 0 {
+		// Spotify lists the images of an album from largest to smallest
+		artworkURL = spotifyTrack.Album.Images[0].URL
+	}
+
+	return models.Track{
+		URI:        spotifyTrack.URI,
+		Name:       spotifyTrack.Name,
+		Artists:    strings.Join(artists, ", "),
+		Album:      spotifyTrack.Album.Name,
+		ArtworkURL: artworkURL,
+		DurationMs: spotifyTrack.DurationMs,
+		Explicit:   spotifyTrack.Explicit,
+		FetchedAt:  fetchedAt,
+	}
+}
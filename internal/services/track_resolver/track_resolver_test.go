@@ -0,0 +1,136 @@
+package track_resolver_test
+
+import (
+	"context"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/track"
+	"garrettpfoy/orbit-api/internal/services/spotify"
+	"garrettpfoy/orbit-api/internal/services/track_resolver"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AutoMigrate(&models.Track{})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func setupFakeServer(t *testing.T) *spotify.FakeServer {
+	fake := spotify.NewFakeServer()
+	t.Cleanup(fake.Close)
+
+	fake.AddTrack(spotify.Track{
+		ID:         "track1",
+		Name:       "Harvest Moon",
+		DurationMs: 300000,
+		Artists:    []spotify.Artist{{Name: "Neil Young"}, {Name: "Linda Ronstadt"}},
+		Album: spotify.Album{
+			Name:   "Harvest Moon",
+			Images: []spotify.Image{{URL: "https://images.example.com/large.jpg", Width: 640}, {URL: "https://images.example.com/small.jpg", Width: 64}},
+		},
+	})
+	return fake
+}
+
+func TestResolve(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+	fake := setupFakeServer(t)
+
+	resolver := track_resolver.NewResolver(track.NewGormTrackRepository(db), fake.Client(), 10, time.Hour)
+
+	resolved, err := resolver.Resolve(context.Background(), "spotify:track:track1")
+	assert.NoError(t, err)
+	assert.Equal(t, "spotify:track:track1", resolved.URI)
+	assert.Equal(t, "Harvest Moon", resolved.Name)
+	assert.Equal(t, "Neil Young, Linda Ronstadt", resolved.Artists)
+	assert.Equal(t, "https://images.example.com/large.jpg", resolved.ArtworkURL)
+	assert.Equal(t, 300000, resolved.DurationMs)
+
+	// The second lookup is served from memory
+	_, err = resolver.Resolve(context.Background(), "spotify:track:track1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), fake.Stats.Endpoint("GET /tracks/{id}").Calls)
+
+	var stored models.Track
+	err = db.Where("uri = ?", "spotify:track:track1").First(&stored).Error
+	assert.NoError(t, err)
+	assert.Equal(t, "Harvest Moon", stored.Name)
+}
+
+func TestResolveFromDatabase(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+	fake := setupFakeServer(t)
+
+	_, err = track_resolver.NewResolver(track.NewGormTrackRepository(db), fake.Client(), 10, time.Hour).Resolve(context.Background(), "spotify:track:track1")
+	assert.NoError(t, err)
+
+	// A resolver with an empty memory cache, e.g. after a restart, uses the stored metadata
+	resolved, err := track_resolver.NewResolver(track.NewGormTrackRepository(db), fake.Client(), 10, time.Hour).Resolve(context.Background(), "spotify:track:track1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Harvest Moon", resolved.Name)
+	assert.Equal(t, int64(1), fake.Stats.Endpoint("GET /tracks/{id}").Calls)
+}
+
+func TestResolveRefreshesStaleMetadata(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+	fake := setupFakeServer(t)
+
+	resolver := track_resolver.NewResolver(track.NewGormTrackRepository(db), fake.Client(), 10, time.Nanosecond)
+
+	_, err = resolver.Resolve(context.Background(), "spotify:track:track1")
+	assert.NoError(t, err)
+
+	fake.AddTrack(spotify.Track{ID: "track1", Name: "Harvest Moon (Remastered)", DurationMs: 301000})
+	resolved, err := resolver.Resolve(context.Background(), "spotify:track:track1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Harvest Moon (Remastered)", resolved.Name)
+	assert.Equal(t, int64(2), fake.Stats.Endpoint("GET /tracks/{id}").Calls)
+}
+
+func TestResolveFallsBackToStaleMetadata(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+	fake := setupFakeServer(t)
+
+	resolver := track_resolver.NewResolver(track.NewGormTrackRepository(db), fake.Client(), 10, time.Nanosecond)
+
+	_, err = resolver.Resolve(context.Background(), "spotify:track:track1")
+	assert.NoError(t, err)
+
+	fake.FailNext(spotify.FakeRetryPolicy.MaxRetries+1, http.StatusServiceUnavailable, -1)
+	resolved, err := resolver.Resolve(context.Background(), "spotify:track:track1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Harvest Moon", resolved.Name)
+}
+
+func TestResolveUnknownTrack(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+	fake := setupFakeServer(t)
+
+	resolver := track_resolver.NewResolver(track.NewGormTrackRepository(db), fake.Client(), 10, time.Hour)
+
+	_, err = resolver.Resolve(context.Background(), "spotify:track:missing")
+	assert.ErrorIs(t, err, spotify.ErrNotFound)
+
+	_, err = resolver.Resolve(context.Background(), "not-a-uri")
+	assert.ErrorIs(t, err, spotify.ErrInvalidURI)
+	assert.Equal(t, int64(1), fake.Stats.Endpoint("GET /tracks/{id}").Calls)
+}
@@ -0,0 +1,34 @@
+package validation
+
+import (
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+)
+
+// ValidateModerationAction validates a moderation action, if it is valid, it returns nil,
+// otherwise it returns an error
+func ValidateModerationAction(action models.ModerationAction) error {
+	if action.SessionID == 0 {
+		return fmt.Errorf("session ID is required")
+	}
+
+	if action.ActorID == 0 {
+		return fmt.Errorf("actor ID is required")
+	}
+
+	switch action.Action {
+	case models.ModerationPin, models.ModerationUnpin, models.ModerationMove, models.ModerationRemove:
+		if action.QueueID == nil || *action.QueueID == 0 {
+			return fmt.Errorf("queue ID is required for a %s action", action.Action)
+		}
+	case models.ModerationLock, models.ModerationUnlock, models.ModerationFreeze, models.ModerationUnfreeze:
+	default:
+		return fmt.Errorf("unknown moderation action %q", action.Action)
+	}
+
+	if action.Action == models.ModerationMove && action.Position < 1 {
+		return fmt.Errorf("position must be positive")
+	}
+
+	return nil
+}
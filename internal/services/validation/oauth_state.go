@@ -0,0 +1,24 @@
+package validation
+
+import (
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+)
+
+// ValidateOAuthState validates the state of a login in progress, if it is valid, it returns nil,
+// otherwise it returns an error
+func ValidateOAuthState(state models.OAuthState) error {
+	if state.State == "" {
+		return fmt.Errorf("state is empty")
+	}
+
+	if state.Provider == "" {
+		return fmt.Errorf("provider is empty")
+	}
+
+	if state.ExpiresAt.IsZero() {
+		return fmt.Errorf("expiry time is empty")
+	}
+
+	return nil
+}
@@ -20,5 +20,11 @@ func ValidateQueue(queue models.Queue) error {
 		return fmt.Errorf("user ID is required")
 	}
 
+	switch queue.Status {
+	case "", models.QueueStatusQueued, models.QueueStatusNowPlaying, models.QueueStatusPlayed, models.QueueStatusSkipped, models.QueueStatusRemoved:
+	default:
+		return fmt.Errorf("status %q is not a valid queue status", queue.Status)
+	}
+
 	return nil
 }
@@ -3,6 +3,8 @@ package validation
 import (
 	"fmt"
 	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/services/ordering"
+	"time"
 )
 
 func ValidateSession(session models.Session) error {
@@ -14,5 +16,86 @@ func ValidateSession(session models.Session) error {
 		return fmt.Errorf("host ID is empty")
 	}
 
+	if session.JoinCode != nil && !isJoinCode(*session.JoinCode) {
+		return fmt.Errorf("join code must be %d digits", models.JoinCodeLength)
+	}
+
+	switch session.Status {
+	case "", models.SessionStatusOpen, models.SessionStatusPaused, models.SessionStatusEnded:
+	default:
+		return fmt.Errorf("status %q is not a valid session status", session.Status)
+	}
+
+	if err := ValidateSessionSettings(session.Settings); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// isJoinCode reports whether the code is made of exactly JoinCodeLength digits
+func isJoinCode(code string) bool {
+	if len(code) != models.JoinCodeLength {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateSessionSettings validates the settings of a session, if they are valid, it returns nil,
+// otherwise it returns an error
+func ValidateSessionSettings(settings models.SessionSettings) error {
+	if settings.Version < 0 || settings.Version > models.SessionSettingsVersion {
+		return fmt.Errorf("unsupported settings version %d", settings.Version)
+	}
+
+	if settings.VoteCooldownSeconds < 0 {
+		return fmt.Errorf("vote cooldown cannot be negative")
+	}
+
+	if settings.VoteBudget < 0 {
+		return fmt.Errorf("vote budget cannot be negative")
+	}
+
+	if settings.VoteBudget > 0 && settings.VoteWindowSeconds <= 0 {
+		return fmt.Errorf("vote window must be positive when a vote budget is set")
+	}
+
+	if settings.QueueOrder != "" {
+		if _, err := ordering.ForSettings(settings, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	switch settings.DuplicatePolicy {
+	case "", models.DuplicatePolicyReject, models.DuplicatePolicyMerge, models.DuplicatePolicyAllowAfter:
+	default:
+		return fmt.Errorf("unknown duplicate policy %q", settings.DuplicatePolicy)
+	}
+
+	if settings.DuplicateCooldownMinutes < 0 {
+		return fmt.Errorf("duplicate cooldown cannot be negative")
+	}
+
+	if settings.MaxActiveItems < 0 || settings.MaxAddsPerHour < 0 || settings.MaxQueuedMinutes < 0 {
+		return fmt.Errorf("queue quotas cannot be negative")
+	}
+
+	if settings.SkipThreshold < 0 || settings.SkipThreshold > 1 {
+		return fmt.Errorf("skip threshold must be between 0 and 1")
+	}
+
+	if settings.IdleTimeoutMinutes < 0 {
+		return fmt.Errorf("idle timeout cannot be negative")
+	}
+
+	if settings.MaxTrackMinutes < 0 {
+		return fmt.Errorf("max track length cannot be negative")
+	}
+
 	return nil
 }
@@ -0,0 +1,20 @@
+package validation
+
+import (
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+)
+
+// ValidateSkipVote validates a skip vote, if it is valid, it returns nil,
+// otherwise it returns an error
+func ValidateSkipVote(skipVote models.SkipVote) error {
+	if skipVote.UserID == 0 {
+		return fmt.Errorf("user ID is required")
+	}
+
+	if skipVote.QueueID == 0 {
+		return fmt.Errorf("queue ID is required")
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package validation
+
+import (
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+)
+
+// ValidateTrack validates the cached metadata of a track, if it is valid, it returns nil,
+// otherwise it returns an error
+func ValidateTrack(track models.Track) error {
+	if track.URI == "" {
+		return fmt.Errorf("track URI is empty")
+	}
+
+	if track.Name == "" {
+		return fmt.Errorf("track name is empty")
+	}
+
+	if track.DurationMs <= 0 {
+		return fmt.Errorf("track duration must be positive")
+	}
+
+	if track.FetchedAt.IsZero() {
+		return fmt.Errorf("fetch time is empty")
+	}
+
+	return nil
+}
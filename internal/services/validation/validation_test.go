@@ -14,6 +14,10 @@ func newString(s string) *string {
 	return &s
 }
 
+func newUint(u uint) *uint {
+	return &u
+}
+
 func TestValidateAccessToken(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -24,7 +28,7 @@ func TestValidateAccessToken(t *testing.T) {
 			name: "Valid AccessToken",
 			accessToken: models.AccessToken{
 				UserID:       1,
-				SessionID:    1,
+				SessionID:    newUint(1),
 				AccessToken:  "valid_access_token",
 				RefreshToken: "valid_refresh_token",
 				ExpiryTime:   time.Now().Add(time.Hour),
@@ -35,7 +39,7 @@ func TestValidateAccessToken(t *testing.T) {
 			name: "Empty UserID",
 			accessToken: models.AccessToken{
 				UserID:       0,
-				SessionID:    1,
+				SessionID:    newUint(1),
 				AccessToken:  "valid_access_token",
 				RefreshToken: "valid_refresh_token",
 				ExpiryTime:   time.Now().Add(time.Hour),
@@ -46,18 +50,29 @@ func TestValidateAccessToken(t *testing.T) {
 			name: "Empty SessionID",
 			accessToken: models.AccessToken{
 				UserID:       1,
-				SessionID:    0,
+				SessionID:    newUint(0),
 				AccessToken:  "valid_access_token",
 				RefreshToken: "valid_refresh_token",
 				ExpiryTime:   time.Now().Add(time.Hour),
 			},
 			expectedErr: fmt.Errorf("session ID is empty"),
 		},
+		{
+			name: "Unlinked Session",
+			accessToken: models.AccessToken{
+				UserID:       1,
+				SessionID:    nil,
+				AccessToken:  "valid_access_token",
+				RefreshToken: "valid_refresh_token",
+				ExpiryTime:   time.Now().Add(time.Hour),
+			},
+			expectedErr: nil,
+		},
 		{
 			name: "Empty AccessToken",
 			accessToken: models.AccessToken{
 				UserID:       1,
-				SessionID:    1,
+				SessionID:    newUint(1),
 				AccessToken:  "",
 				RefreshToken: "valid_refresh_token",
 				ExpiryTime:   time.Now().Add(time.Hour),
@@ -68,7 +83,7 @@ func TestValidateAccessToken(t *testing.T) {
 			name: "Empty RefreshToken",
 			accessToken: models.AccessToken{
 				UserID:       1,
-				SessionID:    1,
+				SessionID:    newUint(1),
 				AccessToken:  "valid_access_token",
 				RefreshToken: "",
 				ExpiryTime:   time.Now().Add(time.Hour),
@@ -79,7 +94,7 @@ func TestValidateAccessToken(t *testing.T) {
 			name: "Zero ExpiryTime",
 			accessToken: models.AccessToken{
 				UserID:       1,
-				SessionID:    1,
+				SessionID:    newUint(1),
 				AccessToken:  "valid_access_token",
 				RefreshToken: "valid_refresh_token",
 				ExpiryTime:   time.Time{},
@@ -130,6 +145,150 @@ func TestValidateSession(t *testing.T) {
 			},
 			expectedErr: fmt.Errorf("host ID is empty"),
 		},
+		{
+			name: "Default Settings",
+			session: models.Session{
+				Slug:     "valid_slug",
+				HostID:   1,
+				Settings: models.DefaultSessionSettings(),
+			},
+			expectedErr: nil,
+		},
+		{
+			name: "Negative Vote Cooldown",
+			session: models.Session{
+				Slug:     "valid_slug",
+				HostID:   1,
+				Settings: models.SessionSettings{VoteCooldownSeconds: -1},
+			},
+			expectedErr: fmt.Errorf("vote cooldown cannot be negative"),
+		},
+		{
+			name: "Negative Vote Budget",
+			session: models.Session{
+				Slug:     "valid_slug",
+				HostID:   1,
+				Settings: models.SessionSettings{VoteBudget: -1},
+			},
+			expectedErr: fmt.Errorf("vote budget cannot be negative"),
+		},
+		{
+			name: "Vote Budget Without Window",
+			session: models.Session{
+				Slug:     "valid_slug",
+				HostID:   1,
+				Settings: models.SessionSettings{VoteBudget: 10},
+			},
+			expectedErr: fmt.Errorf("vote window must be positive when a vote budget is set"),
+		},
+		{
+			name: "Fair Share Queue Order",
+			session: models.Session{
+				Slug:     "valid_slug",
+				HostID:   1,
+				Settings: models.SessionSettings{QueueOrder: "fair_share"},
+			},
+			expectedErr: nil,
+		},
+		{
+			name: "Invalid Join Code",
+			session: models.Session{
+				Slug:     "valid_slug",
+				HostID:   1,
+				JoinCode: newString("12a456"),
+			},
+			expectedErr: fmt.Errorf("join code must be 6 digits"),
+		},
+		{
+			name: "Invalid Status",
+			session: models.Session{
+				Slug:   "valid_slug",
+				HostID: 1,
+				Status: "closed",
+			},
+			expectedErr: fmt.Errorf("status \"closed\" is not a valid session status"),
+		},
+		{
+			name: "Negative Idle Timeout",
+			session: models.Session{
+				Slug:     "valid_slug",
+				HostID:   1,
+				Settings: models.SessionSettings{IdleTimeoutMinutes: -1},
+			},
+			expectedErr: fmt.Errorf("idle timeout cannot be negative"),
+		},
+		{
+			name: "Unsupported Settings Version",
+			session: models.Session{
+				Slug:     "valid_slug",
+				HostID:   1,
+				Settings: models.SessionSettings{Version: models.SessionSettingsVersion + 1},
+			},
+			expectedErr: fmt.Errorf("unsupported settings version %d", models.SessionSettingsVersion+1),
+		},
+		{
+			name: "Negative Max Track Length",
+			session: models.Session{
+				Slug:     "valid_slug",
+				HostID:   1,
+				Settings: models.SessionSettings{MaxTrackMinutes: -1},
+			},
+			expectedErr: fmt.Errorf("max track length cannot be negative"),
+		},
+		{
+			name: "Unknown Queue Order",
+			session: models.Session{
+				Slug:     "valid_slug",
+				HostID:   1,
+				Settings: models.SessionSettings{QueueOrder: "random"},
+			},
+			expectedErr: fmt.Errorf("unknown queue order \"random\""),
+		},
+		{
+			name: "Decay Queue Order Without Half-Life",
+			session: models.Session{
+				Slug:     "valid_slug",
+				HostID:   1,
+				Settings: models.SessionSettings{QueueOrder: "decay"},
+			},
+			expectedErr: fmt.Errorf("vote half-life must be positive with the decay queue order"),
+		},
+		{
+			name: "Unknown Duplicate Policy",
+			session: models.Session{
+				Slug:     "valid_slug",
+				HostID:   1,
+				Settings: models.SessionSettings{DuplicatePolicy: "ignore"},
+			},
+			expectedErr: fmt.Errorf("unknown duplicate policy \"ignore\""),
+		},
+		{
+			name: "Negative Duplicate Cooldown",
+			session: models.Session{
+				Slug:     "valid_slug",
+				HostID:   1,
+				Settings: models.SessionSettings{DuplicatePolicy: models.DuplicatePolicyAllowAfter, DuplicateCooldownMinutes: -1},
+			},
+			expectedErr: fmt.Errorf("duplicate cooldown cannot be negative"),
+		},
+		{
+			name: "Negative Queue Quota",
+			session: models.Session{
+				Slug:     "valid_slug",
+				HostID:   1,
+				Settings: models.SessionSettings{MaxAddsPerHour: -1},
+			},
+			expectedErr: fmt.Errorf("queue quotas cannot be negative"),
+		},
+		{
+			name: "Oversized Skip Threshold",
+			session: models.Session{
+				Slug:     "valid_slug",
+				HostID:   1,
+				Settings: models.SessionSettings{SkipThreshold: 1.5},
+			},
+			expectedErr: fmt.Errorf("skip threshold must be between 0 and 1"),
+		},
 	}
 
 	for _, tt := range tests {
@@ -186,6 +345,26 @@ func TestValidateQueue(t *testing.T) {
 			},
 			expectedErr: fmt.Errorf("user ID is required"),
 		},
+		{
+			name: "Now Playing Status",
+			queue: models.Queue{
+				TrackURI:  "spotify:track:123",
+				SessionID: 1,
+				UserID:    1,
+				Status:    models.QueueStatusNowPlaying,
+			},
+			expectedErr: nil,
+		},
+		{
+			name: "Unknown Status",
+			queue: models.Queue{
+				TrackURI:  "spotify:track:123",
+				SessionID: 1,
+				UserID:    1,
+				Status:    "paused",
+			},
+			expectedErr: fmt.Errorf("status \"paused\" is not a valid queue status"),
+		},
 	}
 
 	for _, tt := range tests {
@@ -267,3 +446,269 @@ func TestValidateUser(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateOAuthState(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       models.OAuthState
+		expectedErr error
+	}{
+		{
+			name: "Valid OAuthState",
+			state: models.OAuthState{
+				State:     "random_state",
+				Provider:  "spotify",
+				ExpiresAt: time.Now().Add(time.Minute),
+			},
+			expectedErr: nil,
+		},
+		{
+			name: "Empty State",
+			state: models.OAuthState{
+				State:     "",
+				Provider:  "spotify",
+				ExpiresAt: time.Now().Add(time.Minute),
+			},
+			expectedErr: fmt.Errorf("state is empty"),
+		},
+		{
+			name: "Empty Provider",
+			state: models.OAuthState{
+				State:     "random_state",
+				Provider:  "",
+				ExpiresAt: time.Now().Add(time.Minute),
+			},
+			expectedErr: fmt.Errorf("provider is empty"),
+		},
+		{
+			name: "Zero ExpiresAt",
+			state: models.OAuthState{
+				State:     "random_state",
+				Provider:  "spotify",
+				ExpiresAt: time.Time{},
+			},
+			expectedErr: fmt.Errorf("expiry time is empty"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validation.ValidateOAuthState(tt.state)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			}
+		})
+	}
+}
+
+func TestValidateTrack(t *testing.T) {
+	tests := []struct {
+		name        string
+		track       models.Track
+		expectedErr error
+	}{
+		{
+			name: "Valid Track",
+			track: models.Track{
+				URI:        "spotify:track:123",
+				Name:       "Harvest Moon",
+				DurationMs: 300000,
+				FetchedAt:  time.Now(),
+			},
+			expectedErr: nil,
+		},
+		{
+			name: "Empty URI",
+			track: models.Track{
+				URI:        "",
+				Name:       "Harvest Moon",
+				DurationMs: 300000,
+				FetchedAt:  time.Now(),
+			},
+			expectedErr: fmt.Errorf("track URI is empty"),
+		},
+		{
+			name: "Empty Name",
+			track: models.Track{
+				URI:        "spotify:track:123",
+				Name:       "",
+				DurationMs: 300000,
+				FetchedAt:  time.Now(),
+			},
+			expectedErr: fmt.Errorf("track name is empty"),
+		},
+		{
+			name: "Zero Duration",
+			track: models.Track{
+				URI:        "spotify:track:123",
+				Name:       "Harvest Moon",
+				DurationMs: 0,
+				FetchedAt:  time.Now(),
+			},
+			expectedErr: fmt.Errorf("track duration must be positive"),
+		},
+		{
+			name: "Zero FetchedAt",
+			track: models.Track{
+				URI:        "spotify:track:123",
+				Name:       "Harvest Moon",
+				DurationMs: 300000,
+			},
+			expectedErr: fmt.Errorf("fetch time is empty"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validation.ValidateTrack(tt.track)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			}
+		})
+	}
+}
+
+func TestValidateVote(t *testing.T) {
+	tests := []struct {
+		name        string
+		vote        models.Vote
+		expectedErr error
+	}{
+		{
+			name:        "Valid Upvote",
+			vote:        models.Vote{UserID: 1, QueueID: 1, Direction: models.VoteUp},
+			expectedErr: nil,
+		},
+		{
+			name:        "Valid Downvote",
+			vote:        models.Vote{UserID: 1, QueueID: 1, Direction: models.VoteDown},
+			expectedErr: nil,
+		},
+		{
+			name:        "Empty UserID",
+			vote:        models.Vote{UserID: 0, QueueID: 1, Direction: models.VoteUp},
+			expectedErr: fmt.Errorf("user ID is required"),
+		},
+		{
+			name:        "Empty QueueID",
+			vote:        models.Vote{UserID: 1, QueueID: 0, Direction: models.VoteUp},
+			expectedErr: fmt.Errorf("queue ID is required"),
+		},
+		{
+			name:        "Zero Direction",
+			vote:        models.Vote{UserID: 1, QueueID: 1, Direction: 0},
+			expectedErr: fmt.Errorf("direction must be either 1 or -1"),
+		},
+		{
+			name:        "Oversized Direction",
+			vote:        models.Vote{UserID: 1, QueueID: 1, Direction: 5},
+			expectedErr: fmt.Errorf("direction must be either 1 or -1"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validation.ValidateVote(tt.vote)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			}
+		})
+	}
+}
+
+func TestValidateSkipVote(t *testing.T) {
+	tests := []struct {
+		name        string
+		skipVote    models.SkipVote
+		expectedErr error
+	}{
+		{
+			name:        "Valid Skip Vote",
+			skipVote:    models.SkipVote{UserID: 1, QueueID: 1},
+			expectedErr: nil,
+		},
+		{
+			name:        "Empty UserID",
+			skipVote:    models.SkipVote{UserID: 0, QueueID: 1},
+			expectedErr: fmt.Errorf("user ID is required"),
+		},
+		{
+			name:        "Empty QueueID",
+			skipVote:    models.SkipVote{UserID: 1, QueueID: 0},
+			expectedErr: fmt.Errorf("queue ID is required"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validation.ValidateSkipVote(tt.skipVote)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			}
+		})
+	}
+}
+
+func TestValidateModerationAction(t *testing.T) {
+	queueID := uint(1)
+	tests := []struct {
+		name        string
+		action      models.ModerationAction
+		expectedErr error
+	}{
+		{
+			name:        "Valid Pin",
+			action:      models.ModerationAction{SessionID: 1, ActorID: 1, Action: models.ModerationPin, QueueID: &queueID},
+			expectedErr: nil,
+		},
+		{
+			name:        "Valid Lock",
+			action:      models.ModerationAction{SessionID: 1, ActorID: 1, Action: models.ModerationLock},
+			expectedErr: nil,
+		},
+		{
+			name:        "Empty SessionID",
+			action:      models.ModerationAction{ActorID: 1, Action: models.ModerationLock},
+			expectedErr: fmt.Errorf("session ID is required"),
+		},
+		{
+			name:        "Empty ActorID",
+			action:      models.ModerationAction{SessionID: 1, Action: models.ModerationLock},
+			expectedErr: fmt.Errorf("actor ID is required"),
+		},
+		{
+			name:        "Missing QueueID",
+			action:      models.ModerationAction{SessionID: 1, ActorID: 1, Action: models.ModerationRemove},
+			expectedErr: fmt.Errorf("queue ID is required for a remove action"),
+		},
+		{
+			name:        "Unknown Action",
+			action:      models.ModerationAction{SessionID: 1, ActorID: 1, Action: "ban"},
+			expectedErr: fmt.Errorf("unknown moderation action \"ban\""),
+		},
+		{
+			name:        "Move Without Position",
+			action:      models.ModerationAction{SessionID: 1, ActorID: 1, Action: models.ModerationMove, QueueID: &queueID},
+			expectedErr: fmt.Errorf("position must be positive"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validation.ValidateModerationAction(tt.action)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedErr.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package validation
+
+import (
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+)
+
+// ValidateVote validates a vote, if it is valid, it returns nil,
+// otherwise it returns an error
+func ValidateVote(vote models.Vote) error {
+	if vote.UserID == 0 {
+		return fmt.Errorf("user ID is required")
+	}
+
+	if vote.QueueID == 0 {
+		return fmt.Errorf("queue ID is required")
+	}
+
+	if vote.Direction != models.VoteUp && vote.Direction != models.VoteDown {
+		return fmt.Errorf("direction must be either 1 or -1")
+	}
+
+	return nil
+}
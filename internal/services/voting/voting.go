@@ -0,0 +1,313 @@
+package voting
+
+import (
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	sessionRepository "garrettpfoy/orbit-api/internal/repositories/session"
+	"garrettpfoy/orbit-api/internal/repositories/skip_vote"
+	"garrettpfoy/orbit-api/internal/repositories/vote"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// This package enforces the voting policy of a session before votes reach the vote repository. A user has to wait
+// for the cooldown of the session between two votes, and may only take the session's budget of vote actions within a
+// sliding window. Every action counts against the budget, be it casting, changing or retracting a vote or voting to
+// skip, and is recorded as a VoteEvent. The checks, the vote, its event and the user's LastVoteTime are written in one
+// transaction, so mashing the vote button from several devices at once cannot slip past the policy.
+//
+// Participants of a session can also vote to skip the now playing track. Once the session's skip threshold of its
+// participants voted to skip, the playback coordinator skips the track, asking the service through ShouldSkip.
+
+// ErrRateLimited is matched by every RateLimitError with errors.Is.
+var ErrRateLimited = errors.New("user is voting too often")
+
+// ErrVotingFrozen is returned when a user votes in a session whose host froze voting.
+var ErrVotingFrozen = errors.New("voting is frozen in this session")
+
+// ErrSessionEnded is returned when a user votes in a session that has ended.
+var ErrSessionEnded = errors.New("the session has ended")
+
+// ErrNotParticipant is returned when a user votes to skip a track in a session they are not part of.
+var ErrNotParticipant = errors.New("user is not a participant of the session")
+
+// Reason explains which part of the voting policy rejected a vote.
+type Reason string
+
+const (
+	// ReasonCooldown means the user voted less than the session's cooldown ago.
+	ReasonCooldown Reason = "cooldown"
+	// ReasonBudget means the user has used up their vote budget for the current window.
+	ReasonBudget Reason = "budget"
+)
+
+// RateLimitError is returned when the voting policy rejects a vote.
+type RateLimitError struct {
+	// Reason is the part of the policy that rejected the vote
+	Reason Reason
+	// RetryAt is the earliest time the user can vote again
+	RetryAt time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("vote rejected by the %s policy, retry at %s", e.Reason, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RetryAfter returns how long the user has to wait from now before voting again.
+func (e *RateLimitError) RetryAfter(now time.Time) time.Duration {
+	if wait := e.RetryAt.Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// SkipTally is how many participants voted to skip a queue item, out of how many are needed to skip it.
+type SkipTally struct {
+	// Votes is the number of participants that voted to skip the queue item
+	Votes int
+	// Needed is the number of skip votes that skip the queue item, zero if skip voting is disabled in the session
+	Needed int
+}
+
+// Reached reports whether enough participants voted to skip the queue item.
+func (t SkipTally) Reached() bool {
+	return t.Needed > 0 && t.Votes >= t.Needed
+}
+
+// Service casts, changes and retracts votes on behalf of users, enforcing the voting policy of their session.
+type Service struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+// NewService creates a voting service that stores votes in the given database.
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, now: time.Now}
+}
+
+// Vote casts the user's vote on a queue item in the given direction, or changes their existing vote to it.
+func (s *Service) Vote(userID, queueID uint, direction int) (*models.Vote, error) {
+	var result *models.Vote
+	err := s.enforce(userID, queueID, func(tx *gorm.DB, session *models.Session) (string, error) {
+		votes := vote.NewGormVoteRepository(tx)
+		newVote := &models.Vote{UserID: userID, QueueID: queueID, Direction: direction}
+		err := votes.CastVote(newVote)
+		if errors.Is(err, vote.ErrAlreadyVoted) {
+			result, err = votes.ChangeVote(userID, queueID, direction)
+			return models.VoteEventChange, err
+		}
+		result = newVote
+		return models.VoteEventCast, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Retract removes the user's vote on a queue item. Retracting counts as voting, so it cannot be used to dodge the policy.
+func (s *Service) Retract(userID, queueID uint) error {
+	return s.enforce(userID, queueID, func(tx *gorm.DB, session *models.Session) (string, error) {
+		return models.VoteEventRetract, vote.NewGormVoteRepository(tx).RetractVote(userID, queueID)
+	})
+}
+
+// VoteToSkip casts the user's vote to skip the now playing queue item of their session, returning the tally of skip votes
+// on the item. Voting to skip counts as voting, so it is subject to the same policy as other votes.
+func (s *Service) VoteToSkip(userID, queueID uint) (*SkipTally, error) {
+	var tally *SkipTally
+	err := s.enforce(userID, queueID, func(tx *gorm.DB, session *models.Session) (string, error) {
+		participants, err := participantsOf(tx, session)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := participants[userID]; !ok {
+			return "", ErrNotParticipant
+		}
+
+		if err := skip_vote.NewGormSkipVoteRepository(tx).CastSkipVote(&models.SkipVote{UserID: userID, QueueID: queueID}); err != nil {
+			return "", err
+		}
+
+		tally, err = skipTally(tx, session, queueID)
+		return models.VoteEventSkip, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tally, nil
+}
+
+// RetractSkip removes the user's vote to skip a queue item. Like retracting a vote, it counts as voting.
+func (s *Service) RetractSkip(userID, queueID uint) error {
+	return s.enforce(userID, queueID, func(tx *gorm.DB, session *models.Session) (string, error) {
+		return models.VoteEventRetractSkip, skip_vote.NewGormSkipVoteRepository(tx).RetractSkipVote(userID, queueID)
+	})
+}
+
+// SkipTally returns the tally of skip votes on a queue item.
+func (s *Service) SkipTally(queueID uint) (*SkipTally, error) {
+	var queueItem models.Queue
+	if err := s.db.Select("id", "session_id").First(&queueItem, queueID).Error; err != nil {
+		return nil, fmt.Errorf("error loading queue item: %w", err)
+	}
+
+	var session models.Session
+	if err := s.db.First(&session, queueItem.SessionID).Error; err != nil {
+		return nil, fmt.Errorf("error loading session: %w", err)
+	}
+
+	return skipTally(s.db, &session, queueID)
+}
+
+// ShouldSkip reports whether enough participants voted to skip the now playing queue item.
+func (s *Service) ShouldSkip(queueItem *models.Queue) (bool, error) {
+	tally, err := s.SkipTally(queueItem.ID)
+	if err != nil {
+		return false, err
+	}
+	return tally.Reached(), nil
+}
+
+// enforce checks that voting is not frozen in the queue item's session and the voting policy of the session for the user,
+// then applies the change to the votes and records the action the change returns and the time of the vote, all in one
+// transaction.
+func (s *Service) enforce(userID, queueID uint, change func(tx *gorm.DB, session *models.Session) (string, error)) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		now := s.now()
+
+		// Locking the user serializes their votes, so two simultaneous votes cannot both pass the checks
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "last_vote_time").First(&user, userID).Error; err != nil {
+			return fmt.Errorf("error loading user: %w", err)
+		}
+
+		var queueItem models.Queue
+		if err := tx.Select("id", "session_id").First(&queueItem, queueID).Error; err != nil {
+			return fmt.Errorf("error loading queue item: %w", err)
+		}
+
+		// The session is locked before the vote repository locks the queue item and the session is touched. Locks are
+		// always taken user first, then session, then queue item, so a vote cannot deadlock with an add or a pop
+		var session models.Session
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, queueItem.SessionID).Error; err != nil {
+			return fmt.Errorf("error loading session: %w", err)
+		}
+
+		if session.Status == models.SessionStatusEnded {
+			return ErrSessionEnded
+		}
+		if session.VotingFrozen {
+			return ErrVotingFrozen
+		}
+		if err := checkCooldown(session.Settings, user.LastVoteTime, now); err != nil {
+			return err
+		}
+		if err := checkBudget(tx, session.ID, session.Settings, userID, now); err != nil {
+			return err
+		}
+
+		action, err := change(tx, &session)
+		if err != nil {
+			return err
+		}
+		event := &models.VoteEvent{UserID: userID, SessionID: session.ID, QueueID: queueID, Action: action}
+		event.CreatedAt = now
+		if err := tx.Omit("User", "Session", "Queue").Create(event).Error; err != nil {
+			return fmt.Errorf("error recording vote: %w", err)
+		}
+
+		// A vote is activity, which keeps the session from being ended as idle
+		if err := sessionRepository.NewGormSessionRepository(tx).TouchSession(session.ID, now); err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("last_vote_time", now).Error
+	})
+}
+
+// checkCooldown rejects the vote if the user's last vote was less than the cooldown ago.
+func checkCooldown(settings models.SessionSettings, lastVoteTime *time.Time, now time.Time) error {
+	if settings.VoteCooldownSeconds <= 0 || lastVoteTime == nil {
+		return nil
+	}
+
+	retryAt := lastVoteTime.Add(time.Duration(settings.VoteCooldownSeconds) * time.Second)
+	if now.Before(retryAt) {
+		return &RateLimitError{Reason: ReasonCooldown, RetryAt: retryAt}
+	}
+	return nil
+}
+
+// checkBudget rejects the vote if the user already took their budget of vote actions in the session within the window.
+// Every action counts at the time it was taken, so toggling or retracting a vote uses up the budget like new votes.
+func checkBudget(tx *gorm.DB, sessionID uint, settings models.SessionSettings, userID uint, now time.Time) error {
+	if settings.VoteBudget <= 0 {
+		return nil
+	}
+
+	window := time.Duration(settings.VoteWindowSeconds) * time.Second
+	var recent []time.Time
+	err := tx.Model(&models.VoteEvent{}).
+		Where("user_id = ? AND session_id = ? AND created_at > ?", userID, sessionID, now.Add(-window)).
+		Order("created_at DESC").
+		Limit(settings.VoteBudget).
+		Pluck("created_at", &recent).Error
+	if err != nil {
+		return fmt.Errorf("error counting recent votes: %w", err)
+	}
+
+	if len(recent) < settings.VoteBudget {
+		return nil
+	}
+
+	// The budget frees up once the oldest of the most recent actions leaves the window
+	return &RateLimitError{Reason: ReasonBudget, RetryAt: recent[len(recent)-1].Add(window)}
+}
+
+// participantsOf returns the IDs of the participants of a session: the users in the session and its host.
+func participantsOf(tx *gorm.DB, session *models.Session) (map[uint]struct{}, error) {
+	users, err := sessionRepository.NewGormSessionRepository(tx).GetUsersInSession(session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading participants: %w", err)
+	}
+
+	participants := map[uint]struct{}{session.HostID: {}}
+	for _, user := range users {
+		participants[user.ID] = struct{}{}
+	}
+	return participants, nil
+}
+
+// skipTally counts the skip votes on a queue item against the skip threshold of its session. At least one vote is
+// needed, so a threshold below one participant still takes someone asking to skip.
+func skipTally(tx *gorm.DB, session *models.Session, queueID uint) (*SkipTally, error) {
+	votes, err := skip_vote.NewGormSkipVoteRepository(tx).CountSkipVotes(queueID)
+	if err != nil {
+		return nil, fmt.Errorf("error counting skip votes: %w", err)
+	}
+
+	tally := &SkipTally{Votes: votes}
+	if session.Settings.SkipThreshold <= 0 {
+		return tally, nil
+	}
+
+	participants, err := participantsOf(tx, session)
+	if err != nil {
+		return nil, err
+	}
+	// The epsilon keeps rounding errors from asking for an extra vote, e.g. 0.3 of 10 participants is 3.0000000000000004
+	tally.Needed = int(math.Ceil(session.Settings.SkipThreshold*float64(len(participants)) - 1e-9))
+	if tally.Needed < 1 {
+		tally.Needed = 1
+	}
+	return tally, nil
+}
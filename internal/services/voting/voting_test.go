@@ -0,0 +1,313 @@
+package voting_test
+
+import (
+	"errors"
+	"fmt"
+	"garrettpfoy/orbit-api/internal/models"
+	"garrettpfoy/orbit-api/internal/repositories/skip_vote"
+	"garrettpfoy/orbit-api/internal/services/encryption"
+	"garrettpfoy/orbit-api/internal/services/voting"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection to an in-memory database opens a new, empty database
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	models.SetEncryptionService(encryption.NewEncryptionService("abcdefghijklmnopqrstuvwxyz123456"))
+
+	err = db.AutoMigrate(&models.User{}, &models.Session{}, &models.Queue{}, &models.Vote{}, &models.VoteEvent{}, &models.SkipVote{}, &models.Track{}, &models.AccessToken{})
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// setupSession creates a session with the given settings, a voter and the given number of queue items.
+func setupSession(t *testing.T, db *gorm.DB, settings models.SessionSettings, items int) (*models.User, []models.Queue) {
+	host := &models.User{Username: "host"}
+	assert.NoError(t, db.Create(host).Error)
+	voter := &models.User{Username: "voter"}
+	assert.NoError(t, db.Create(voter).Error)
+
+	// Only the voting settings are taken from the given settings, the others keep their defaults
+	sessionSettings := models.DefaultSessionSettings()
+	sessionSettings.VoteCooldownSeconds = settings.VoteCooldownSeconds
+	sessionSettings.VoteBudget = settings.VoteBudget
+	sessionSettings.VoteWindowSeconds = settings.VoteWindowSeconds
+	session := &models.Session{Slug: "party", HostID: host.ID, Settings: sessionSettings}
+	assert.NoError(t, db.Create(session).Error)
+
+	queueItems := make([]models.Queue, items)
+	for i := range queueItems {
+		queueItems[i] = models.Queue{TrackURI: fmt.Sprintf("spotify:track:%d", i), SessionID: session.ID, UserID: host.ID}
+		assert.NoError(t, db.Create(&queueItems[i]).Error)
+	}
+	return voter, queueItems
+}
+
+func TestVote(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	voter, queueItems := setupSession(t, db, models.SessionSettings{}, 1)
+	service := voting.NewService(db)
+
+	castVote, err := service.Vote(voter.ID, queueItems[0].ID, models.VoteUp)
+	assert.NoError(t, err)
+	assert.Equal(t, models.VoteUp, castVote.Direction)
+
+	// Voting again in the other direction changes the vote
+	changedVote, err := service.Vote(voter.ID, queueItems[0].ID, models.VoteDown)
+	assert.NoError(t, err)
+	assert.Equal(t, castVote.ID, changedVote.ID)
+	assert.Equal(t, models.VoteDown, changedVote.Direction)
+
+	var queueItem models.Queue
+	assert.NoError(t, db.First(&queueItem, queueItems[0].ID).Error)
+	assert.Equal(t, -1, queueItem.Weight)
+
+	var user models.User
+	assert.NoError(t, db.First(&user, voter.ID).Error)
+	assert.NotNil(t, user.LastVoteTime)
+	assert.WithinDuration(t, time.Now(), *user.LastVoteTime, time.Second)
+}
+
+func TestVoteCooldown(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	voter, queueItems := setupSession(t, db, models.SessionSettings{VoteCooldownSeconds: 60}, 2)
+	service := voting.NewService(db)
+
+	_, err = service.Vote(voter.ID, queueItems[0].ID, models.VoteUp)
+	assert.NoError(t, err)
+
+	_, err = service.Vote(voter.ID, queueItems[1].ID, models.VoteUp)
+	assert.True(t, errors.Is(err, voting.ErrRateLimited))
+
+	var rateLimited *voting.RateLimitError
+	assert.True(t, errors.As(err, &rateLimited))
+	assert.Equal(t, voting.ReasonCooldown, rateLimited.Reason)
+	assert.InDelta(t, 60*time.Second, rateLimited.RetryAfter(time.Now()), float64(2*time.Second))
+
+	// The rejected vote was not recorded
+	var queueItem models.Queue
+	assert.NoError(t, db.First(&queueItem, queueItems[1].ID).Error)
+	assert.Equal(t, 0, queueItem.Weight)
+
+	// Retracting is voting too
+	err = service.Retract(voter.ID, queueItems[0].ID)
+	assert.True(t, errors.Is(err, voting.ErrRateLimited))
+
+	// Once the cooldown has passed the user can vote again
+	assert.NoError(t, db.Model(voter).Update("last_vote_time", time.Now().Add(-time.Minute)).Error)
+	_, err = service.Vote(voter.ID, queueItems[1].ID, models.VoteUp)
+	assert.NoError(t, err)
+}
+
+func TestVoteBudget(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	voter, queueItems := setupSession(t, db, models.SessionSettings{VoteBudget: 3, VoteWindowSeconds: 3600}, 5)
+	service := voting.NewService(db)
+
+	for _, queueItem := range queueItems[:3] {
+		_, err = service.Vote(voter.ID, queueItem.ID, models.VoteUp)
+		assert.NoError(t, err)
+	}
+
+	_, err = service.Vote(voter.ID, queueItems[3].ID, models.VoteUp)
+	var rateLimited *voting.RateLimitError
+	assert.True(t, errors.As(err, &rateLimited))
+	assert.Equal(t, voting.ReasonBudget, rateLimited.Reason)
+	assert.InDelta(t, time.Hour, rateLimited.RetryAfter(time.Now()), float64(5*time.Second))
+
+	// Retracting a vote does not give the budget back
+	err = service.Retract(voter.ID, queueItems[0].ID)
+	assert.True(t, errors.Is(err, voting.ErrRateLimited))
+
+	// Votes that leave the window free up the budget
+	assert.NoError(t, db.Model(&models.VoteEvent{}).Where("queue_id = ?", queueItems[0].ID).UpdateColumn("created_at", time.Now().Add(-2*time.Hour)).Error)
+	_, err = service.Vote(voter.ID, queueItems[3].ID, models.VoteUp)
+	assert.NoError(t, err)
+}
+
+func TestVoteBudgetCountsEveryAction(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	voter, queueItems := setupSession(t, db, models.SessionSettings{VoteBudget: 3, VoteWindowSeconds: 3600}, 1)
+	service := voting.NewService(db)
+
+	// Casting, changing and retracting the same vote use up the budget like three votes
+	_, err = service.Vote(voter.ID, queueItems[0].ID, models.VoteUp)
+	assert.NoError(t, err)
+	_, err = service.Vote(voter.ID, queueItems[0].ID, models.VoteDown)
+	assert.NoError(t, err)
+	assert.NoError(t, service.Retract(voter.ID, queueItems[0].ID))
+
+	_, err = service.Vote(voter.ID, queueItems[0].ID, models.VoteUp)
+	var rateLimited *voting.RateLimitError
+	assert.True(t, errors.As(err, &rateLimited))
+	assert.Equal(t, voting.ReasonBudget, rateLimited.Reason)
+
+	var actions []string
+	assert.NoError(t, db.Model(&models.VoteEvent{}).Where("user_id = ?", voter.ID).Order("id").Pluck("action", &actions).Error)
+	assert.Equal(t, []string{models.VoteEventCast, models.VoteEventChange, models.VoteEventRetract}, actions)
+}
+
+func TestVoteMissingQueueItem(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	voter, _ := setupSession(t, db, models.SessionSettings{}, 0)
+	service := voting.NewService(db)
+
+	_, err = service.Vote(voter.ID, 42, models.VoteUp)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	var user models.User
+	assert.NoError(t, db.First(&user, voter.ID).Error)
+	assert.Nil(t, user.LastVoteTime)
+}
+
+func TestVoteInEndedSession(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	voter, queueItems := setupSession(t, db, models.SessionSettings{}, 2)
+	service := voting.NewService(db)
+
+	// A vote counts as activity in the session
+	_, err = service.Vote(voter.ID, queueItems[0].ID, models.VoteUp)
+	assert.NoError(t, err)
+
+	var session models.Session
+	assert.NoError(t, db.First(&session, queueItems[0].SessionID).Error)
+	assert.NotNil(t, session.LastActivityAt)
+	assert.WithinDuration(t, time.Now(), *session.LastActivityAt, time.Second)
+
+	assert.NoError(t, db.Model(&session).Update("status", models.SessionStatusEnded).Error)
+	_, err = service.Vote(voter.ID, queueItems[1].ID, models.VoteUp)
+	assert.True(t, errors.Is(err, voting.ErrSessionEnded))
+}
+
+func TestConcurrentVotesRespectCooldown(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	voter, queueItems := setupSession(t, db, models.SessionSettings{VoteCooldownSeconds: 60}, 10)
+	service := voting.NewService(db)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for _, queueItem := range queueItems {
+		wg.Add(1)
+		queueID := queueItem.ID
+		go func() {
+			defer wg.Done()
+			_, err := service.Vote(voter.ID, queueID, models.VoteUp)
+			if errors.Is(err, voting.ErrRateLimited) {
+				return
+			}
+			assert.NoError(t, err)
+
+			mu.Lock()
+			accepted++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, accepted)
+}
+
+func TestVoteToSkip(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	voter, queueItems := setupSession(t, db, models.SessionSettings{}, 2)
+	assert.NoError(t, db.Model(&queueItems[0]).Update("status", models.QueueStatusNowPlaying).Error)
+	service := voting.NewService(db)
+
+	// The host, the voter and two guests take part in the session, so two of them have to vote to skip
+	guest := &models.User{Username: "guest"}
+	assert.NoError(t, db.Create(guest).Error)
+	other := &models.User{Username: "other"}
+	assert.NoError(t, db.Create(other).Error)
+	session := &models.Session{}
+	session.ID = queueItems[0].SessionID
+	assert.NoError(t, db.Model(session).Association("Users").Append(voter, guest, other))
+
+	stranger := &models.User{Username: "stranger"}
+	assert.NoError(t, db.Create(stranger).Error)
+	_, err = service.VoteToSkip(stranger.ID, queueItems[0].ID)
+	assert.True(t, errors.Is(err, voting.ErrNotParticipant))
+
+	tally, err := service.VoteToSkip(voter.ID, queueItems[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, voting.SkipTally{Votes: 1, Needed: 2}, *tally)
+	assert.False(t, tally.Reached())
+
+	_, err = service.VoteToSkip(voter.ID, queueItems[0].ID)
+	assert.True(t, errors.Is(err, skip_vote.ErrAlreadyVotedToSkip))
+
+	// Only the now playing item can be skipped
+	_, err = service.VoteToSkip(guest.ID, queueItems[1].ID)
+	assert.True(t, errors.Is(err, skip_vote.ErrNotPlaying))
+
+	tally, err = service.VoteToSkip(guest.ID, queueItems[0].ID)
+	assert.NoError(t, err)
+	assert.True(t, tally.Reached())
+
+	skip, err := service.ShouldSkip(&queueItems[0])
+	assert.NoError(t, err)
+	assert.True(t, skip)
+
+	// Retracting a skip vote takes the item back under the threshold
+	assert.NoError(t, service.RetractSkip(guest.ID, queueItems[0].ID))
+	skip, err = service.ShouldSkip(&queueItems[0])
+	assert.NoError(t, err)
+	assert.False(t, skip)
+}
+
+func TestVoteToSkipDisabled(t *testing.T) {
+	db, err := setupTestDB()
+	assert.NoError(t, err)
+
+	voter, queueItems := setupSession(t, db, models.SessionSettings{}, 1)
+	settings := models.DefaultSessionSettings()
+	settings.VoteCooldownSeconds = 0
+	settings.VoteBudget = 0
+	settings.SkipThreshold = 0
+	assert.NoError(t, db.Model(&models.Session{}).Where("id = ?", queueItems[0].SessionID).Update("settings", settings).Error)
+	assert.NoError(t, db.Model(&queueItems[0]).Update("status", models.QueueStatusNowPlaying).Error)
+	session := &models.Session{}
+	session.ID = queueItems[0].SessionID
+	assert.NoError(t, db.Model(session).Association("Users").Append(voter))
+	service := voting.NewService(db)
+
+	tally, err := service.VoteToSkip(voter.ID, queueItems[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, tally.Needed)
+	assert.False(t, tally.Reached())
+}